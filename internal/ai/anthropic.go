@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/liushuangls/go-anthropic/v2"
 	"strings"
+	"web-scraper/internal/config"
 	ai "web-scraper/internal/interfaces"
 )
 
@@ -50,3 +51,115 @@ func (a *AnthropicClient) ProcessSearchResults(results []ai.SearchResult) (strin
 	fmt.Println(resultText)
 	return resultText, nil
 }
+
+func (a *AnthropicClient) Name() string {
+	return "anthropic"
+}
+
+func (a *AnthropicClient) Model() string {
+	return config.Config.AnthropicModel
+}
+
+func (a *AnthropicClient) Complete(ctx context.Context, req CompletionRequest) (CompletionResponse, error) {
+	model := req.Model
+	if model == "" {
+		model = a.Model()
+	}
+	maxTokens := req.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = config.Config.MaxCompletionTokens
+	}
+
+	var messages []anthropic.Message
+	for _, m := range req.Messages {
+		switch {
+		case m.Role == "assistant" && len(m.ToolCalls) > 0:
+			var content []anthropic.MessageContent
+			if m.Content != "" {
+				content = append(content, anthropic.NewTextMessageContent(m.Content))
+			}
+			for _, call := range m.ToolCalls {
+				content = append(content, anthropic.NewToolUseMessageContent(call.ID, call.Name, call.Arguments))
+			}
+			messages = append(messages, anthropic.Message{Role: anthropic.RoleAssistant, Content: content})
+		case m.Role == "assistant":
+			messages = append(messages, anthropic.NewAssistantTextMessage(m.Content))
+		case m.Role == "tool":
+			// Results of parallel tool calls go back in a single user turn
+			result := anthropic.NewToolResultMessageContent(m.ToolCallID, m.Content, false)
+			if last := len(messages) - 1; last >= 0 && messages[last].Role == anthropic.RoleUser &&
+				messages[last].Content[0].Type == anthropic.MessagesContentTypeToolResult {
+				messages[last].Content = append(messages[last].Content, result)
+			} else {
+				messages = append(messages, anthropic.Message{Role: anthropic.RoleUser, Content: []anthropic.MessageContent{result}})
+			}
+		default:
+			messages = append(messages, anthropic.NewUserTextMessage(m.Content))
+		}
+	}
+
+	request := anthropic.MessagesRequest{
+		Model:     anthropic.Model(model),
+		System:    req.System,
+		Messages:  messages,
+		MaxTokens: maxTokens,
+	}
+	if req.JSONSchema != nil {
+		// Structured output is a forced call to a tool whose input is the schema
+		request.Tools = []anthropic.ToolDefinition{{
+			Name:        req.JSONSchema.Name,
+			Description: req.JSONSchema.Description,
+			InputSchema: req.JSONSchema.Schema,
+		}}
+		request.ToolChoice = &anthropic.ToolChoice{Type: "tool", Name: req.JSONSchema.Name}
+	}
+	for _, tool := range req.Tools {
+		request.Tools = append(request.Tools, anthropic.ToolDefinition{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: tool.Parameters,
+		})
+	}
+	if req.DisableToolCalls && len(req.Tools) > 0 {
+		request.ToolChoice = &anthropic.ToolChoice{Type: "none"}
+	}
+
+	resp, err := a.client.CreateMessages(ctx, request)
+	if err != nil {
+		return CompletionResponse{}, fmt.Errorf("Anthropic API error: %v", err)
+	}
+
+	var (
+		text      strings.Builder
+		toolCalls []ToolCall
+	)
+	for _, content := range resp.Content {
+		switch content.Type {
+		case anthropic.MessagesContentTypeText:
+			text.WriteString(content.GetText())
+		case anthropic.MessagesContentTypeToolUse:
+			if content.MessageContentToolUse == nil {
+				continue
+			}
+			if req.JSONSchema != nil {
+				text.Write(content.MessageContentToolUse.Input)
+				continue
+			}
+			toolCalls = append(toolCalls, ToolCall{
+				ID:        content.MessageContentToolUse.ID,
+				Name:      content.MessageContentToolUse.Name,
+				Arguments: content.MessageContentToolUse.Input,
+			})
+		}
+	}
+
+	return CompletionResponse{
+		Content:   text.String(),
+		ToolCalls: toolCalls,
+		Usage: Usage{
+			PromptTokens:     resp.Usage.InputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+		},
+	}, nil
+}
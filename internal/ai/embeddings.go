@@ -0,0 +1,90 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"math"
+	"web-scraper/internal/config"
+)
+
+// Embedder turns texts into embedding vectors
+type Embedder interface {
+	Model() string
+	Embed(ctx context.Context, texts []string) ([][]float32, Usage, error)
+}
+
+// OpenAIEmbedder calls the OpenAI embeddings API or any server implementing
+// the same API
+type OpenAIEmbedder struct {
+	client *openai.Client
+	model  string
+}
+
+// NewEmbedder returns the embedding provider selected by name: "openai", or
+// "local" for an OpenAI-compatible endpoint at EMBEDDING_BASE_URL
+func NewEmbedder(name string) Embedder {
+	switch name {
+	case "local":
+		clientConfig := openai.DefaultConfig(config.Config.EmbeddingAPIKey)
+		clientConfig.BaseURL = config.Config.EmbeddingBaseURL
+		return &OpenAIEmbedder{
+			client: openai.NewClientWithConfig(clientConfig),
+			model:  config.Config.EmbeddingModel,
+		}
+	default:
+		return &OpenAIEmbedder{
+			client: openai.NewClient(config.Config.OpenAIKey),
+			model:  config.Config.EmbeddingModel,
+		}
+	}
+}
+
+func (e *OpenAIEmbedder) Model() string {
+	return e.model
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, Usage, error) {
+	resp, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Input: texts,
+		Model: openai.EmbeddingModel(e.model),
+	})
+	if err != nil {
+		return nil, Usage{}, fmt.Errorf("embedding API error: %v", err)
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, data := range resp.Data {
+		if data.Index < 0 || data.Index >= len(vectors) {
+			return nil, Usage{}, fmt.Errorf("embedding API error: unexpected index %d", data.Index)
+		}
+		vectors[data.Index] = data.Embedding
+	}
+	for i, vector := range vectors {
+		if vector == nil {
+			return nil, Usage{}, fmt.Errorf("embedding API error: missing embedding %d", i)
+		}
+	}
+
+	return vectors, Usage{
+		PromptTokens: resp.Usage.PromptTokens,
+		TotalTokens:  resp.Usage.TotalTokens,
+	}, nil
+}
+
+// Cosine returns the cosine similarity of two vectors of the same length
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -2,9 +2,11 @@ package ai
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/sashabaranov/go-openai"
 	"strings"
+	"web-scraper/internal/config"
 	"web-scraper/internal/models"
 )
 
@@ -69,3 +71,101 @@ func (o *OpenAIClient) FormatResults(input string) (string, error) {
 
 	return resp.Choices[0].Message.Content, nil
 }
+
+func (o *OpenAIClient) Name() string {
+	return "openai"
+}
+
+func (o *OpenAIClient) Model() string {
+	return config.Config.OpenAIModel
+}
+
+func (o *OpenAIClient) Complete(ctx context.Context, req CompletionRequest) (CompletionResponse, error) {
+	model := req.Model
+	if model == "" {
+		model = o.Model()
+	}
+
+	var messages []openai.ChatCompletionMessage
+	if req.System != "" {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: req.System,
+		})
+	}
+	for _, m := range req.Messages {
+		message := openai.ChatCompletionMessage{
+			Role:       m.Role,
+			Content:    m.Content,
+			ToolCallID: m.ToolCallID,
+		}
+		for _, call := range m.ToolCalls {
+			message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+				ID:   call.ID,
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      call.Name,
+					Arguments: string(call.Arguments),
+				},
+			})
+		}
+		messages = append(messages, message)
+	}
+
+	request := openai.ChatCompletionRequest{
+		Model:     model,
+		Messages:  messages,
+		MaxTokens: req.MaxTokens,
+	}
+	if req.JSONSchema != nil {
+		request.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:        req.JSONSchema.Name,
+				Description: req.JSONSchema.Description,
+				Schema:      req.JSONSchema.Schema,
+			},
+		}
+	}
+
+	for _, tool := range req.Tools {
+		request.Tools = append(request.Tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	if req.DisableToolCalls && len(req.Tools) > 0 {
+		request.ToolChoice = "none"
+	}
+
+	resp, err := o.client.CreateChatCompletion(ctx, request)
+	if err != nil {
+		return CompletionResponse{}, fmt.Errorf("OpenAI API error: %v", err)
+	}
+	if len(resp.Choices) == 0 {
+		return CompletionResponse{}, fmt.Errorf("OpenAI API error: empty response")
+	}
+
+	var toolCalls []ToolCall
+	for _, call := range resp.Choices[0].Message.ToolCalls {
+		toolCalls = append(toolCalls, ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: json.RawMessage(call.Function.Arguments),
+		})
+	}
+
+	return CompletionResponse{
+		Content:   resp.Choices[0].Message.Content,
+		ToolCalls: toolCalls,
+		Usage: Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+	}, nil
+}
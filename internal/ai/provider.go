@@ -0,0 +1,85 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"web-scraper/internal/config"
+)
+
+// Message is a single chat turn sent to a provider. Roles are "user",
+// "assistant" and "tool"; a tool message answers the call in ToolCallID.
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// Tool is a function the model may call. Parameters is a JSON Schema object.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+}
+
+// ToolCall is a tool invocation requested by the model
+type ToolCall struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// CompletionRequest is a provider-agnostic chat completion request.
+// Empty Model and MaxTokens fall back to the provider defaults.
+type CompletionRequest struct {
+	Model     string
+	System    string
+	Messages  []Message
+	MaxTokens int
+	// JSONSchema, when set, asks for a JSON object matching the schema
+	// instead of free text
+	JSONSchema *JSONSchema
+	// Tools the model may call instead of answering
+	Tools []Tool
+	// DisableToolCalls makes the model answer in text. The tools are still
+	// described, since earlier messages may call them.
+	DisableToolCalls bool
+}
+
+// JSONSchema describes the structured output of a completion. OpenAI receives
+// it as a json_schema response format, Anthropic as a forced tool call.
+type JSONSchema struct {
+	Name        string
+	Description string
+	Schema      json.RawMessage
+}
+
+// Usage reports the tokens billed for a completion
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type CompletionResponse struct {
+	Content   string
+	ToolCalls []ToolCall
+	Usage     Usage
+}
+
+// Provider is implemented by every LLM backend the handlers can talk to
+type Provider interface {
+	Name() string
+	Model() string
+	Complete(ctx context.Context, req CompletionRequest) (CompletionResponse, error)
+}
+
+// NewProvider returns the provider selected by name, defaulting to OpenAI
+func NewProvider(name string) Provider {
+	switch name {
+	case "anthropic":
+		return NewAnthropicClient(config.Config.AnthropicAIKey)
+	default:
+		return NewOpenAIClient(config.Config.OpenAIKey)
+	}
+}
@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+	"web-scraper/internal/models"
+	"web-scraper/internal/storage"
+)
+
+const bucket = "audit_log"
+
+// Filter selects events; zero fields match everything
+type Filter struct {
+	Type     string
+	Username string
+	IP       string
+	Limit    int
+}
+
+func (f Filter) matches(event *models.AuditEvent) bool {
+	return (f.Type == "" || event.Type == f.Type) &&
+		(f.Username == "" || event.Username == f.Username) &&
+		(f.IP == "" || event.IP == f.IP)
+}
+
+// key orders events by time
+func key(event *models.AuditEvent) string {
+	return fmt.Sprintf("%020d/%s", event.CreatedAt.UnixNano(), event.ID)
+}
+
+// Record stores an event and logs it. Failing to store it is logged rather
+// than failing the request that caused it.
+func Record(event models.AuditEvent) {
+	event.ID = storage.NewID()
+	event.CreatedAt = time.Now()
+	log.Printf("Audit: %s username=%q ip=%s %s", event.Type, event.Username, event.IP, event.Detail)
+	if err := storage.GetStore().Put(bucket, key(&event), event); err != nil {
+		log.Printf("Error recording audit event: %v", err)
+	}
+}
+
+// List returns up to filter.Limit matching events, newest first
+func List(filter Filter) ([]models.AuditEvent, error) {
+	var matched []models.AuditEvent
+	err := storage.GetStore().ForEach(bucket, "", func(key string, data []byte) error {
+		var event models.AuditEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			log.Printf("Error decoding audit event %s: %v", key, err)
+			return nil
+		}
+		if filter.matches(&event) {
+			matched = append(matched, event)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	events := []models.AuditEvent{}
+	for i := len(matched) - 1; i >= 0 && len(events) < filter.Limit; i-- {
+		events = append(events, matched[i])
+	}
+	return events, nil
+}
+
+// Prune deletes events older than ttl
+func Prune(ttl time.Duration) (int, error) {
+	cutoff := fmt.Sprintf("%020d", time.Now().Add(-ttl).UnixNano())
+	var keys []string
+	err := storage.GetStore().ForEach(bucket, "", func(key string, data []byte) error {
+		if key >= cutoff {
+			return storage.ErrStop
+		}
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		if err := storage.GetStore().Delete(bucket, key); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// StartPruning prunes expired events now and then every interval
+func StartPruning(ttl, interval time.Duration) {
+	go func() {
+		for {
+			removed, err := Prune(ttl)
+			if err != nil {
+				log.Printf("Error pruning audit log: %v", err)
+			} else if removed > 0 {
+				log.Printf("Pruned %d audit events", removed)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
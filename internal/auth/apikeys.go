@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/time/rate"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"web-scraper/internal/models"
+	"web-scraper/internal/storage"
+)
+
+const apiKeysBucket = "api_keys"
+
+// Keys start with this marker so they are recognizable in config files and
+// secret scanners
+const apiKeyMarker = "wsk_"
+
+// Last-used times are written at most this often per key
+const lastUsedInterval = time.Minute
+
+var (
+	// ErrScope is returned when an API key lacks the scope of the route
+	ErrScope = errors.New("API key lacks the required scope")
+	// ErrRateLimited is returned when an API key exceeds its rate limit
+	ErrRateLimited = errors.New("API key rate limit exceeded")
+)
+
+var (
+	// keysMu serializes updates of stored keys
+	keysMu sync.Mutex
+
+	limitersMu sync.Mutex
+	limiters   = map[string]*rate.Limiter{}
+	lastUsed   = map[string]time.Time{}
+)
+
+// CreateAPIKey stores a new key for the user and returns the raw key, which
+// is not kept and cannot be shown again
+func CreateAPIKey(key *models.APIKey) (string, error) {
+	raw := apiKeyMarker + RandomToken()
+	key.ID = storage.NewID()
+	key.Prefix = raw[:len(apiKeyMarker)+8]
+	key.CreatedAt = time.Now()
+	if err := storage.GetStore().Put(apiKeysBucket, hashToken(raw), key); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// ListAPIKeys returns the user's keys, newest first
+func ListAPIKeys(userID string) ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+	err := eachAPIKey(func(hash string, key *models.APIKey) error {
+		if key.UserID == userID {
+			keys = append(keys, *key)
+		}
+		return nil
+	})
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys, err
+}
+
+// RevokeAPIKey revokes the user's key with the given ID
+func RevokeAPIKey(id, userID string) (*models.APIKey, bool, error) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	var (
+		found *models.APIKey
+		hash  string
+	)
+	err := eachAPIKey(func(h string, key *models.APIKey) error {
+		if key.ID == id && key.UserID == userID {
+			found, hash = key, h
+			return storage.ErrStop
+		}
+		return nil
+	})
+	if err != nil || found == nil {
+		return nil, false, err
+	}
+
+	if found.RevokedAt == nil {
+		now := time.Now()
+		found.RevokedAt = &now
+		if err := storage.GetStore().Put(apiKeysBucket, hash, found); err != nil {
+			return nil, true, err
+		}
+	}
+	return found, true, nil
+}
+
+// RevokeUserAPIKeys revokes every active key of the user
+func RevokeUserAPIKeys(userID string) error {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	now := time.Now()
+	revoked := map[string]*models.APIKey{}
+	err := eachAPIKey(func(hash string, key *models.APIKey) error {
+		if key.UserID == userID && key.RevokedAt == nil {
+			key.RevokedAt = &now
+			revoked[hash] = key
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for hash, key := range revoked {
+		if err := storage.GetStore().Put(apiKeysBucket, hash, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AuthenticateAPIKey checks a raw API key for a request to path and returns
+// claims shaped like those of an access token, with the key's ID and
+// scopes added
+func AuthenticateAPIKey(raw, path string) (jwt.MapClaims, error) {
+	if !strings.HasPrefix(raw, apiKeyMarker) {
+		return nil, ErrInvalidToken
+	}
+
+	hash := hashToken(raw)
+	var key models.APIKey
+	found, err := storage.GetStore().Get(apiKeysBucket, hash, &key)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !found || key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, ErrInvalidToken
+	}
+
+	scope := ScopeForPath(path)
+	if scope == "" || !hasScope(key.Scopes, scope) {
+		return nil, ErrScope
+	}
+	if !allow(&key) {
+		return nil, ErrRateLimited
+	}
+	touchAPIKey(hash, key.ID, now)
+
+	scopes := make([]interface{}, len(key.Scopes))
+	for i, s := range key.Scopes {
+		scopes[i] = s
+	}
+	return jwt.MapClaims{
+		"user_id":  key.UserID,
+		"username": key.Username,
+		"email":    key.Email,
+		"role":     RoleService,
+		"key_id":   key.ID,
+		"scopes":   scopes,
+	}, nil
+}
+
+// allow applies the key's per-minute rate limit
+func allow(key *models.APIKey) bool {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+
+	limiter, ok := limiters[key.ID]
+	if !ok || limiter.Burst() != key.RateLimit {
+		limiter = rate.NewLimiter(rate.Limit(float64(key.RateLimit)/60), key.RateLimit)
+		limiters[key.ID] = limiter
+	}
+	return limiter.Allow()
+}
+
+// touchAPIKey records when the key was last used, writing at most once per
+// lastUsedInterval
+func touchAPIKey(hash, id string, now time.Time) {
+	limitersMu.Lock()
+	if now.Sub(lastUsed[id]) < lastUsedInterval {
+		limitersMu.Unlock()
+		return
+	}
+	lastUsed[id] = now
+	limitersMu.Unlock()
+
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	var key models.APIKey
+	found, err := storage.GetStore().Get(apiKeysBucket, hash, &key)
+	if err == nil && found {
+		key.LastUsedAt = &now
+		err = storage.GetStore().Put(apiKeysBucket, hash, &key)
+	}
+	if err != nil {
+		log.Printf("Error recording API key use: %v", err)
+	}
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func eachAPIKey(fn func(hash string, key *models.APIKey) error) error {
+	return storage.GetStore().ForEach(apiKeysBucket, "", func(hash string, data []byte) error {
+		var key models.APIKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			log.Printf("Error decoding API key %s: %v", hash, err)
+			return nil
+		}
+		return fn(hash, &key)
+	})
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"testing"
+	"time"
+	"web-scraper/internal/models"
+)
+
+func TestScopeForPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api/scraper", ScopeSearch},
+		{"/api/scraper-deep", ScopeSearch},
+		{"/api/scrape", ScopeSearch},
+		{"/api/sessions/abc/ask", ScopeSearch},
+		{"/api/index/search", ScopeSearch},
+		{"/api/jobs/abc", ScopeJobs},
+		{"/api/crawls/abc/pages", ScopeCrawls},
+		{"/api/monitors", ScopeMonitors},
+		{"/api/collections/abc/items", ScopeCollections},
+		{"/api/history/abc/replay", ScopeHistory},
+		// Only open to logged-in users
+		{"/api/keys", ""},
+		{"/api/logout", ""},
+		{"/api/admin/audit", ""},
+		{"/api/email/verify/resend", ""},
+		{"/cache/stats", ""},
+		{"/api/scraperx", ""},
+		{"/api/not-yet-listed", ""},
+	}
+	for _, tt := range tests {
+		if got := ScopeForPath(tt.path); got != tt.want {
+			t.Errorf("ScopeForPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	user := newUser(t)
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name string
+		key  models.APIKey
+		// raw replaces the created key when set
+		raw  string
+		path string
+		want error
+	}{
+		{name: "scoped route", key: models.APIKey{Scopes: []string{ScopeSearch}}, path: "/api/scraper"},
+		{name: "other scope", key: models.APIKey{Scopes: []string{ScopeSearch}}, path: "/api/jobs/abc", want: ErrScope},
+		{name: "unlisted route", key: models.APIKey{Scopes: Scopes}, path: "/api/keys", want: ErrScope},
+		{name: "expired key", key: models.APIKey{Scopes: Scopes, ExpiresAt: &past}, path: "/api/scraper", want: ErrInvalidToken},
+		{name: "revoked key", key: models.APIKey{Scopes: Scopes, RevokedAt: &past}, path: "/api/scraper", want: ErrInvalidToken},
+		{name: "unknown key", raw: apiKeyMarker + RandomToken(), path: "/api/scraper", want: ErrInvalidToken},
+		{name: "access token", raw: "eyJhbGciOiJIUzI1NiJ9.e30.x", path: "/api/scraper", want: ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := tt.raw
+			if raw == "" {
+				raw = createKey(t, user, tt.key)
+			}
+			claims, err := AuthenticateAPIKey(raw, tt.path)
+			if err != tt.want {
+				t.Fatalf("AuthenticateAPIKey returned %v, want %v", err, tt.want)
+			}
+			if err == nil && (claims["user_id"] != user.UserID || claims["role"] != RoleService) {
+				t.Errorf("unexpected claims %v", claims)
+			}
+		})
+	}
+}
+
+func TestAPIKeyRateLimit(t *testing.T) {
+	user := newUser(t)
+	raw := createKey(t, user, models.APIKey{Scopes: Scopes, RateLimit: 3})
+
+	// Refused scopes don't count against the limit
+	if _, err := AuthenticateAPIKey(raw, "/api/keys"); err != ErrScope {
+		t.Fatalf("unlisted route returned %v, want %v", err, ErrScope)
+	}
+	for i := 1; i <= 3; i++ {
+		if _, err := AuthenticateAPIKey(raw, "/api/scraper"); err != nil {
+			t.Fatalf("request %d returned %v", i, err)
+		}
+	}
+	if _, err := AuthenticateAPIKey(raw, "/api/scraper"); err != ErrRateLimited {
+		t.Fatalf("request over the limit returned %v, want %v", err, ErrRateLimited)
+	}
+
+	// Each key has a limiter of its own
+	other := createKey(t, user, models.APIKey{Scopes: Scopes, RateLimit: 3})
+	if _, err := AuthenticateAPIKey(other, "/api/scraper"); err != nil {
+		t.Errorf("another key of the user returned %v", err)
+	}
+}
+
+func TestRevokeUserAPIKeys(t *testing.T) {
+	user := newUser(t)
+	raw := createKey(t, user, models.APIKey{Scopes: Scopes})
+	if err := RevokeUserAPIKeys(user.UserID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AuthenticateAPIKey(raw, "/api/scraper"); err != ErrInvalidToken {
+		t.Errorf("revoked key returned %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func createKey(t *testing.T, user models.User, key models.APIKey) string {
+	t.Helper()
+	key.UserID = user.UserID
+	key.Username = user.Username
+	if key.RateLimit == 0 {
+		key.RateLimit = 100
+	}
+	raw, err := CreateAPIKey(&key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
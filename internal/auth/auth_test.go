@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"os"
+	"testing"
+	"web-scraper/internal/config"
+	"web-scraper/internal/database"
+	"web-scraper/internal/models"
+	"web-scraper/internal/storage"
+)
+
+// The tests run against a bbolt store and a SQLite user store in a
+// temporary data directory
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "auth-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("JWT_SECRET", "test-secret")
+	config.Config.DataDir = dir
+	config.Config.UserStore = "sqlite"
+	config.Config.SQLitePath = ""
+	config.Config.AdminUsers = ""
+	config.Config.CaptchaVerifyURL = ""
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newUser creates a user with a unique ID, so tests can be repeated against
+// the same stores
+func newUser(t *testing.T) models.User {
+	t.Helper()
+	users, err := database.GetUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := storage.NewID()
+	user := &models.User{
+		Username: "user-" + id,
+		UserID:   id,
+		HashPass: "x",
+		From:     "web",
+		ChatID:   id,
+		Role:     RoleUser,
+	}
+	if err := users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	return *user
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+	"web-scraper/internal/config"
+)
+
+var captchaClient = &http.Client{Timeout: 10 * time.Second}
+
+// CaptchaEnabled reports whether logins can require a CAPTCHA
+func CaptchaEnabled() bool {
+	return config.Config.CaptchaVerifyURL != ""
+}
+
+// VerifyCaptcha checks a CAPTCHA response with the siteverify endpoint.
+// reCAPTCHA, hCaptcha and Turnstile share the same request and response.
+func VerifyCaptcha(response, ip string) (bool, error) {
+	form := url.Values{
+		"secret":   {config.Config.CaptchaSecret},
+		"response": {response},
+	}
+	if ip != "" {
+		form.Set("remoteip", ip)
+	}
+
+	resp, err := captchaClient.PostForm(config.Config.CaptchaVerifyURL, form)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("CAPTCHA verification returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+	return result.Success, nil
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"golang.org/x/time/rate"
+	"sync"
+	"time"
+	"web-scraper/internal/config"
+)
+
+// Idle IP limiters are dropped once this many are kept
+const maxIPLimiters = 10000
+
+type ipLimiter struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+var (
+	ipLimitersMu sync.Mutex
+	ipLimiters   = map[string]*ipLimiter{}
+)
+
+// AllowAccountRequest applies the per-IP, per-minute limit on account
+// requests that need no login, such as signups and password reset emails.
+// A limit below 1 turns it off.
+func AllowAccountRequest(ip string) bool {
+	limit := config.Config.AccountRateLimit
+	if limit < 1 {
+		return true
+	}
+
+	ipLimitersMu.Lock()
+	defer ipLimitersMu.Unlock()
+
+	now := time.Now()
+	if len(ipLimiters) >= maxIPLimiters {
+		for key, entry := range ipLimiters {
+			// A limiter idle for a minute is full again
+			if now.Sub(entry.seen) > time.Minute {
+				delete(ipLimiters, key)
+			}
+		}
+	}
+
+	entry, ok := ipLimiters[ip]
+	if !ok {
+		entry = &ipLimiter{limiter: rate.NewLimiter(rate.Limit(float64(limit)/60), limit)}
+		ipLimiters[ip] = entry
+	}
+	entry.seen = now
+	return entry.limiter.Allow()
+}
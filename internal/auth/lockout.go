@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"web-scraper/internal/audit"
+	"web-scraper/internal/config"
+	"web-scraper/internal/models"
+	"web-scraper/internal/storage"
+)
+
+const loginAttemptsBucket = "login_attempts"
+
+// LoginAttempts tracks the failed logins of a username or an IP
+type LoginAttempts struct {
+	Key         string     `json:"key"`
+	Failures    int        `json:"failures"`
+	LastFailure time.Time  `json:"last_failure"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+}
+
+func (a *LoginAttempts) retryAfter(now time.Time) time.Duration {
+	if a.LockedUntil == nil || !now.Before(*a.LockedUntil) {
+		return 0
+	}
+	return a.LockedUntil.Sub(now)
+}
+
+// LoginStatus tells whether a login may be attempted
+type LoginStatus struct {
+	// RetryAfter is how long the username or IP stays locked out
+	RetryAfter      time.Duration
+	CaptchaRequired bool
+}
+
+func (s LoginStatus) Locked() bool {
+	return s.RetryAfter > 0
+}
+
+// loginMu serializes updates of login attempts
+var loginMu sync.Mutex
+
+func usernameKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// CheckLogin returns whether the username and IP are locked out or need a
+// CAPTCHA
+func CheckLogin(username, ip string) (LoginStatus, error) {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+
+	now := time.Now()
+	user, err := loadAttempts(usernameKey(username), now)
+	if err != nil {
+		return LoginStatus{}, err
+	}
+	byIP, err := loadAttempts(ipKey(ip), now)
+	if err != nil {
+		return LoginStatus{}, err
+	}
+	return LoginStatus{
+		RetryAfter:      max(user.retryAfter(now), byIP.retryAfter(now)),
+		CaptchaRequired: CaptchaEnabled() && max(user.Failures, byIP.Failures) >= config.Config.LoginCaptchaAfter,
+	}, nil
+}
+
+// RecordLoginFailure counts a failed login for the username and IP and
+// locks them out once they reach their limit. event is the audit event
+// type of the failure.
+func RecordLoginFailure(username, ip, event string) (LoginStatus, error) {
+	loginMu.Lock()
+	now := time.Now()
+	var status LoginStatus
+	limits := map[string]int{
+		usernameKey(username): config.Config.LoginMaxFailures,
+		ipKey(ip):             config.Config.LoginMaxIPFailures,
+	}
+	for key, limit := range limits {
+		attempts, err := loadAttempts(key, now)
+		if err != nil {
+			loginMu.Unlock()
+			return LoginStatus{}, err
+		}
+		attempts.Failures++
+		attempts.LastFailure = now
+		if attempts.Failures >= limit {
+			lockout := lockoutDuration(attempts.Failures - limit)
+			until := now.Add(lockout)
+			attempts.LockedUntil = &until
+			status.RetryAfter = max(status.RetryAfter, lockout)
+			audit.Record(models.AuditEvent{
+				Type:     models.AuditLoginLocked,
+				Username: username,
+				IP:       ip,
+				Detail:   fmt.Sprintf("%s locked out for %s after %d failures", key, lockout, attempts.Failures),
+			})
+		}
+		if CaptchaEnabled() && attempts.Failures >= config.Config.LoginCaptchaAfter {
+			status.CaptchaRequired = true
+		}
+		if err := storage.GetStore().Put(loginAttemptsBucket, key, attempts); err != nil {
+			loginMu.Unlock()
+			return LoginStatus{}, err
+		}
+	}
+	loginMu.Unlock()
+
+	audit.Record(models.AuditEvent{Type: event, Username: username, IP: ip})
+	return status, nil
+}
+
+// RecordLoginSuccess clears the failures of the username. Those of the IP
+// are kept, or one valid account would let an attacker keep guessing the
+// passwords of others from the same address.
+func RecordLoginSuccess(username, userID, ip string) error {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+
+	key := usernameKey(username)
+	attempts, err := loadAttempts(key, time.Now())
+	if err != nil || attempts.Failures == 0 {
+		return err
+	}
+	audit.Record(models.AuditEvent{
+		Type:     models.AuditLoginAfterFailure,
+		Username: username,
+		UserID:   userID,
+		IP:       ip,
+		Detail:   fmt.Sprintf("after %d failed attempts", attempts.Failures),
+	})
+	return storage.GetStore().Delete(loginAttemptsBucket, key)
+}
+
+// ResetLoginFailures clears the failures and lockouts of the username and
+// IP; either may be empty
+func ResetLoginFailures(username, ip string) error {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+
+	if username != "" {
+		if err := storage.GetStore().Delete(loginAttemptsBucket, usernameKey(username)); err != nil {
+			return err
+		}
+	}
+	if ip != "" {
+		if err := storage.GetStore().Delete(loginAttemptsBucket, ipKey(ip)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FailedLogins returns the usernames and IPs with recent failures, most
+// failures first
+func FailedLogins() ([]LoginAttempts, error) {
+	now := time.Now()
+	list := []LoginAttempts{}
+	err := eachLoginAttempts(func(attempts *LoginAttempts) {
+		if !expired(attempts, now) {
+			list = append(list, *attempts)
+		}
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Failures > list[j].Failures
+	})
+	return list, err
+}
+
+// lockoutDuration doubles the lockout with every failure past the limit
+func lockoutDuration(extra int) time.Duration {
+	lockout := config.Config.LoginLockout
+	for i := 0; i < extra && lockout < config.Config.LoginMaxLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, config.Config.LoginMaxLockout)
+}
+
+// expired reports whether the failures are old enough to be forgotten
+func expired(attempts *LoginAttempts, now time.Time) bool {
+	return attempts.retryAfter(now) == 0 && now.Sub(attempts.LastFailure) > config.Config.LoginFailureWindow
+}
+
+func loadAttempts(key string, now time.Time) (*LoginAttempts, error) {
+	var attempts LoginAttempts
+	found, err := storage.GetStore().Get(loginAttemptsBucket, key, &attempts)
+	if err != nil {
+		return nil, err
+	}
+	if !found || expired(&attempts, now) {
+		return &LoginAttempts{Key: key}, nil
+	}
+	return &attempts, nil
+}
+
+func eachLoginAttempts(fn func(attempts *LoginAttempts)) error {
+	return storage.GetStore().ForEach(loginAttemptsBucket, "", func(key string, data []byte) error {
+		var attempts LoginAttempts
+		if err := json.Unmarshal(data, &attempts); err != nil {
+			log.Printf("Error decoding login attempts %s: %v", key, err)
+			return nil
+		}
+		fn(&attempts)
+		return nil
+	})
+}
+
+func pruneLoginAttempts(now time.Time) (int, error) {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+
+	var keys []string
+	err := eachLoginAttempts(func(attempts *LoginAttempts) {
+		if expired(attempts, now) {
+			keys = append(keys, attempts.Key)
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		if err := storage.GetStore().Delete(loginAttemptsBucket, key); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"testing"
+	"time"
+	"web-scraper/internal/config"
+	"web-scraper/internal/models"
+	"web-scraper/internal/storage"
+)
+
+// setLoginLimits applies the login limits for the duration of the test
+func setLoginLimits(t *testing.T) {
+	saved := config.Config
+	t.Cleanup(func() { config.Config = saved })
+	config.Config.LoginMaxFailures = 3
+	config.Config.LoginMaxIPFailures = 5
+	config.Config.LoginLockout = time.Minute
+	config.Config.LoginMaxLockout = 4 * time.Minute
+	config.Config.LoginFailureWindow = time.Hour
+}
+
+func TestLockoutDuration(t *testing.T) {
+	setLoginLimits(t)
+	tests := []struct {
+		extra int
+		want  time.Duration
+	}{
+		{0, time.Minute},
+		{1, 2 * time.Minute},
+		{2, 4 * time.Minute},
+		{3, 4 * time.Minute},
+		{50, 4 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := lockoutDuration(tt.extra); got != tt.want {
+			t.Errorf("lockoutDuration(%d) = %s, want %s", tt.extra, got, tt.want)
+		}
+	}
+}
+
+// Each failure from the limit on locks the username out for longer
+func TestLoginBackoff(t *testing.T) {
+	setLoginLimits(t)
+	username, ip := "backoff-"+storage.NewID(), "ip-"+storage.NewID()
+
+	tests := []struct {
+		failure int
+		want    time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 4 * time.Minute},
+	}
+	for _, tt := range tests {
+		status, err := RecordLoginFailure(username, ip, models.AuditLoginFailed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The IP reaches its own limit at the fifth failure
+		want := tt.want
+		if tt.failure >= config.Config.LoginMaxIPFailures {
+			want = max(want, lockoutDuration(tt.failure-config.Config.LoginMaxIPFailures))
+		}
+		if status.RetryAfter != want {
+			t.Errorf("failure %d locked out for %s, want %s", tt.failure, status.RetryAfter, want)
+		}
+
+		check, err := CheckLogin(username, "198.51.100.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if check.Locked() != (tt.want > 0) {
+			t.Errorf("after failure %d the username is locked %v, want %v", tt.failure, check.Locked(), tt.want > 0)
+		}
+	}
+}
+
+// A login clears the failures of the username but not those of the IP
+func TestLoginSuccessKeepsIPFailures(t *testing.T) {
+	setLoginLimits(t)
+	ip := "ip-" + storage.NewID()
+
+	for i := 0; i < config.Config.LoginMaxIPFailures; i++ {
+		if _, err := RecordLoginFailure("guess-"+storage.NewID(), ip, models.AuditLoginFailed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	username := "valid-" + storage.NewID()
+	if err := RecordLoginSuccess(username, "", ip); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		username   string
+		ip         string
+		wantLocked bool
+	}{
+		{"same IP", username, ip, true},
+		{"other IP", username, "198.51.100.1", false},
+	}
+	for _, tt := range tests {
+		status, err := CheckLogin(tt.username, tt.ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Locked() != tt.wantLocked {
+			t.Errorf("%s: locked %v, want %v", tt.name, status.Locked(), tt.wantLocked)
+		}
+	}
+}
+
+// Failures older than the window are forgotten once the lockout is over
+func TestLoginFailuresExpire(t *testing.T) {
+	setLoginLimits(t)
+	now := time.Now()
+	over := now.Add(-time.Minute)
+	locked := now.Add(time.Minute)
+
+	tests := []struct {
+		name         string
+		attempts     LoginAttempts
+		wantFailures int
+	}{
+		{"recent", LoginAttempts{Failures: 2, LastFailure: now.Add(-time.Minute)}, 3},
+		{"outside the window", LoginAttempts{Failures: 2, LastFailure: now.Add(-2 * time.Hour)}, 1},
+		{"lockout over", LoginAttempts{Failures: 9, LastFailure: now.Add(-2 * time.Hour), LockedUntil: &over}, 1},
+		{"still locked", LoginAttempts{Failures: 9, LastFailure: now.Add(-2 * time.Hour), LockedUntil: &locked}, 10},
+	}
+	for _, tt := range tests {
+		username := "expire-" + storage.NewID()
+		tt.attempts.Key = usernameKey(username)
+		if err := storage.GetStore().Put(loginAttemptsBucket, tt.attempts.Key, tt.attempts); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := RecordLoginFailure(username, "ip-"+storage.NewID(), models.AuditLoginFailed); err != nil {
+			t.Fatal(err)
+		}
+		attempts, err := loadAttempts(tt.attempts.Key, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if attempts.Failures != tt.wantFailures {
+			t.Errorf("%s: %d failures, want %d", tt.name, attempts.Failures, tt.wantFailures)
+		}
+	}
+}
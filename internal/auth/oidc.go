@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"web-scraper/internal/config"
+	"web-scraper/internal/storage"
+)
+
+const oidcStatesBucket = "oidc_states"
+
+// OIDCStateTTL is the time a sign-on has to finish after starting
+const OIDCStateTTL = 10 * time.Minute
+
+// OIDCIdentity is the identity asserted by the provider's ID token
+type OIDCIdentity struct {
+	// Subject is "issuer|sub", so identities of different providers never
+	// collide
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	Name          string
+}
+
+// oidcState is the server-side half of a sign-on in progress, stored under
+// the hash of the state parameter
+type oidcState struct {
+	Verifier  string    `json:"verifier"`
+	Nonce     string    `json:"nonce"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+var (
+	oidcMu       sync.Mutex
+	oidcProvider *oidc.Provider
+	oidcClient   = &http.Client{Timeout: 10 * time.Second}
+)
+
+// OIDCEnabled reports whether single sign-on is configured
+func OIDCEnabled() bool {
+	return config.Config.OIDCIssuerURL != ""
+}
+
+// oidcConfig discovers the provider on first use. A failed discovery is
+// retried on the next sign-on rather than keeping the server from starting.
+func oidcConfig() (*oidc.Provider, *oauth2.Config, error) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+
+	if oidcProvider == nil {
+		ctx := oidc.ClientContext(context.Background(), oidcClient)
+		provider, err := oidc.NewProvider(ctx, config.Config.OIDCIssuerURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error discovering OIDC provider: %v", err)
+		}
+		oidcProvider = provider
+	}
+
+	redirectURL := config.Config.OIDCRedirectURL
+	if redirectURL == "" {
+		redirectURL = strings.TrimSuffix(config.Config.PublicURL, "/") + "/api/auth/oidc/callback"
+	}
+	return oidcProvider, &oauth2.Config{
+		ClientID:     config.Config.OIDCClientID,
+		ClientSecret: config.Config.OIDCClientSecret,
+		Endpoint:     oidcProvider.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       strings.Fields(config.Config.OIDCScopes),
+	}, nil
+}
+
+// OIDCAuthURL starts a sign-on and returns the provider URL to send the
+// user to, and the state the callback will carry. The nonce and PKCE
+// verifier are kept until the callback.
+func OIDCAuthURL() (authURL, state string, err error) {
+	_, oauthConfig, err := oidcConfig()
+	if err != nil {
+		return "", "", err
+	}
+
+	state = RandomToken()
+	record := oidcState{
+		Verifier:  oauth2.GenerateVerifier(),
+		Nonce:     RandomToken(),
+		ExpiresAt: time.Now().Add(OIDCStateTTL),
+	}
+	if err := storage.GetStore().Put(oidcStatesBucket, hashToken(state), record); err != nil {
+		return "", "", err
+	}
+	return oauthConfig.AuthCodeURL(state, oidc.Nonce(record.Nonce), oauth2.S256ChallengeOption(record.Verifier)), state, nil
+}
+
+// OIDCExchange finishes a sign-on: it checks the state, redeems the code
+// with the PKCE verifier and verifies the ID token. Unknown or reused
+// states and invalid ID tokens return ErrInvalidToken.
+func OIDCExchange(ctx context.Context, state, code string) (*OIDCIdentity, error) {
+	provider, oauthConfig, err := oidcConfig()
+	if err != nil {
+		return nil, err
+	}
+	record, err := consumeOIDCState(state)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = oidc.ClientContext(ctx, oidcClient)
+	token, err := oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(record.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("error redeeming authorization code: %v", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: config.Config.OIDCClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		log.Printf("Invalid ID token: %v", err)
+		return nil, ErrInvalidToken
+	}
+	if idToken.Nonce != record.Nonce {
+		log.Printf("ID token nonce mismatch for subject %s", idToken.Subject)
+		return nil, ErrInvalidToken
+	}
+
+	var claims struct {
+		Email string `json:"email"`
+		// Some providers send the flag as a string
+		EmailVerified     interface{} `json:"email_verified"`
+		PreferredUsername string      `json:"preferred_username"`
+		Name              string      `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("error decoding ID token claims: %v", err)
+	}
+	return &OIDCIdentity{
+		Subject:       idToken.Issuer + "|" + idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified == true || claims.EmailVerified == "true",
+		Username:      claims.PreferredUsername,
+		Name:          claims.Name,
+	}, nil
+}
+
+// consumeOIDCState returns the sign-on started with the state and deletes
+// it, so a callback works once
+func consumeOIDCState(state string) (*oidcState, error) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+
+	key := hashToken(state)
+	var record oidcState
+	found, err := storage.GetStore().Get(oidcStatesBucket, key, &record)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrInvalidToken
+	}
+	if err := storage.GetStore().Delete(oidcStatesBucket, key); err != nil {
+		return nil, err
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+	return &record, nil
+}
+
+func pruneOIDCStates(now time.Time) (int, error) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+
+	var expired []string
+	err := storage.GetStore().ForEach(oidcStatesBucket, "", func(key string, data []byte) error {
+		var record oidcState
+		if err := json.Unmarshal(data, &record); err != nil || record.ExpiresAt.Before(now) {
+			expired = append(expired, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range expired {
+		if err := storage.GetStore().Delete(oidcStatesBucket, key); err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v4"
+	"log"
+	"sync"
+	"time"
+	"web-scraper/internal/config"
+	"web-scraper/internal/database"
+	"web-scraper/internal/models"
+	"web-scraper/internal/storage"
+)
+
+const refreshBucket = "refresh_tokens"
+
+// refreshToken is the server-side record of a refresh token, stored under
+// the hash of the token. All tokens rotated from one login share the
+// SessionID.
+type refreshToken struct {
+	UserID    string     `json:"user_id"`
+	SessionID string     `json:"session_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	Revoked   bool       `json:"revoked"`
+	// The access token issued together with this refresh token
+	AccessJTI     string    `json:"access_jti"`
+	AccessExpires time.Time `json:"access_expires"`
+}
+
+// mu serializes rotation so a refresh token is used at most once
+var mu sync.Mutex
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// RandomToken returns a random URL-safe token
+func RandomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// IssueTokens starts a new session for the user
+func IssueTokens(user models.User) (TokenPair, error) {
+	return issue(user, storage.NewID())
+}
+
+func issue(user models.User, sid string) (TokenPair, error) {
+	access, jti, accessExpires, err := issueAccessToken(user, sid)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	raw := RandomToken()
+	now := time.Now()
+	record := refreshToken{
+		UserID:        user.UserID,
+		SessionID:     sid,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(config.Config.RefreshTokenTTL),
+		AccessJTI:     jti,
+		AccessExpires: accessExpires,
+	}
+	if err := storage.GetStore().Put(refreshBucket, hashToken(raw), record); err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken:  access,
+		RefreshToken: raw,
+		ExpiresIn:    int(config.Config.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair in the same
+// session. Each refresh token works once: presenting a rotated token again
+// means it was stolen, so the whole session is revoked.
+func Refresh(raw string) (TokenPair, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	key := hashToken(raw)
+	var record refreshToken
+	found, err := storage.GetStore().Get(refreshBucket, key, &record)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if !found || record.Revoked || time.Now().After(record.ExpiresAt) {
+		return TokenPair{}, ErrInvalidToken
+	}
+	if record.RotatedAt != nil {
+		log.Printf("Refresh token reuse in session %s of user %s, revoking the session", record.SessionID, record.UserID)
+		if err := revokeSessions(func(r *refreshToken) bool { return r.SessionID == record.SessionID }); err != nil {
+			return TokenPair{}, err
+		}
+		return TokenPair{}, ErrTokenReuse
+	}
+
+	// Deleted users cannot renew their tokens
+	users, err := database.GetUsers()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	user, err := users.FindByID(record.UserID)
+	if err == database.ErrUserNotFound {
+		return TokenPair{}, ErrInvalidToken
+	}
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	now := time.Now()
+	record.RotatedAt = &now
+	if err := storage.GetStore().Put(refreshBucket, key, record); err != nil {
+		return TokenPair{}, err
+	}
+	return issue(*user, record.SessionID)
+}
+
+// Logout revokes the access token with the given claims and the session it
+// belongs to
+func Logout(claims jwt.MapClaims) error {
+	jti, _ := claims["jti"].(string)
+	if err := revokeAccessToken(jti, claimExpiry(claims)); err != nil {
+		return err
+	}
+
+	sid, _ := claims["sid"].(string)
+	if sid == "" {
+		return nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return revokeSessions(func(r *refreshToken) bool { return r.SessionID == sid })
+}
+
+// RevokeUser revokes every session of the user
+func RevokeUser(userID string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	return revokeSessions(func(r *refreshToken) bool { return r.UserID == userID })
+}
+
+// revokeSessions revokes the matching refresh tokens and the access tokens
+// issued with them
+func revokeSessions(match func(r *refreshToken) bool) error {
+	store := storage.GetStore()
+	revoked := map[string]refreshToken{}
+	err := store.ForEach(refreshBucket, "", func(key string, data []byte) error {
+		var record refreshToken
+		if err := json.Unmarshal(data, &record); err != nil {
+			log.Printf("Error decoding refresh token %s: %v", key, err)
+			return nil
+		}
+		if match(&record) {
+			revoked[key] = record
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, record := range revoked {
+		if err := revokeAccessToken(record.AccessJTI, record.AccessExpires); err != nil {
+			return err
+		}
+		if record.Revoked {
+			continue
+		}
+		record.Revoked = true
+		if err := store.Put(refreshBucket, key, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pruneRefreshTokens(now time.Time) (int, error) {
+	store := storage.GetStore()
+	var expired []string
+	err := store.ForEach(refreshBucket, "", func(key string, data []byte) error {
+		var record refreshToken
+		if err := json.Unmarshal(data, &record); err != nil || record.ExpiresAt.Before(now) {
+			expired = append(expired, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, key := range expired {
+		if err := store.Delete(refreshBucket, key); err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"testing"
+	"time"
+	"web-scraper/internal/config"
+	"web-scraper/internal/database"
+	"web-scraper/internal/models"
+)
+
+func TestRefresh(t *testing.T) {
+	tests := []struct {
+		name string
+		// token returns the refresh token to present
+		token func(t *testing.T) string
+		want  error
+	}{
+		{
+			name: "fresh token",
+			token: func(t *testing.T) string {
+				return issueFor(t, newUser(t)).RefreshToken
+			},
+		},
+		{
+			name: "rotated token",
+			token: func(t *testing.T) string {
+				raw := issueFor(t, newUser(t)).RefreshToken
+				if _, err := Refresh(raw); err != nil {
+					t.Fatal(err)
+				}
+				return raw
+			},
+			want: ErrTokenReuse,
+		},
+		{
+			name:  "unknown token",
+			token: func(t *testing.T) string { return RandomToken() },
+			want:  ErrInvalidToken,
+		},
+		{
+			name: "expired token",
+			token: func(t *testing.T) string {
+				ttl := config.Config.RefreshTokenTTL
+				config.Config.RefreshTokenTTL = -time.Second
+				defer func() { config.Config.RefreshTokenTTL = ttl }()
+				return issueFor(t, newUser(t)).RefreshToken
+			},
+			want: ErrInvalidToken,
+		},
+		{
+			name: "revoked user",
+			token: func(t *testing.T) string {
+				user := newUser(t)
+				raw := issueFor(t, user).RefreshToken
+				if err := RevokeUser(user.UserID); err != nil {
+					t.Fatal(err)
+				}
+				return raw
+			},
+			want: ErrInvalidToken,
+		},
+		{
+			name: "deleted user",
+			token: func(t *testing.T) string {
+				user := newUser(t)
+				raw := issueFor(t, user).RefreshToken
+				users, err := database.GetUsers()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := users.Delete(user.UserID); err != nil {
+					t.Fatal(err)
+				}
+				return raw
+			},
+			want: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := tt.token(t)
+			pair, err := Refresh(raw)
+			if err != tt.want {
+				t.Fatalf("Refresh returned %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			if pair.RefreshToken == "" || pair.RefreshToken == raw {
+				t.Errorf("refresh token was not rotated")
+			}
+			if _, err := ParseAccessToken(pair.AccessToken); err != nil {
+				t.Errorf("new access token is invalid: %v", err)
+			}
+		})
+	}
+}
+
+// Presenting a rotated token revokes every token of its session, and only
+// of its session
+func TestRefreshReuseRevokesSession(t *testing.T) {
+	user := newUser(t)
+	first := issueFor(t, user)
+	second, err := Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := issueFor(t, user)
+
+	if _, err := Refresh(first.RefreshToken); err != ErrTokenReuse {
+		t.Fatalf("reused token returned %v, want %v", err, ErrTokenReuse)
+	}
+
+	tests := []struct {
+		name  string
+		check func() error
+		want  error
+	}{
+		{"latest refresh token", func() error { _, err := Refresh(second.RefreshToken); return err }, ErrInvalidToken},
+		{"first access token", func() error { _, err := ParseAccessToken(first.AccessToken); return err }, ErrInvalidToken},
+		{"latest access token", func() error { _, err := ParseAccessToken(second.AccessToken); return err }, ErrInvalidToken},
+		{"other session access token", func() error { _, err := ParseAccessToken(other.AccessToken); return err }, nil},
+		{"other session refresh token", func() error { _, err := Refresh(other.RefreshToken); return err }, nil},
+	}
+	for _, tt := range tests {
+		if err := tt.check(); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	pair := issueFor(t, newUser(t))
+	claims, err := ParseAccessToken(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Logout(claims); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseAccessToken(pair.AccessToken); err != ErrInvalidToken {
+		t.Errorf("access token after logout returned %v, want %v", err, ErrInvalidToken)
+	}
+	if _, err := Refresh(pair.RefreshToken); err != ErrInvalidToken {
+		t.Errorf("refresh token after logout returned %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func issueFor(t *testing.T, user models.User) TokenPair {
+	t.Helper()
+	pair, err := IssueTokens(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pair
+}
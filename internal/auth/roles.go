@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"strings"
+	"web-scraper/internal/config"
+	"web-scraper/internal/models"
+)
+
+// User roles. Readonly users can read their stored data but not run
+// searches or change anything; service is for accounts used by other
+// services and for API keys.
+const (
+	RoleAdmin    = "admin"
+	RoleUser     = "user"
+	RoleReadonly = "readonly"
+	RoleService  = "service"
+)
+
+var Roles = []string{RoleAdmin, RoleUser, RoleReadonly, RoleService}
+
+func ValidRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleOf returns the effective role of the user. Users listed in
+// ADMIN_USERS by user ID are always admins, so a fresh install has a way in.
+// Usernames and emails are not matched: anyone could sign up with a listed
+// name first, and accounts created before verification count as verified
+// without having checked their email. Users created before roles existed are
+// plain users.
+func RoleOf(user models.User) string {
+	for _, entry := range strings.Split(config.Config.AdminUsers, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" && entry == user.UserID {
+			return RoleAdmin
+		}
+	}
+	if user.Role == "" {
+		return RoleUser
+	}
+	return user.Role
+}
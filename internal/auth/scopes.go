@@ -0,0 +1,57 @@
+package auth
+
+import "strings"
+
+// API key scopes
+const (
+	ScopeSearch      = "search"
+	ScopeJobs        = "jobs"
+	ScopeCrawls      = "crawls"
+	ScopeMonitors    = "monitors"
+	ScopeCollections = "collections"
+	ScopeHistory     = "history"
+)
+
+var Scopes = []string{ScopeSearch, ScopeJobs, ScopeCrawls, ScopeMonitors, ScopeCollections, ScopeHistory}
+
+// scopePrefixes map routes to the scope an API key needs for them. Routes
+// not listed, such as key management, logout, email and admin routes, are
+// only open to logged-in users, so a leaked key cannot mint more keys or end
+// sessions, and new routes stay closed to keys until they are listed.
+var scopePrefixes = []struct {
+	prefix string
+	scope  string
+}{
+	{"/api/scraper", ScopeSearch},
+	{"/api/scraper-deep", ScopeSearch},
+	{"/api/scrape", ScopeSearch},
+	{"/api/sessions", ScopeSearch},
+	{"/api/research", ScopeSearch},
+	{"/api/ask", ScopeSearch},
+	{"/api/index", ScopeSearch},
+	{"/api/jobs", ScopeJobs},
+	{"/api/crawls", ScopeCrawls},
+	{"/api/monitors", ScopeMonitors},
+	{"/api/collections", ScopeCollections},
+	{"/api/history", ScopeHistory},
+}
+
+// ScopeForPath returns the scope an API key needs to call the route at
+// path, or "" when keys may not call it
+func ScopeForPath(path string) string {
+	for _, p := range scopePrefixes {
+		if path == p.prefix || strings.HasPrefix(path, p.prefix+"/") {
+			return p.scope
+		}
+	}
+	return ""
+}
+
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
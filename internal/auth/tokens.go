@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"log"
+	"os"
+	"time"
+	"web-scraper/internal/config"
+	"web-scraper/internal/models"
+	"web-scraper/internal/storage"
+)
+
+const revokedBucket = "revoked_tokens"
+
+var (
+	// ErrInvalidToken is returned for tokens that are malformed, expired,
+	// revoked or unknown
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenReuse is returned when a refresh token that was already
+	// rotated is presented again; the whole session is revoked
+	ErrTokenReuse = errors.New("refresh token reuse detected")
+)
+
+// TokenPair is a short-lived access token with the refresh token that
+// renews it
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	// ExpiresIn is the lifetime of the access token in seconds
+	ExpiresIn int
+}
+
+func secret() []byte {
+	return []byte(os.Getenv("JWT_SECRET"))
+}
+
+// issueAccessToken signs an access token for the user in the session sid.
+// It returns the token with its jti and expiry.
+func issueAccessToken(user models.User, sid string) (string, string, time.Time, error) {
+	jti := storage.NewID()
+	expires := time.Now().Add(config.Config.AccessTokenTTL)
+	claims := jwt.MapClaims{
+		"user_id":        user.UserID,
+		"username":       user.Username,
+		"email":          user.Email,
+		"role":           RoleOf(user),
+		"email_verified": user.EmailVerified,
+		"jti":            jti,
+		"sid":            sid,
+		"exp":            expires.Unix(),
+		"iat":            time.Now().Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(secret())
+	return signed, jti, expires, err
+}
+
+// ParseAccessToken verifies an access token and checks that it has not
+// been revoked
+func ParseAccessToken(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return secret(), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	// Tokens issued before revocation support carry no jti and simply
+	// expire
+	if jti, _ := claims["jti"].(string); jti != "" {
+		revoked, err := isRevoked(jti)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrInvalidToken
+		}
+	}
+	return claims, nil
+}
+
+// revokeAccessToken adds a jti to the revocation list until the token
+// would have expired anyway
+func revokeAccessToken(jti string, expires time.Time) error {
+	if jti == "" || time.Now().After(expires) {
+		return nil
+	}
+	return storage.GetStore().Put(revokedBucket, jti, expires)
+}
+
+func isRevoked(jti string) (bool, error) {
+	var expires time.Time
+	return storage.GetStore().Get(revokedBucket, jti, &expires)
+}
+
+// claimExpiry returns the exp claim of an access token
+func claimExpiry(claims jwt.MapClaims) time.Time {
+	exp, _ := claims["exp"].(float64)
+	return time.Unix(int64(exp), 0)
+}
+
+// Prune drops expired refresh and user tokens, revocation entries of
+// access tokens that have expired, forgotten login failures and abandoned
+// sign-ons
+func Prune() (int, error) {
+	now := time.Now()
+	store := storage.GetStore()
+
+	var revoked []string
+	err := store.ForEach(revokedBucket, "", func(key string, data []byte) error {
+		var expires time.Time
+		if err := expires.UnmarshalJSON(data); err != nil || expires.Before(now) {
+			revoked = append(revoked, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, jti := range revoked {
+		if err := store.Delete(revokedBucket, jti); err != nil {
+			return 0, err
+		}
+	}
+
+	expired, err := pruneRefreshTokens(now)
+	if err != nil {
+		return 0, err
+	}
+	unused, err := pruneUserTokens(now)
+	if err != nil {
+		return 0, err
+	}
+	forgotten, err := pruneLoginAttempts(now)
+	if err != nil {
+		return 0, err
+	}
+	abandoned, err := pruneOIDCStates(now)
+	return len(revoked) + expired + unused + forgotten + abandoned, err
+}
+
+// StartPruning prunes expired tokens now and then every interval
+func StartPruning(interval time.Duration) {
+	go func() {
+		for {
+			removed, err := Prune()
+			if err != nil {
+				log.Printf("Error pruning tokens: %v", err)
+			} else if removed > 0 {
+				log.Printf("Pruned %d expired tokens", removed)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
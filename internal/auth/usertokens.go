@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+	"web-scraper/internal/storage"
+)
+
+const userTokensBucket = "user_tokens"
+
+// Purposes of single-use user tokens
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+)
+
+// UserToken is a single-use token mailed to a user, stored under its hash
+type UserToken struct {
+	Purpose   string    `json:"purpose"`
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// IssueUserToken creates a token for the purpose and returns it. Earlier
+// tokens of the user for the same purpose stop working.
+func IssueUserToken(purpose, userID, email string, ttl time.Duration) (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := deleteUserTokens(purpose, userID); err != nil {
+		return "", err
+	}
+	raw := RandomToken()
+	now := time.Now()
+	record := UserToken{
+		Purpose:   purpose,
+		UserID:    userID,
+		Email:     email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := storage.GetStore().Put(userTokensBucket, hashToken(raw), record); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// ConsumeUserToken checks a token for the purpose and deletes it, so it
+// works only once
+func ConsumeUserToken(purpose, raw string) (*UserToken, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	key := hashToken(raw)
+	var record UserToken
+	found, err := storage.GetStore().Get(userTokensBucket, key, &record)
+	if err != nil {
+		return nil, err
+	}
+	if !found || record.Purpose != purpose {
+		return nil, ErrInvalidToken
+	}
+	if err := storage.GetStore().Delete(userTokensBucket, key); err != nil {
+		return nil, err
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+	return &record, nil
+}
+
+func deleteUserTokens(purpose, userID string) error {
+	return deleteUserTokensWhere(func(record *UserToken) bool {
+		return record.Purpose == purpose && record.UserID == userID
+	})
+}
+
+func pruneUserTokens(now time.Time) (int, error) {
+	removed := 0
+	err := deleteUserTokensWhere(func(record *UserToken) bool {
+		if record.ExpiresAt.Before(now) {
+			removed++
+			return true
+		}
+		return false
+	})
+	return removed, err
+}
+
+func deleteUserTokensWhere(match func(record *UserToken) bool) error {
+	store := storage.GetStore()
+	var keys []string
+	err := store.ForEach(userTokensBucket, "", func(key string, data []byte) error {
+		var record UserToken
+		if err := json.Unmarshal(data, &record); err != nil {
+			log.Printf("Error decoding user token %s: %v", key, err)
+			keys = append(keys, key)
+			return nil
+		}
+		if match(&record) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := store.Delete(userTokensBucket, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package collections
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+	"web-scraper/internal/models"
+	"web-scraper/internal/search"
+	"web-scraper/internal/storage"
+)
+
+const (
+	collectionsBucket = "collections"
+	itemsBucket       = "collection_items"
+)
+
+// ErrDuplicate is returned by AddItem when the page is already saved in the
+// collection
+var ErrDuplicate = errors.New("page is already in the collection")
+
+// mu serializes updates of a collection and its item count
+var mu sync.Mutex
+
+func Create(collection *models.Collection) error {
+	now := time.Now()
+	collection.ID = storage.NewID()
+	collection.ItemCount = 0
+	collection.CreatedAt = now
+	collection.UpdatedAt = now
+	return storage.GetStore().Put(collectionsBucket, collection.ID, collection)
+}
+
+// Get returns the collection if it exists and belongs to the user
+func Get(id, userID string) (*models.Collection, bool, error) {
+	var collection models.Collection
+	found, err := storage.GetStore().Get(collectionsBucket, id, &collection)
+	if err != nil || !found || collection.UserID != userID {
+		return nil, false, err
+	}
+	return &collection, true, nil
+}
+
+// List returns the user's collections, newest first. A tag limits them to
+// collections carrying it.
+func List(userID, tag string) ([]models.Collection, error) {
+	collections := []models.Collection{}
+	err := storage.GetStore().ForEach(collectionsBucket, "", func(key string, data []byte) error {
+		var collection models.Collection
+		if err := json.Unmarshal(data, &collection); err != nil {
+			log.Printf("Error decoding collection %s: %v", key, err)
+			return nil
+		}
+		if collection.UserID == userID && (tag == "" || hasTag(collection.Tags, tag)) {
+			collections = append(collections, collection)
+		}
+		return nil
+	})
+	sort.Slice(collections, func(i, j int) bool {
+		return collections[i].CreatedAt.After(collections[j].CreatedAt)
+	})
+	return collections, err
+}
+
+// Update applies fn to the user's collection and saves it
+func Update(id, userID string, fn func(collection *models.Collection)) (*models.Collection, bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	collection, found, err := Get(id, userID)
+	if err != nil || !found {
+		return nil, found, err
+	}
+	fn(collection)
+	collection.UpdatedAt = time.Now()
+	return collection, true, storage.GetStore().Put(collectionsBucket, id, collection)
+}
+
+// Delete removes the user's collection and all its items
+func Delete(id, userID string) (bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	_, found, err := Get(id, userID)
+	if err != nil || !found {
+		return false, err
+	}
+
+	store := storage.GetStore()
+	var keys []string
+	err = store.ForEach(itemsBucket, id+"/", func(key string, data []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return true, err
+	}
+	for _, key := range keys {
+		if err := store.Delete(itemsBucket, key); err != nil {
+			return true, err
+		}
+	}
+	return true, store.Delete(collectionsBucket, id)
+}
+
+// itemKey orders the items of a collection by the time they were saved
+func itemKey(item *models.CollectionItem) string {
+	return fmt.Sprintf("%s/%020d/%s", item.CollectionID, item.SavedAt.UnixNano(), item.ID)
+}
+
+// Items returns the items of a collection in the order they were saved. A
+// tag limits them to items carrying it.
+func Items(collectionID, tag string) ([]models.CollectionItem, error) {
+	items := []models.CollectionItem{}
+	err := eachItem(collectionID, func(item *models.CollectionItem) error {
+		if tag == "" || hasTag(item.Tags, tag) {
+			items = append(items, *item)
+		}
+		return nil
+	})
+	return items, err
+}
+
+// AddItem saves a result in the collection unless its page is already
+// there
+func AddItem(collection *models.Collection, item *models.CollectionItem) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	normalized := search.NormalizeURL(item.Result.Link)
+	err := eachItem(collection.ID, func(existing *models.CollectionItem) error {
+		if search.NormalizeURL(existing.Result.Link) == normalized {
+			return ErrDuplicate
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	item.ID = storage.NewID()
+	item.CollectionID = collection.ID
+	item.SavedAt = now
+	item.UpdatedAt = now
+	if err := storage.GetStore().Put(itemsBucket, itemKey(item), item); err != nil {
+		return err
+	}
+	return touch(collection.ID, 1)
+}
+
+// UpdateItem applies fn to an item of the collection and saves it
+func UpdateItem(collectionID, itemID string, fn func(item *models.CollectionItem)) (*models.CollectionItem, bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	item, found, err := getItem(collectionID, itemID)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	fn(item)
+	item.UpdatedAt = time.Now()
+	if err := storage.GetStore().Put(itemsBucket, itemKey(item), item); err != nil {
+		return nil, true, err
+	}
+	return item, true, touch(collectionID, 0)
+}
+
+// DeleteItem removes an item from the collection
+func DeleteItem(collectionID, itemID string) (bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	item, found, err := getItem(collectionID, itemID)
+	if err != nil || !found {
+		return false, err
+	}
+	if err := storage.GetStore().Delete(itemsBucket, itemKey(item)); err != nil {
+		return true, err
+	}
+	return true, touch(collectionID, -1)
+}
+
+func getItem(collectionID, itemID string) (*models.CollectionItem, bool, error) {
+	var found *models.CollectionItem
+	err := eachItem(collectionID, func(item *models.CollectionItem) error {
+		if item.ID == itemID {
+			found = item
+			return storage.ErrStop
+		}
+		return nil
+	})
+	return found, found != nil, err
+}
+
+func eachItem(collectionID string, fn func(item *models.CollectionItem) error) error {
+	return storage.GetStore().ForEach(itemsBucket, collectionID+"/", func(key string, data []byte) error {
+		var item models.CollectionItem
+		if err := json.Unmarshal(data, &item); err != nil {
+			log.Printf("Error decoding collection item %s: %v", key, err)
+			return nil
+		}
+		return fn(&item)
+	})
+}
+
+// touch adjusts the item count of a collection and its update time
+func touch(id string, delta int) error {
+	store := storage.GetStore()
+	var collection models.Collection
+	found, err := store.Get(collectionsBucket, id, &collection)
+	if err != nil || !found {
+		return err
+	}
+	collection.ItemCount += delta
+	collection.UpdatedAt = time.Now()
+	return store.Put(collectionsBucket, id, &collection)
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/joho/godotenv"
 	"log"
 	"os"
+	"strconv"
 	"time"
 )
 
@@ -15,6 +16,203 @@ type Configuration struct {
 	MaxCacheBytes  int64
 	OpenAIKey      string
 	AnthropicAIKey string
+
+	// AI provider used for summarization ("openai" or "anthropic")
+	AIProvider     string
+	OpenAIModel    string
+	AnthropicModel string
+
+	// Context window per provider, in tokens. The prompt packer keeps the
+	// whole request (instructions + results + completion) under this limit.
+	ContextTokenLimits  map[string]int
+	MaxCompletionTokens int
+
+	// Map-reduce summarization: pages are summarized in parallel by the
+	// cheap model of the active provider before the final synthesis
+	CheapModels      map[string]string
+	MapConcurrency   int
+	MapPageTokens    int
+	MapSummaryTokens int
+
+	// Models used for structured JSON answers; they must support JSON
+	// schema response formats (OpenAI) or tool use (Anthropic)
+	StructuredModels   map[string]string
+	JSONRepairAttempts int
+
+	// Query rewriting: the question is expanded into up to MaxRewriteQueries
+	// search engine queries whose results are fused
+	MaxRewriteQueries int
+
+	// Semantic reranking: results are reordered by embedding similarity to
+	// the query, blended with the engine rank by RerankWeight (0..1).
+	// Results less similar than RerankThreshold are dropped.
+	EmbeddingProvider string
+	EmbeddingModel    string
+	EmbeddingBaseURL  string
+	EmbeddingAPIKey   string
+	RerankWeight      float64
+	RerankThreshold   float64
+
+	// Retrieval over scraped pages: deep search pages are embedded into the
+	// local vector store, and /api/ask answers from the AskTopK most similar
+	// chunks unless the best one is less similar than AskMinSimilarity
+	VectorIndexEnabled bool
+	AskTopK            int
+	AskMinSimilarity   float64
+
+	// Fetch policy applied to every outbound request. RobotsAgent is the
+	// product token looked up in robots.txt; the default UserAgent names it
+	// so sites can tell which rules apply. A Crawl-delay longer than
+	// HostMinInterval takes precedence. DeniedDomains is comma separated
+	// and also blocks subdomains. Fetches of loopback, private and other
+	// non-public addresses are refused unless AllowPrivateNetworks is set.
+	UserAgent            string
+	RobotsAgent          string
+	RespectRobots        bool
+	RobotsCacheTTL       time.Duration
+	HostMinInterval      time.Duration
+	HostMaxConcurrency   int
+	DeniedDomains        string
+	AllowPrivateNetworks bool
+
+	// Background jobs: a fixed pool of workers runs queued searches.
+	// Job callbacks and monitor alerts are webhooks, each signed with a
+	// secret of its own.
+	JobWorkers      int
+	JobQueueSize    int
+	JobTTL          time.Duration
+	WebhooksEnabled bool
+
+	// Site crawls: limits on what a single crawl may request
+	CrawlDefaultDepth int
+	CrawlMaxDepth     int
+	CrawlMaxPages     int
+	CrawlParallelism  int
+
+	// Monitors: saved searches run on a cron schedule. Schedules firing more
+	// often than MonitorMinInterval are rejected.
+	MonitorMinInterval time.Duration
+	MonitorMaxPerUser  int
+	MonitorConcurrency int
+	MonitorRunHistory  int
+
+	// Research agent: the model searches and reads pages in a tool loop
+	// until it can answer or a step, token or time limit is reached
+	ResearchModels      map[string]string
+	ResearchMaxSteps    int
+	ResearchTokenBudget int
+	ResearchPageTokens  int
+	ResearchTimeout     time.Duration
+
+	// Directory for the embedded database and other local state
+	DataDir string
+
+	// User accounts are kept in Supabase ("supabase") or in an embedded
+	// SQLite database ("sqlite") at SQLitePath, by default in DataDir. The
+	// SQLite schema is migrated on start; Supabase projects are migrated
+	// with the SQL in supabase/migrations.
+	UserStore  string
+	SQLitePath string
+
+	// Access tokens are short-lived; refresh tokens renew them and rotate
+	// on every use
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// API keys: requests per minute a key may make unless set at creation,
+	// and how many active keys a user may hold
+	APIKeyRateLimit  int
+	APIKeyMaxPerUser int
+
+	// Comma separated user IDs that always have the admin role
+	AdminUsers string
+
+	// Email is sent with Mailer: "smtp", or "log" to print it to stdout.
+	// Links in email point at PublicURL, or at PasswordResetURL for password
+	// resets when a front-end handles them.
+	Mailer           string
+	SMTPHost         string
+	SMTPPort         int
+	SMTPUsername     string
+	SMTPPassword     string
+	MailFrom         string
+	PublicURL        string
+	PasswordResetURL string
+
+	// Login throttling: after LoginMaxFailures failed logins for a username
+	// (LoginMaxIPFailures for an IP) further attempts are locked out for
+	// LoginLockout, doubling with every further failure up to
+	// LoginMaxLockout. Failures are forgotten after LoginFailureWindow
+	// without any. From LoginCaptchaAfter failures a CAPTCHA is required if
+	// CaptchaVerifyURL (a reCAPTCHA, hCaptcha or Turnstile siteverify
+	// endpoint) is set.
+	LoginMaxFailures   int
+	LoginMaxIPFailures int
+	LoginLockout       time.Duration
+	LoginMaxLockout    time.Duration
+	LoginFailureWindow time.Duration
+	LoginCaptchaAfter  int
+	CaptchaVerifyURL   string
+	CaptchaSecret      string
+
+	// Client addresses are read from ClientIPHeader only on connections from
+	// TrustedProxies (comma separated IPs or CIDRs); otherwise the
+	// connection's own address is used
+	TrustedProxies string
+	ClientIPHeader string
+
+	// Signups and password reset emails an IP may request per minute
+	AccountRateLimit int
+
+	// Security events such as failed logins are kept for AuditLogTTL
+	AuditLogTTL time.Duration
+
+	// Single sign-on with an OpenID Connect provider, enabled when
+	// OIDCIssuerURL is set. Unknown identities get an account when
+	// OIDCAutoProvision is set; OIDCAllowedDomains (comma separated) limits
+	// sign-on to those email domains. After sign-on the tokens are returned
+	// as JSON, or to OIDCSuccessURL in the URL fragment.
+	OIDCIssuerURL      string
+	OIDCClientID       string
+	OIDCClientSecret   string
+	OIDCRedirectURL    string
+	OIDCScopes         string
+	OIDCAutoProvision  bool
+	OIDCAllowedDomains string
+	OIDCSuccessURL     string
+
+	// Telegram bot, started with the server when TelegramBotToken is set.
+	// TelegramAPIURL can point at a local Bot API server or a fake one in
+	// tests. Only TelegramAllowedChats (comma separated chat IDs) may use the
+	// bot unless TelegramOpen is set; every chat gets its own account. Chats
+	// that are not listed count as unverified users.
+	TelegramBotToken     string
+	TelegramAPIURL       string
+	TelegramAllowedChats string
+	TelegramOpen         bool
+	TelegramPollTimeout  time.Duration
+	TelegramConcurrency  int
+
+	// Users who have not verified their email are limited to basic search
+	// when RequireEmailVerification is set. It is off by default while mail
+	// only goes to the log, where no user would receive it.
+	RequireEmailVerification bool
+	EmailVerificationTTL     time.Duration
+	PasswordResetTTL         time.Duration
+
+	// Search sessions keep results for follow-up questions
+	SessionTTL          time.Duration
+	SessionHistoryTurns int
+
+	// Per-user search history is kept for HistoryTTL
+	HistoryTTL time.Duration
+
+	// Saved results a single collection may hold
+	CollectionMaxItems int
+
+	// Directory of *.tmpl prompt templates overriding the built-in styles
+	PromptTemplatesDir string
+	DefaultPromptStyle string
 }
 
 var Config Configuration
@@ -26,6 +224,9 @@ func init() {
 		log.Printf("Error loading .env file: %v", err)
 	}
 
+	robotsAgent := getEnv("ROBOTS_AGENT", "WebScraperBot")
+	publicURL := getEnv("PUBLIC_URL", "http://localhost:8080")
+
 	Config = Configuration{
 		Port:           "8080",
 		RateLimit:      5,
@@ -34,5 +235,190 @@ func init() {
 		MaxCacheBytes:  50 * 1024 * 1024,
 		OpenAIKey:      os.Getenv("OPENAI_KEY"),
 		AnthropicAIKey: os.Getenv("ANTHROPIC_AI_KEY"),
+
+		AIProvider:     getEnv("AI_PROVIDER", "openai"),
+		OpenAIModel:    getEnv("OPENAI_MODEL", "gpt-3.5-turbo"),
+		AnthropicModel: getEnv("ANTHROPIC_MODEL", "claude-3-haiku-20240307"),
+
+		ContextTokenLimits: map[string]int{
+			"openai":    getEnvInt("OPENAI_CONTEXT_TOKENS", 16000),
+			"anthropic": getEnvInt("ANTHROPIC_CONTEXT_TOKENS", 32000),
+		},
+		MaxCompletionTokens: getEnvInt("MAX_COMPLETION_TOKENS", 2000),
+
+		CheapModels: map[string]string{
+			"openai":    getEnv("OPENAI_CHEAP_MODEL", "gpt-4o-mini"),
+			"anthropic": getEnv("ANTHROPIC_CHEAP_MODEL", "claude-3-haiku-20240307"),
+		},
+		MapConcurrency:   getEnvInt("MAP_CONCURRENCY", 4),
+		MapPageTokens:    getEnvInt("MAP_PAGE_TOKENS", 3000),
+		MapSummaryTokens: getEnvInt("MAP_SUMMARY_TOKENS", 300),
+
+		StructuredModels: map[string]string{
+			"openai":    getEnv("OPENAI_STRUCTURED_MODEL", "gpt-4o-mini"),
+			"anthropic": getEnv("ANTHROPIC_STRUCTURED_MODEL", "claude-3-haiku-20240307"),
+		},
+		JSONRepairAttempts: getEnvInt("JSON_REPAIR_ATTEMPTS", 1),
+
+		MaxRewriteQueries: getEnvInt("MAX_REWRITE_QUERIES", 3),
+
+		EmbeddingProvider: getEnv("EMBEDDING_PROVIDER", "openai"),
+		EmbeddingModel:    getEnv("EMBEDDING_MODEL", "text-embedding-3-small"),
+		EmbeddingBaseURL:  getEnv("EMBEDDING_BASE_URL", "http://localhost:11434/v1"),
+		EmbeddingAPIKey:   os.Getenv("EMBEDDING_API_KEY"),
+		RerankWeight:      getEnvFloat("RERANK_WEIGHT", 0.7),
+		RerankThreshold:   getEnvFloat("RERANK_THRESHOLD", 0.2),
+
+		VectorIndexEnabled: getEnvBool("VECTOR_INDEX_ENABLED", true),
+		AskTopK:            getEnvInt("ASK_TOP_K", 8),
+		AskMinSimilarity:   getEnvFloat("ASK_MIN_SIMILARITY", 0.45),
+
+		UserAgent:            getEnv("USER_AGENT", "Mozilla/5.0 (compatible; "+robotsAgent+"/1.0; +"+publicURL+")"),
+		RobotsAgent:          robotsAgent,
+		RespectRobots:        getEnvBool("RESPECT_ROBOTS", true),
+		RobotsCacheTTL:       time.Duration(getEnvInt("ROBOTS_CACHE_MINUTES", 60)) * time.Minute,
+		HostMinInterval:      time.Duration(getEnvInt("HOST_MIN_INTERVAL_MS", 500)) * time.Millisecond,
+		HostMaxConcurrency:   getEnvInt("HOST_MAX_CONCURRENCY", 2),
+		DeniedDomains:        os.Getenv("DENIED_DOMAINS"),
+		AllowPrivateNetworks: getEnvBool("ALLOW_PRIVATE_NETWORKS", false),
+
+		JobWorkers:   getEnvInt("JOB_WORKERS", 2),
+		JobQueueSize: getEnvInt("JOB_QUEUE_SIZE", 100),
+		JobTTL:       time.Duration(getEnvInt("JOB_TTL_HOURS", 168)) * time.Hour,
+		// Servers that set the former shared WEBHOOK_SECRET had webhooks on
+		WebhooksEnabled: getEnvBool("WEBHOOKS_ENABLED", os.Getenv("WEBHOOK_SECRET") != ""),
+
+		CrawlDefaultDepth: getEnvInt("CRAWL_DEFAULT_DEPTH", 2),
+		CrawlMaxDepth:     getEnvInt("CRAWL_MAX_DEPTH", 5),
+		CrawlMaxPages:     getEnvInt("CRAWL_MAX_PAGES", 200),
+		CrawlParallelism:  getEnvInt("CRAWL_PARALLELISM", 4),
+
+		MonitorMinInterval: time.Duration(getEnvInt("MONITOR_MIN_INTERVAL_MINUTES", 15)) * time.Minute,
+		MonitorMaxPerUser:  getEnvInt("MONITOR_MAX_PER_USER", 20),
+		MonitorConcurrency: getEnvInt("MONITOR_CONCURRENCY", 2),
+		MonitorRunHistory:  getEnvInt("MONITOR_RUN_HISTORY", 20),
+
+		ResearchModels: map[string]string{
+			"openai":    getEnv("OPENAI_RESEARCH_MODEL", "gpt-4o-mini"),
+			"anthropic": getEnv("ANTHROPIC_RESEARCH_MODEL", "claude-3-haiku-20240307"),
+		},
+		ResearchMaxSteps:    getEnvInt("RESEARCH_MAX_STEPS", 8),
+		ResearchTokenBudget: getEnvInt("RESEARCH_TOKEN_BUDGET", 60000),
+		ResearchPageTokens:  getEnvInt("RESEARCH_PAGE_TOKENS", 2000),
+		ResearchTimeout:     time.Duration(getEnvInt("RESEARCH_TIMEOUT_SECONDS", 180)) * time.Second,
+
+		DataDir: getEnv("DATA_DIR", "data"),
+
+		UserStore:  getEnv("USER_STORE", "supabase"),
+		SQLitePath: os.Getenv("SQLITE_PATH"),
+
+		AccessTokenTTL:  time.Duration(getEnvInt("ACCESS_TOKEN_MINUTES", 15)) * time.Minute,
+		RefreshTokenTTL: time.Duration(getEnvInt("REFRESH_TOKEN_DAYS", 30)) * 24 * time.Hour,
+
+		APIKeyRateLimit:  getEnvInt("API_KEY_RATE_LIMIT", 60),
+		APIKeyMaxPerUser: getEnvInt("API_KEY_MAX_PER_USER", 20),
+
+		AdminUsers: os.Getenv("ADMIN_USERS"),
+
+		Mailer:           getEnv("MAILER", "log"),
+		SMTPHost:         os.Getenv("SMTP_HOST"),
+		SMTPPort:         getEnvInt("SMTP_PORT", 587),
+		SMTPUsername:     os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:     os.Getenv("SMTP_PASSWORD"),
+		MailFrom:         getEnv("MAIL_FROM", "no-reply@localhost"),
+		PublicURL:        publicURL,
+		PasswordResetURL: os.Getenv("PASSWORD_RESET_URL"),
+
+		LoginMaxFailures:   getEnvInt("LOGIN_MAX_FAILURES", 5),
+		LoginMaxIPFailures: getEnvInt("LOGIN_MAX_IP_FAILURES", 20),
+		LoginLockout:       time.Duration(getEnvInt("LOGIN_LOCKOUT_SECONDS", 60)) * time.Second,
+		LoginMaxLockout:    time.Duration(getEnvInt("LOGIN_MAX_LOCKOUT_MINUTES", 60)) * time.Minute,
+		LoginFailureWindow: time.Duration(getEnvInt("LOGIN_FAILURE_WINDOW_MINUTES", 60)) * time.Minute,
+		LoginCaptchaAfter:  getEnvInt("LOGIN_CAPTCHA_AFTER", 3),
+		CaptchaVerifyURL:   os.Getenv("CAPTCHA_VERIFY_URL"),
+		CaptchaSecret:      os.Getenv("CAPTCHA_SECRET"),
+
+		TrustedProxies: os.Getenv("TRUSTED_PROXIES"),
+		ClientIPHeader: getEnv("CLIENT_IP_HEADER", "X-Forwarded-For"),
+
+		AccountRateLimit: getEnvInt("ACCOUNT_RATE_LIMIT", 5),
+
+		AuditLogTTL: time.Duration(getEnvInt("AUDIT_LOG_TTL_DAYS", 90)) * 24 * time.Hour,
+
+		OIDCIssuerURL:      os.Getenv("OIDC_ISSUER_URL"),
+		OIDCClientID:       os.Getenv("OIDC_CLIENT_ID"),
+		OIDCClientSecret:   os.Getenv("OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:    os.Getenv("OIDC_REDIRECT_URL"),
+		OIDCScopes:         getEnv("OIDC_SCOPES", "openid email profile"),
+		OIDCAutoProvision:  getEnvBool("OIDC_AUTO_PROVISION", true),
+		OIDCAllowedDomains: os.Getenv("OIDC_ALLOWED_DOMAINS"),
+		OIDCSuccessURL:     os.Getenv("OIDC_SUCCESS_URL"),
+
+		TelegramBotToken:     os.Getenv("TELEGRAM_BOT_TOKEN"),
+		TelegramAPIURL:       getEnv("TELEGRAM_API_URL", "https://api.telegram.org"),
+		TelegramAllowedChats: os.Getenv("TELEGRAM_ALLOWED_CHATS"),
+		TelegramOpen:         getEnvBool("TELEGRAM_OPEN", false),
+		TelegramPollTimeout:  time.Duration(getEnvInt("TELEGRAM_POLL_TIMEOUT_SECONDS", 30)) * time.Second,
+		TelegramConcurrency:  getEnvInt("TELEGRAM_CONCURRENCY", 4),
+
+		RequireEmailVerification: getEnvBool("REQUIRE_EMAIL_VERIFICATION", getEnv("MAILER", "log") != "log"),
+		EmailVerificationTTL:     time.Duration(getEnvInt("EMAIL_VERIFICATION_HOURS", 48)) * time.Hour,
+		PasswordResetTTL:         time.Duration(getEnvInt("PASSWORD_RESET_MINUTES", 30)) * time.Minute,
+
+		SessionTTL:          time.Duration(getEnvInt("SESSION_TTL_HOURS", 168)) * time.Hour,
+		SessionHistoryTurns: getEnvInt("SESSION_HISTORY_TURNS", 10),
+
+		HistoryTTL: time.Duration(getEnvInt("HISTORY_TTL_DAYS", 90)) * 24 * time.Hour,
+
+		CollectionMaxItems: getEnvInt("COLLECTION_MAX_ITEMS", 500),
+
+		PromptTemplatesDir: getEnv("PROMPT_TEMPLATES_DIR", "prompts"),
+		DefaultPromptStyle: getEnv("PROMPT_STYLE", "brief"),
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid value for %s: %v, using %d", key, err, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Invalid value for %s: %v, using %g", key, err, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid value for %s: %v, using %t", key, err, fallback)
+		return fallback
 	}
+	return parsed
 }
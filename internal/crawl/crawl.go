@@ -0,0 +1,206 @@
+package crawl
+
+import (
+	"fmt"
+	"github.com/gocolly/colly/v2"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+	"web-scraper/internal/config"
+	"web-scraper/internal/fetcher"
+	"web-scraper/internal/models"
+	"web-scraper/internal/search"
+	"web-scraper/internal/storage"
+)
+
+// Normalize validates the options and fills in the defaults
+func Normalize(opts *models.CrawlOptions) error {
+	seed, err := url.Parse(opts.SeedURL)
+	if err != nil || (seed.Scheme != "http" && seed.Scheme != "https") || seed.Host == "" {
+		return fmt.Errorf("invalid seed_url %q", opts.SeedURL)
+	}
+	if err := fetcher.CheckHost(seed.Hostname()); err != nil {
+		return fmt.Errorf("seed_url host is not a public address")
+	}
+	opts.SeedURL = seed.String()
+
+	if opts.MaxDepth < 0 || opts.MaxDepth > config.Config.CrawlMaxDepth {
+		return fmt.Errorf("max_depth must be between 0 and %d", config.Config.CrawlMaxDepth)
+	}
+	if opts.MaxDepth == 0 {
+		opts.MaxDepth = config.Config.CrawlDefaultDepth
+	}
+	if opts.MaxPages < 0 || opts.MaxPages > config.Config.CrawlMaxPages {
+		return fmt.Errorf("max_pages must be between 1 and %d", config.Config.CrawlMaxPages)
+	}
+	if opts.MaxPages == 0 {
+		opts.MaxPages = config.Config.CrawlMaxPages
+	}
+
+	switch opts.Format {
+	case "":
+		opts.Format = search.FormatText
+	case search.FormatText, search.FormatMarkdown, search.FormatHTML:
+	default:
+		return fmt.Errorf("invalid format %q", opts.Format)
+	}
+
+	// Compile the patterns now so bad ones are reported to the caller
+	_, err = newScope(seed, opts.AnyHost, opts.PathPrefix, opts.Allow, opts.Deny)
+	return err
+}
+
+// Start stores a new crawl and runs it in the background. The options must
+// have been normalized.
+func Start(userID string, opts models.CrawlOptions) (*models.Crawl, error) {
+	crawl := &models.Crawl{
+		ID:        storage.NewID(),
+		UserID:    userID,
+		Options:   opts,
+		Status:    models.CrawlQueued,
+		CreatedAt: time.Now(),
+	}
+	if err := save(crawl); err != nil {
+		return nil, err
+	}
+
+	go Run(crawl)
+	return crawl, nil
+}
+
+// Run crawls from the seed URL within the crawl's scope and limits, storing
+// every fetched page, and records the outcome on the crawl
+func Run(crawl *models.Crawl) {
+	started := time.Now()
+	crawl.Status = models.CrawlRunning
+	crawl.StartedAt = &started
+	if err := save(crawl); err != nil {
+		log.Printf("Error saving crawl %s: %v", crawl.ID, err)
+	}
+
+	err := crawlSite(crawl)
+
+	finished := time.Now()
+	crawl.FinishedAt = &finished
+	crawl.Status = models.CrawlCompleted
+	if err != nil {
+		crawl.Status = models.CrawlFailed
+		crawl.Error = err.Error()
+	}
+	if err := save(crawl); err != nil {
+		log.Printf("Error saving crawl %s: %v", crawl.ID, err)
+	}
+	log.Printf("Crawl %s %s with %d pages in %s", crawl.ID, crawl.Status, crawl.Pages, finished.Sub(started))
+}
+
+func crawlSite(crawl *models.Crawl) error {
+	opts := crawl.Options
+	seed, err := url.Parse(opts.SeedURL)
+	if err != nil {
+		return err
+	}
+	inScope, err := newScope(seed, opts.AnyHost, opts.PathPrefix, opts.Allow, opts.Deny)
+	if err != nil {
+		return err
+	}
+
+	c := fetcher.NewCollector(
+		// Colly counts the seed as depth 1
+		colly.MaxDepth(opts.MaxDepth+1),
+		colly.Async(true),
+	)
+	c.SetRequestTimeout(10 * time.Second)
+	if err := c.Limit(&colly.LimitRule{DomainGlob: "*", Parallelism: config.Config.CrawlParallelism}); err != nil {
+		return err
+	}
+
+	var (
+		mu        sync.Mutex
+		requested int
+		stored    int
+		saveErr   error
+	)
+
+	// Every request counts against the page limit, including failed ones
+	c.OnRequest(func(r *colly.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if requested >= opts.MaxPages || saveErr != nil {
+			r.Abort()
+			return
+		}
+		requested++
+	})
+
+	record := func(page models.CrawlPage) {
+		mu.Lock()
+		defer mu.Unlock()
+		if saveErr != nil {
+			return
+		}
+		if err := savePage(crawl.ID, stored, page); err != nil {
+			saveErr = err
+			return
+		}
+		stored++
+		crawl.Pages = stored
+		if err := save(crawl); err != nil {
+			log.Printf("Error saving crawl %s: %v", crawl.ID, err)
+		}
+	}
+
+	c.OnHTML("html", func(e *colly.HTMLElement) {
+		page := search.ExtractPage(e, opts.Format)
+		record(models.CrawlPage{
+			URL:        page.URL,
+			Depth:      e.Request.Depth - 1,
+			Title:      page.Title,
+			Content:    page.Content,
+			Metadata:   page.Metadata,
+			StatusCode: e.Response.StatusCode,
+			FetchedAt:  time.Now(),
+		})
+	})
+
+	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		link := e.Request.AbsoluteURL(e.Attr("href"))
+		if link == "" || !inScope.contains(link) {
+			return
+		}
+		// Already visited and depth-limited links are rejected by colly
+		_ = e.Request.Visit(link)
+	})
+
+	c.OnError(func(r *colly.Response, err error) {
+		record(models.CrawlPage{
+			URL:        r.Request.URL.String(),
+			Depth:      r.Request.Depth - 1,
+			StatusCode: r.StatusCode,
+			Error:      err.Error(),
+			FetchedAt:  time.Now(),
+		})
+	})
+
+	if err := c.Visit(opts.SeedURL); err != nil {
+		return fmt.Errorf("error visiting seed: %v", err)
+	}
+
+	if opts.Sitemap {
+		links, err := sitemapURLs(seed, opts.MaxPages)
+		if err != nil {
+			log.Printf("Crawl %s: no sitemap: %v", crawl.ID, err)
+		}
+		for _, link := range links {
+			if inScope.contains(link) {
+				_ = c.Visit(link)
+			}
+		}
+	}
+
+	c.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	return saveErr
+}
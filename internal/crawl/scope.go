@@ -0,0 +1,72 @@
+package crawl
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// scope decides which discovered URLs a crawl may visit
+type scope struct {
+	host       string
+	anyHost    bool
+	pathPrefix string
+	allow      []*regexp.Regexp
+	deny       []*regexp.Regexp
+}
+
+func newScope(seed *url.URL, anyHost bool, pathPrefix string, allow, deny []string) (*scope, error) {
+	s := &scope{
+		host:       hostKey(seed.Host),
+		anyHost:    anyHost,
+		pathPrefix: pathPrefix,
+	}
+	for _, pattern := range allow {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow pattern %q: %v", pattern, err)
+		}
+		s.allow = append(s.allow, re)
+	}
+	for _, pattern := range deny {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deny pattern %q: %v", pattern, err)
+		}
+		s.deny = append(s.deny, re)
+	}
+	return s, nil
+}
+
+// hostKey treats www.example.com and example.com as the same host
+func hostKey(host string) string {
+	return strings.TrimPrefix(strings.ToLower(host), "www.")
+}
+
+func (s *scope) contains(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	if !s.anyHost && hostKey(u.Host) != s.host {
+		return false
+	}
+	if s.pathPrefix != "" && !strings.HasPrefix(u.Path, s.pathPrefix) {
+		return false
+	}
+	for _, re := range s.deny {
+		if re.MatchString(link) {
+			return false
+		}
+	}
+	if len(s.allow) == 0 {
+		return true
+	}
+	for _, re := range s.allow {
+		if re.MatchString(link) {
+			return true
+		}
+	}
+	return false
+}
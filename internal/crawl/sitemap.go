@@ -0,0 +1,76 @@
+package crawl
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"web-scraper/internal/fetcher"
+)
+
+// Largest sitemap document read
+const maxSitemapBytes = 10 * 1024 * 1024
+
+// Nested sitemap indexes followed below the root sitemap
+const maxSitemapNesting = 2
+
+type sitemapDocument struct {
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+var sitemapClient = fetcher.NewClient(15 * time.Second)
+
+// sitemapURLs returns the page URLs listed in the host's /sitemap.xml,
+// following sitemap indexes, up to limit URLs
+func sitemapURLs(seed *url.URL, limit int) ([]string, error) {
+	root := &url.URL{Scheme: seed.Scheme, Host: seed.Host, Path: "/sitemap.xml"}
+	var links []string
+	err := readSitemap(root.String(), 0, limit, &links)
+	return links, err
+}
+
+func readSitemap(link string, nesting, limit int, links *[]string) error {
+	resp, err := sitemapClient.Get(link)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("sitemap %s: %s", link, resp.Status)
+	}
+
+	var doc sitemapDocument
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxSitemapBytes)).Decode(&doc); err != nil {
+		return fmt.Errorf("sitemap %s: %v", link, err)
+	}
+
+	for _, u := range doc.URLs {
+		if len(*links) >= limit {
+			return nil
+		}
+		if loc := strings.TrimSpace(u.Loc); loc != "" {
+			*links = append(*links, loc)
+		}
+	}
+	if nesting >= maxSitemapNesting {
+		return nil
+	}
+	for _, sitemap := range doc.Sitemaps {
+		if len(*links) >= limit {
+			return nil
+		}
+		if err := readSitemap(strings.TrimSpace(sitemap.Loc), nesting+1, limit, links); err != nil {
+			// One broken child sitemap should not lose the others
+			continue
+		}
+	}
+	return nil
+}
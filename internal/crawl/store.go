@@ -0,0 +1,95 @@
+package crawl
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+	"web-scraper/internal/models"
+	"web-scraper/internal/storage"
+)
+
+const (
+	crawlsBucket = "crawls"
+	pagesBucket  = "crawl_pages"
+)
+
+// Get returns the crawl if it exists and belongs to the user
+func Get(id, userID string) (*models.Crawl, bool, error) {
+	var crawl models.Crawl
+	found, err := storage.GetStore().Get(crawlsBucket, id, &crawl)
+	if err != nil || !found || crawl.UserID != userID {
+		return nil, false, err
+	}
+	return &crawl, true, nil
+}
+
+func save(crawl *models.Crawl) error {
+	return storage.GetStore().Put(crawlsBucket, crawl.ID, crawl)
+}
+
+// pageKey orders the pages of a crawl by the order they were fetched
+func pageKey(crawlID string, seq int) string {
+	return fmt.Sprintf("%s/%08d", crawlID, seq)
+}
+
+func savePage(crawlID string, seq int, page models.CrawlPage) error {
+	return storage.GetStore().Put(pagesBucket, pageKey(crawlID, seq), page)
+}
+
+// Pages returns up to limit pages of a crawl starting at offset
+func Pages(crawlID string, offset, limit int) ([]models.CrawlPage, error) {
+	pages := []models.CrawlPage{}
+	i := 0
+	err := EachPage(crawlID, func(page models.CrawlPage) error {
+		if i++; i <= offset {
+			return nil
+		}
+		pages = append(pages, page)
+		if len(pages) == limit {
+			return storage.ErrStop
+		}
+		return nil
+	})
+	return pages, err
+}
+
+// EachPage calls fn for every page of a crawl in fetch order
+func EachPage(crawlID string, fn func(page models.CrawlPage) error) error {
+	return storage.GetStore().ForEach(pagesBucket, crawlID+"/", func(key string, data []byte) error {
+		var page models.CrawlPage
+		if err := json.Unmarshal(data, &page); err != nil {
+			return fmt.Errorf("error decoding %s: %v", key, err)
+		}
+		return fn(page)
+	})
+}
+
+// FailInterrupted marks crawls left running by a previous process as failed
+func FailInterrupted() error {
+	store := storage.GetStore()
+	var interrupted []models.Crawl
+	err := store.ForEach(crawlsBucket, "", func(key string, data []byte) error {
+		var crawl models.Crawl
+		if err := json.Unmarshal(data, &crawl); err != nil {
+			return nil
+		}
+		if crawl.Status == models.CrawlQueued || crawl.Status == models.CrawlRunning {
+			interrupted = append(interrupted, crawl)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, crawl := range interrupted {
+		crawl.Status = models.CrawlFailed
+		crawl.Error = "interrupted by server restart"
+		crawl.FinishedAt = &now
+		if err := save(&crawl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+CREATE TABLE users (
+	id             INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at     TEXT    NOT NULL,
+	user_id        TEXT    NOT NULL UNIQUE,
+	username       TEXT    NOT NULL UNIQUE,
+	hash_pass      TEXT    NOT NULL,
+	"from"         TEXT    NOT NULL DEFAULT '',
+	chat_id        TEXT    NOT NULL DEFAULT '',
+	email          TEXT    NOT NULL DEFAULT '',
+	ip             TEXT    NOT NULL DEFAULT '',
+	active_command TEXT
+);
+
+CREATE INDEX users_email ON users (email);
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN email_verified INTEGER NOT NULL DEFAULT 0;
+
+-- Accounts created before verification existed keep full access
+UPDATE users SET email_verified = 1;
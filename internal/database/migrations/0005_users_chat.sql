@@ -0,0 +1 @@
+CREATE INDEX users_chat ON users ("from", chat_id);
@@ -0,0 +1,199 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	_ "modernc.org/sqlite"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"web-scraper/internal/models"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// SQLiteUsers keeps users in an embedded SQLite database file
+type SQLiteUsers struct {
+	db *sql.DB
+}
+
+// OpenSQLiteUsers opens (or creates) the database at path and applies any
+// pending migrations
+func OpenSQLiteUsers(path string) (*SQLiteUsers, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating data directory: %v", err)
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, fmt.Errorf("error opening database %s: %v", path, err)
+	}
+	// SQLite allows a single writer; one connection avoids lock errors
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error migrating database %s: %v", path, err)
+	}
+	return &SQLiteUsers{db: db}, nil
+}
+
+func (s *SQLiteUsers) Close() error {
+	return s.db.Close()
+}
+
+// migrate applies the embedded migrations not yet recorded in
+// schema_migrations, in file name order, each in its own transaction
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    TEXT PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		return err
+	}
+
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version := strings.TrimSuffix(filepath.Base(name), ".sql")
+		var applied int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`, version).Scan(&applied); err != nil {
+			return err
+		}
+		if applied > 0 {
+			continue
+		}
+
+		script, err := migrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(string(script)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s: %v", version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+			version, time.Now().UTC().Format(time.RFC3339)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		log.Printf("Applied migration %s", version)
+	}
+	return nil
+}
+
+const userColumns = `id, created_at, user_id, username, hash_pass, "from", chat_id, email, email_verified, ip, active_command, role, oidc_subject`
+
+func (s *SQLiteUsers) Create(user *models.User) error {
+	if user.CreatedAt == "" {
+		user.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	result, err := s.db.Exec(`INSERT INTO users (created_at, user_id, username, hash_pass, "from", chat_id, email, email_verified, ip, active_command, role, oidc_subject)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		user.CreatedAt, user.UserID, user.Username, user.HashPass, user.From, user.ChatID, user.Email, user.EmailVerified, user.IP, user.ActiveCommand, user.Role, user.OIDCSubject)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return uniqueViolation(err.Error())
+		}
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	user.ID = int(id)
+	return nil
+}
+
+func (s *SQLiteUsers) FindByUsername(username string) (*models.User, error) {
+	return s.findBy("username", username)
+}
+
+func (s *SQLiteUsers) FindByEmail(email string) (*models.User, error) {
+	return s.findBy("email", email)
+}
+
+func (s *SQLiteUsers) FindByID(userID string) (*models.User, error) {
+	return s.findBy("user_id", userID)
+}
+
+func (s *SQLiteUsers) FindByChat(from, chatID string) (*models.User, error) {
+	return s.findWhere(`"from" = ? AND chat_id = ?`, from, chatID)
+}
+
+func (s *SQLiteUsers) FindByOIDCSubject(subject string) (*models.User, error) {
+	return s.findBy("oidc_subject", subject)
+}
+
+func (s *SQLiteUsers) Update(user *models.User) error {
+	result, err := s.db.Exec(`UPDATE users SET username = ?, hash_pass = ?, "from" = ?, chat_id = ?, email = ?, email_verified = ?, ip = ?, active_command = ?, role = ?, oidc_subject = ?
+		WHERE user_id = ?`,
+		user.Username, user.HashPass, user.From, user.ChatID, user.Email, user.EmailVerified, user.IP, user.ActiveCommand, user.Role, user.OIDCSubject, user.UserID)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return uniqueViolation(err.Error())
+		}
+		return err
+	}
+	return expectRow(result)
+}
+
+func (s *SQLiteUsers) Delete(userID string) error {
+	result, err := s.db.Exec(`DELETE FROM users WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
+
+// findBy returns the first user whose column equals value; column is never
+// user input
+func (s *SQLiteUsers) findBy(column, value string) (*models.User, error) {
+	return s.findWhere(column+` = ?`, value)
+}
+
+// findWhere returns the first user matching the condition
+func (s *SQLiteUsers) findWhere(condition string, args ...interface{}) (*models.User, error) {
+	row := s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE `+condition+` ORDER BY id LIMIT 1`, args...)
+
+	var user models.User
+	err := row.Scan(&user.ID, &user.CreatedAt, &user.UserID, &user.Username, &user.HashPass,
+		&user.From, &user.ChatID, &user.Email, &user.EmailVerified, &user.IP, &user.ActiveCommand, &user.Role, &user.OIDCSubject)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func expectRow(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"web-scraper/internal/models"
+)
+
+// SupabaseUsers keeps users in the "users" table of the Supabase project
+type SupabaseUsers struct {
+	db *Database
+}
+
+func NewSupabaseUsers() (*SupabaseUsers, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to Supabase: %v", err)
+	}
+	return &SupabaseUsers{db: db}, nil
+}
+
+func (s *SupabaseUsers) Create(user *models.User) error {
+	row := userRow(user)
+	_, _, err := s.db.Client.From("users").Insert(row, false, "", "", "").Execute()
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return uniqueViolation(err.Error())
+		}
+		return err
+	}
+
+	// Read back the fields filled in by the database
+	created, err := s.FindByID(user.UserID)
+	if err != nil {
+		return err
+	}
+	*user = *created
+	return nil
+}
+
+func (s *SupabaseUsers) FindByUsername(username string) (*models.User, error) {
+	return s.findBy("username", username)
+}
+
+func (s *SupabaseUsers) FindByEmail(email string) (*models.User, error) {
+	return s.findBy("email", email)
+}
+
+func (s *SupabaseUsers) FindByID(userID string) (*models.User, error) {
+	return s.findBy("user_id", userID)
+}
+
+func (s *SupabaseUsers) FindByChat(from, chatID string) (*models.User, error) {
+	data, _, err := s.db.Client.From("users").Select("*", "", false).Eq("from", from).Eq("chat_id", chatID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	return firstUser(data)
+}
+
+func (s *SupabaseUsers) FindByOIDCSubject(subject string) (*models.User, error) {
+	return s.findBy("oidc_subject", subject)
+}
+
+func (s *SupabaseUsers) Update(user *models.User) error {
+	data, _, err := s.db.Client.From("users").Update(userRow(user), "representation", "").Eq("user_id", user.UserID).Execute()
+	if err != nil {
+		return err
+	}
+	var updated []models.User
+	if err := json.Unmarshal(data, &updated); err != nil {
+		return fmt.Errorf("failed to parse database response: %v", err)
+	}
+	if len(updated) == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *SupabaseUsers) Delete(userID string) error {
+	data, _, err := s.db.Client.From("users").Delete("representation", "").Eq("user_id", userID).Execute()
+	if err != nil {
+		return err
+	}
+	var deleted []models.User
+	if err := json.Unmarshal(data, &deleted); err != nil {
+		return fmt.Errorf("failed to parse database response: %v", err)
+	}
+	if len(deleted) == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *SupabaseUsers) findBy(column, value string) (*models.User, error) {
+	data, _, err := s.db.Client.From("users").Select("*", "", false).Eq(column, value).Execute()
+	if err != nil {
+		return nil, err
+	}
+	return firstUser(data)
+}
+
+// firstUser decodes a select response and returns its first user
+func firstUser(data []byte) (*models.User, error) {
+	var found []models.User
+	if err := json.Unmarshal(data, &found); err != nil {
+		return nil, fmt.Errorf("failed to parse database response: %v", err)
+	}
+	if len(found) == 0 {
+		return nil, ErrUserNotFound
+	}
+	return &found[0], nil
+}
+
+// userRow holds the writable columns; id and created_at are set by the
+// database
+func userRow(user *models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"user_id":        user.UserID,
+		"username":       user.Username,
+		"hash_pass":      user.HashPass,
+		"from":           user.From,
+		"chat_id":        user.ChatID,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"ip":             user.IP,
+		"active_command": user.ActiveCommand,
+		"role":           user.Role,
+		"oidc_subject":   user.OIDCSubject,
+	}
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"web-scraper/internal/config"
+	"web-scraper/internal/models"
+)
+
+var (
+	// ErrUserNotFound is returned by the Find methods when no user matches
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserExists is returned by Create and Update when the username, or
+	// another unique field other than the user ID, is taken
+	ErrUserExists = errors.New("user already exists")
+	// ErrUserIDExists is returned by Create when the user ID is taken
+	ErrUserIDExists = errors.New("user ID already exists")
+)
+
+// uniqueViolation maps a unique constraint error to ErrUserIDExists or
+// ErrUserExists by the column named in the message
+func uniqueViolation(message string) error {
+	if strings.Contains(message, "user_id") {
+		return ErrUserIDExists
+	}
+	return ErrUserExists
+}
+
+// UserRepository stores user accounts. Users are identified by their
+// UserID, the ID carried in tokens.
+type UserRepository interface {
+	Create(user *models.User) error
+	FindByUsername(username string) (*models.User, error)
+	FindByEmail(email string) (*models.User, error)
+	FindByID(userID string) (*models.User, error)
+	// FindByChat finds the user of a chat on a messaging platform, e.g.
+	// ("telegram", "123456")
+	FindByChat(from, chatID string) (*models.User, error)
+	// FindByOIDCSubject finds the user linked to a single sign-on identity
+	FindByOIDCSubject(subject string) (*models.User, error)
+	// Update saves every field of the user with the given UserID
+	Update(user *models.User) error
+	Delete(userID string) error
+}
+
+// NewUserRepository opens the user store named in the config: "supabase"
+// or "sqlite"
+func NewUserRepository() (UserRepository, error) {
+	switch config.Config.UserStore {
+	case "supabase":
+		return NewSupabaseUsers()
+	case "sqlite":
+		path := config.Config.SQLitePath
+		if path == "" {
+			path = filepath.Join(config.Config.DataDir, "users.db")
+		}
+		return OpenSQLiteUsers(path)
+	}
+	return nil, fmt.Errorf("unknown user store %q", config.Config.UserStore)
+}
+
+var (
+	users     UserRepository
+	usersErr  error
+	usersOnce sync.Once
+)
+
+// GetUsers returns the singleton user repository. It is opened on the first
+// call; an error opening it is returned by every call.
+func GetUsers() (UserRepository, error) {
+	usersOnce.Do(func() {
+		users, usersErr = NewUserRepository()
+	})
+	return users, usersErr
+}
@@ -0,0 +1,57 @@
+package fetcher
+
+import (
+	"github.com/gocolly/colly/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"web-scraper/internal/config"
+)
+
+var (
+	policy     *Policy
+	policyOnce sync.Once
+)
+
+// GetPolicy returns the fetch policy shared by every outbound request
+func GetPolicy() *Policy {
+	policyOnce.Do(func() {
+		policy = NewPolicy(NewTransport(), PolicyOptions{
+			UserAgent:     config.Config.UserAgent,
+			RobotsAgent:   config.Config.RobotsAgent,
+			RespectRobots: config.Config.RespectRobots,
+			RobotsTTL:     config.Config.RobotsCacheTTL,
+			MinInterval:   config.Config.HostMinInterval,
+			MaxPerHost:    config.Config.HostMaxConcurrency,
+			Denylist:      strings.Split(config.Config.DeniedDomains, ","),
+		})
+	})
+	return policy
+}
+
+// NewCollector returns a colly collector that fetches through the shared
+// policy with the configured user agent
+func NewCollector(options ...colly.CollectorOption) *colly.Collector {
+	options = append([]colly.CollectorOption{colly.UserAgent(config.Config.UserAgent)}, options...)
+	c := colly.NewCollector(options...)
+	c.WithTransport(GetPolicy())
+	return c
+}
+
+// NewEngineCollector returns a collector for search engine result pages.
+// These skip robots.txt: the engines disallow their search paths to crawlers,
+// while the pages are requested for a user's query rather than crawled.
+func NewEngineCollector(options ...colly.CollectorOption) *colly.Collector {
+	c := NewCollector(options...)
+	c.WithTransport(GetPolicy().WithoutRobots())
+	return c
+}
+
+// NewClient returns an HTTP client that fetches through the shared policy
+func NewClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: GetPolicy(),
+		Timeout:   timeout,
+	}
+}
@@ -0,0 +1,82 @@
+package fetcher
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+	"web-scraper/internal/config"
+)
+
+// ErrNonPublicAddress is returned for connections to loopback, private,
+// link-local and other addresses that are not reachable on the internet
+var ErrNonPublicAddress = errors.New("fetch policy: destination is not a public address")
+
+// Shared address space (RFC 6598), not covered by netip's IsPrivate
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// IsPublicAddr reports whether ip is a globally routable unicast address
+func IsPublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsValid() &&
+		!ip.IsUnspecified() &&
+		!ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!sharedAddressSpace.Contains(ip)
+}
+
+// guardControl runs after DNS resolution, right before each connection, so
+// it covers redirects and hosts that resolve differently on every lookup
+func guardControl(network, address string, _ syscall.RawConn) error {
+	if config.Config.AllowPrivateNetworks {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("fetch policy: %w", err)
+	}
+	if !IsPublicAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrNonPublicAddress, addrPort.Addr())
+	}
+	return nil
+}
+
+// NewTransport returns an HTTP transport that refuses to connect to
+// non-public addresses. It ignores proxy settings, since the proxy address
+// would be checked instead of the destination.
+func NewTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   guardControl,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// CheckHost rejects hosts that name a non-public address outright, so
+// requests for them fail before anything is queued or fetched. Names that
+// resolve to such addresses are caught when connecting.
+func CheckHost(host string) error {
+	if config.Config.AllowPrivateNetworks {
+		return nil
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrNonPublicAddress
+	}
+	if ip, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil && !IsPublicAddr(ip) {
+		return ErrNonPublicAddress
+	}
+	return nil
+}
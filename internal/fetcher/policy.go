@@ -0,0 +1,269 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"github.com/temoto/robotstxt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Longest robots.txt read
+	maxRobotsBytes = 512 * 1024
+	// How soon a robots.txt that could not be fetched is tried again
+	robotsRetryInterval = time.Minute
+)
+
+type skipRobotsKey struct{}
+
+// Policy is an http.RoundTripper that applies the fetch rules to every
+// outbound request: the domain denylist, robots.txt, and per-host request
+// spacing and concurrency
+type Policy struct {
+	base http.RoundTripper
+
+	userAgent     string
+	robotsAgent   string
+	respectRobots bool
+	robotsTTL     time.Duration
+	minInterval   time.Duration
+	maxPerHost    int
+	denylist      []string
+
+	mu     sync.Mutex
+	hosts  map[string]*hostState
+	robots map[string]*robotsEntry
+}
+
+type PolicyOptions struct {
+	// UserAgent is sent with robots.txt requests
+	UserAgent string
+	// RobotsAgent is the product token matched against robots.txt groups
+	RobotsAgent   string
+	RespectRobots bool
+	RobotsTTL     time.Duration
+	// MinInterval is the least time between requests to the same host;
+	// a longer robots.txt Crawl-delay takes precedence
+	MinInterval time.Duration
+	MaxPerHost  int
+	Denylist    []string
+}
+
+// hostState paces the requests to one host
+type hostState struct {
+	slots chan struct{}
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+type robotsEntry struct {
+	mu      sync.Mutex
+	data    *robotstxt.RobotsData
+	expires time.Time
+}
+
+func NewPolicy(base http.RoundTripper, opts PolicyOptions) *Policy {
+	if opts.MaxPerHost < 1 {
+		opts.MaxPerHost = 1
+	}
+	var denylist []string
+	for _, domain := range opts.Denylist {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			denylist = append(denylist, domain)
+		}
+	}
+	return &Policy{
+		base:          base,
+		userAgent:     opts.UserAgent,
+		robotsAgent:   opts.RobotsAgent,
+		respectRobots: opts.RespectRobots,
+		robotsTTL:     opts.RobotsTTL,
+		minInterval:   opts.MinInterval,
+		maxPerHost:    opts.MaxPerHost,
+		denylist:      denylist,
+		hosts:         make(map[string]*hostState),
+		robots:        make(map[string]*robotsEntry),
+	}
+}
+
+// Denied reports whether the host or one of its parent domains is on the
+// denylist
+func (p *Policy) Denied(host string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range p.denylist {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	if p.Denied(host) {
+		return nil, fmt.Errorf("fetch policy: %s is on the domain denylist", host)
+	}
+
+	var crawlDelay time.Duration
+	skipRobots, _ := req.Context().Value(skipRobotsKey{}).(bool)
+	if p.respectRobots && !skipRobots && req.URL.Path != "/robots.txt" {
+		robots := p.robotsFor(req.Context(), req.URL.Scheme, req.URL.Host)
+		if robots != nil {
+			if !robots.TestAgent(req.URL.RequestURI(), p.robotsAgent) {
+				return nil, fmt.Errorf("fetch policy: %s is disallowed by robots.txt", req.URL)
+			}
+			crawlDelay = robots.FindGroup(p.robotsAgent).CrawlDelay
+		}
+	}
+
+	state := p.host(host)
+	select {
+	case state.slots <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	release := func() { <-state.slots }
+
+	if err := state.wait(req.Context(), max(p.minInterval, crawlDelay)); err != nil {
+		release()
+		return nil, err
+	}
+
+	resp, err := p.base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	// The host slot is held until the body has been read and closed
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// WithoutRobots returns a RoundTripper applying the policy without the
+// robots.txt check. The denylist and host pacing still apply.
+func (p *Policy) WithoutRobots() http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return p.RoundTrip(req.WithContext(context.WithValue(req.Context(), skipRobotsKey{}, true)))
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func (p *Policy) host(host string) *hostState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state, ok := p.hosts[host]
+	if !ok {
+		state = &hostState{slots: make(chan struct{}, p.maxPerHost)}
+		p.hosts[host] = state
+	}
+	return state
+}
+
+// wait blocks until the host's next request slot, keeping requests at
+// least interval apart
+func (h *hostState) wait(ctx context.Context, interval time.Duration) error {
+	h.mu.Lock()
+	now := time.Now()
+	start := h.next
+	if start.Before(now) {
+		start = now
+	}
+	h.next = start.Add(interval)
+	h.mu.Unlock()
+
+	delay := time.Until(start)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// robotsFor returns the cached robots.txt of an origin, fetching it when
+// missing or expired. When the fetch fails, the last robots.txt stays in
+// effect, or everything is allowed, until it is retried shortly after.
+func (p *Policy) robotsFor(ctx context.Context, scheme, host string) *robotstxt.RobotsData {
+	origin := scheme + "://" + host
+	p.mu.Lock()
+	entry, ok := p.robots[origin]
+	if !ok {
+		entry = &robotsEntry{}
+		p.robots[origin] = entry
+	}
+	p.mu.Unlock()
+
+	// Concurrent requests to the same origin wait for a single fetch
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if time.Now().Before(entry.expires) {
+		return entry.data
+	}
+
+	data, err := p.fetchRobots(ctx, origin)
+	if err != nil {
+		log.Printf("Error fetching robots.txt for %s: %v", origin, err)
+		// A cancelled request says nothing about the origin, so the next
+		// request tries again
+		if ctx.Err() == nil {
+			entry.expires = time.Now().Add(min(robotsRetryInterval, p.robotsTTL))
+		}
+		return entry.data
+	}
+	entry.data = data
+	entry.expires = time.Now().Add(p.robotsTTL)
+	return data
+}
+
+func (p *Policy) fetchRobots(ctx context.Context, origin string) (*robotstxt.RobotsData, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", p.userAgent)
+
+	// Follows redirects, e.g. from http to https
+	client := &http.Client{Transport: p.base}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsBytes))
+	if err != nil {
+		return nil, err
+	}
+	return robotstxt.FromStatusAndBytes(resp.StatusCode, body)
+}
+
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"web-scraper/internal/auth"
+	"web-scraper/internal/config"
+	"web-scraper/internal/database"
+	"web-scraper/internal/mail"
+	"web-scraper/internal/middleware"
+	"web-scraper/internal/models"
+)
+
+type TokenRequest struct {
+	Token string `json:"token"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token          string `json:"token"`
+	Password       string `json:"password"`
+	RepeatPassword string `json:"repeatPassword"`
+}
+
+// sendVerificationEmail mails the user a link that verifies their email
+func sendVerificationEmail(user *models.User) error {
+	token, err := auth.IssueUserToken(auth.PurposeVerifyEmail, user.UserID, user.Email, config.Config.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	link := strings.TrimSuffix(config.Config.PublicURL, "/") + "/api/email/verify?token=" + url.QueryEscape(token)
+	mailer, err := mail.GetMailer()
+	if err != nil {
+		return err
+	}
+	return mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen this link to verify your email address:\n\n%s\n\nThe link expires in %s.\n",
+			user.Username, link, config.Config.EmailVerificationTTL),
+	})
+}
+
+// sendPasswordResetEmail mails the user a single-use password reset token
+func sendPasswordResetEmail(user *models.User) error {
+	token, err := auth.IssueUserToken(auth.PurposeResetPassword, user.UserID, user.Email, config.Config.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	instructions := fmt.Sprintf("Send this token with your new password to %s/api/password/reset:\n\n%s",
+		strings.TrimSuffix(config.Config.PublicURL, "/"), token)
+	if config.Config.PasswordResetURL != "" {
+		instructions = "Open this link to choose a new password:\n\n" + config.Config.PasswordResetURL + "?token=" + url.QueryEscape(token)
+	}
+	mailer, err := mail.GetMailer()
+	if err != nil {
+		return err
+	}
+	return mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your account. %s\n\nIt expires in %s. If you did not ask for this, ignore this email.\n",
+			user.Username, instructions, config.Config.PasswordResetTTL),
+	})
+}
+
+// VerifyEmailHandler marks the user's email as verified. The token comes
+// from the emailed link or a JSON body.
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" && r.Method == http.MethodPost {
+		var req TokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		token = req.Token
+	}
+	if token == "" {
+		http.Error(w, "Missing token", http.StatusBadRequest)
+		return
+	}
+
+	record, err := auth.ConsumeUserToken(auth.PurposeVerifyEmail, token)
+	if err == auth.ErrInvalidToken {
+		respondWithJSON(w, http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "Invalid or expired verification link",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error checking verification token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	users, err := database.GetUsers()
+	if err != nil {
+		log.Printf("Error opening user store: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	user, err := users.FindByID(record.UserID)
+	if err == nil && user.Email != record.Email {
+		// The email changed after the link was sent
+		err = database.ErrUserNotFound
+	}
+	if err == database.ErrUserNotFound {
+		respondWithJSON(w, http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "Invalid or expired verification link",
+		})
+		return
+	}
+	if err == nil && !user.EmailVerified {
+		user.EmailVerified = true
+		err = users.Update(user)
+	}
+	if err != nil {
+		log.Printf("Error verifying email: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, AuthResponse{
+		Success: true,
+		Message: "Email verified; refresh your token to get full access",
+	})
+}
+
+// ResendVerificationHandler mails a new verification link to the user
+func ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	user, err := findUser(userID)
+	if err != nil {
+		log.Printf("Error loading user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if user.EmailVerified {
+		respondWithJSON(w, http.StatusOK, AuthResponse{
+			Success: true,
+			Message: "Email already verified",
+		})
+		return
+	}
+
+	if err := sendVerificationEmail(user); err != nil {
+		log.Printf("Error sending verification email: %v", err)
+		http.Error(w, "Failed to send email", http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, AuthResponse{
+		Success: true,
+		Message: "Verification email sent",
+	})
+}
+
+// ForgotPasswordHandler mails a password reset token if an account has the
+// email. The response is the same either way so it does not reveal which
+// emails have accounts.
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowAccountRequest(w, clientIP(r)) {
+		return
+	}
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		http.Error(w, "Missing email", http.StatusBadRequest)
+		return
+	}
+
+	// Sending happens in the background so response times do not tell
+	// either
+	go func() {
+		users, err := database.GetUsers()
+		if err != nil {
+			log.Printf("Error opening user store: %v", err)
+			return
+		}
+		user, err := users.FindByEmail(email)
+		if err == database.ErrUserNotFound {
+			return
+		}
+		if err == nil {
+			err = sendPasswordResetEmail(user)
+		}
+		if err != nil {
+			log.Printf("Error sending password reset email: %v", err)
+		}
+	}()
+
+	respondWithJSON(w, http.StatusOK, AuthResponse{
+		Success: true,
+		Message: "If an account uses this email, a password reset email is on its way",
+	})
+}
+
+// ResetPasswordHandler sets a new password with a reset token and ends all
+// sessions of the user
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" || req.Password == "" {
+		http.Error(w, "Missing token or password", http.StatusBadRequest)
+		return
+	}
+	if req.Password != req.RepeatPassword {
+		respondWithJSON(w, http.StatusUnprocessableEntity, AuthResponse{
+			Success: false,
+			Message: "Passwords do not match",
+		})
+		return
+	}
+
+	record, err := auth.ConsumeUserToken(auth.PurposeResetPassword, req.Token)
+	if err == auth.ErrInvalidToken {
+		respondWithJSON(w, http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "Invalid or expired reset token",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error checking reset token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	users, err := database.GetUsers()
+	if err != nil {
+		log.Printf("Error opening user store: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	user, err := users.FindByID(record.UserID)
+	if err == database.ErrUserNotFound {
+		respondWithJSON(w, http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "Invalid or expired reset token",
+		})
+		return
+	}
+	if err == nil {
+		user.HashPass = string(hashedPassword)
+		// Receiving the token proves the user controls the email
+		user.EmailVerified = user.EmailVerified || user.Email == record.Email
+		err = users.Update(user)
+	}
+	if err == nil {
+		err = auth.RevokeUser(user.UserID)
+	}
+	if err == nil {
+		// Keys made by whoever knew the old password stop working too
+		err = auth.RevokeUserAPIKeys(user.UserID)
+	}
+	if err == nil {
+		// The lockout guarded the old password
+		err = auth.ResetLoginFailures(user.Username, "")
+	}
+	if err != nil {
+		log.Printf("Error resetting password: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, AuthResponse{
+		Success: true,
+		Message: "Password changed and API keys revoked; log in with the new password",
+	})
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"web-scraper/internal/audit"
+	"web-scraper/internal/auth"
+	"web-scraper/internal/database"
+	"web-scraper/internal/middleware"
+	"web-scraper/internal/models"
+)
+
+const defaultAuditEvents = 100
+
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+// UserResponse is the public view of a user account
+type UserResponse struct {
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	From      string `json:"from"`
+	CreatedAt string `json:"created_at"`
+}
+
+func newUserResponse(user *models.User) UserResponse {
+	return UserResponse{
+		UserID:    user.UserID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Role:      auth.RoleOf(*user),
+		From:      user.From,
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+// AdminUserHandler returns a user account
+func AdminUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadUser(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newUserResponse(user))
+}
+
+// UpdateUserRoleHandler changes the role of a user. The user's sessions are
+// ended so the new role applies at once; readonly users also lose their
+// API keys.
+func UpdateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var req RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Role = strings.ToLower(strings.TrimSpace(req.Role))
+	if !auth.ValidRole(req.Role) {
+		http.Error(w, fmt.Sprintf("Unknown role %q, expected one of %s", req.Role, strings.Join(auth.Roles, ", ")), http.StatusBadRequest)
+		return
+	}
+
+	user, ok := loadUser(w, r)
+	if !ok {
+		return
+	}
+	adminID, _ := middleware.GetUserIDFromContext(r.Context())
+	if user.UserID == adminID {
+		http.Error(w, "Admins cannot change their own role", http.StatusBadRequest)
+		return
+	}
+
+	if user.Role != req.Role {
+		user.Role = req.Role
+		users, err := database.GetUsers()
+		if err == nil {
+			err = users.Update(user)
+		}
+		if err == nil {
+			err = auth.RevokeUser(user.UserID)
+		}
+		if err == nil && req.Role == auth.RoleReadonly {
+			err = auth.RevokeUserAPIKeys(user.UserID)
+		}
+		if err != nil {
+			log.Printf("Error updating role: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("User %s set the role of user %s to %s", adminID, user.UserID, req.Role)
+	}
+	respondWithJSON(w, http.StatusOK, newUserResponse(user))
+}
+
+// AuditLogHandler returns security events, newest first, filtered by the
+// type, username and ip query parameters
+func AuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Type:     query.Get("type"),
+		Username: query.Get("username"),
+		IP:       query.Get("ip"),
+		Limit:    defaultAuditEvents,
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	events, err := audit.List(filter)
+	if err != nil {
+		log.Printf("Error listing audit events: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, events)
+}
+
+// FailedLoginsHandler lists usernames and IPs with recent failed logins and
+// their lockouts
+func FailedLoginsHandler(w http.ResponseWriter, r *http.Request) {
+	attempts, err := auth.FailedLogins()
+	if err != nil {
+		log.Printf("Error listing failed logins: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, attempts)
+}
+
+// ResetLockoutHandler clears the failed logins and lockout of the username
+// and/or ip query parameters
+func ResetLockoutHandler(w http.ResponseWriter, r *http.Request) {
+	username := r.URL.Query().Get("username")
+	ip := r.URL.Query().Get("ip")
+	if username == "" && ip == "" {
+		http.Error(w, "Missing username or ip", http.StatusBadRequest)
+		return
+	}
+
+	if err := auth.ResetLoginFailures(username, ip); err != nil {
+		log.Printf("Error resetting lockout: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	adminID, _ := middleware.GetUserIDFromContext(r.Context())
+	audit.Record(models.AuditEvent{
+		Type:     models.AuditLockoutReset,
+		Username: username,
+		IP:       ip,
+		Detail:   "by user " + adminID,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func loadUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	user, err := findUser(r.PathValue("id"))
+	if err == database.ErrUserNotFound {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error loading user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return user, true
+}
+
+// findUser loads a user by ID from the user store
+func findUser(userID string) (*models.User, error) {
+	users, err := database.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+	return users.FindByID(userID)
+}
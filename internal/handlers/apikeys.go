@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"web-scraper/internal/auth"
+	"web-scraper/internal/config"
+	"web-scraper/internal/middleware"
+	"web-scraper/internal/models"
+)
+
+type APIKeyRequest struct {
+	Name string `json:"name"`
+	// Scopes default to search only
+	Scopes []string `json:"scopes"`
+	// RateLimit is in requests per minute and defaults to API_KEY_RATE_LIMIT
+	RateLimit int `json:"rate_limit"`
+	// ExpiresInDays of 0 creates a key that does not expire
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+type APIKeyResponse struct {
+	*models.APIKey
+	// Key is the secret itself, returned only when it is created
+	Key string `json:"key"`
+}
+
+// CreateAPIKeyHandler creates an API key for the user and returns the key
+// once
+func CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Missing name", http.StatusBadRequest)
+		return
+	}
+	scopes := normalizeTags(req.Scopes)
+	if len(scopes) == 0 {
+		scopes = []string{auth.ScopeSearch}
+	}
+	for _, scope := range scopes {
+		if !auth.ValidScope(scope) {
+			http.Error(w, fmt.Sprintf("Unknown scope %q, expected one of %s", scope, strings.Join(auth.Scopes, ", ")), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.RateLimit < 0 || req.ExpiresInDays < 0 {
+		http.Error(w, "rate_limit and expires_in_days must not be negative", http.StatusBadRequest)
+		return
+	}
+	if req.RateLimit == 0 {
+		req.RateLimit = config.Config.APIKeyRateLimit
+	}
+
+	claims, _ := middleware.GetUserClaimsFromContext(r.Context())
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	keys, err := auth.ListAPIKeys(userID)
+	if err != nil {
+		log.Printf("Error listing API keys: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	active := 0
+	for _, key := range keys {
+		if key.RevokedAt == nil && (key.ExpiresAt == nil || key.ExpiresAt.After(time.Now())) {
+			active++
+		}
+	}
+	if active >= config.Config.APIKeyMaxPerUser {
+		http.Error(w, fmt.Sprintf("API key limit of %d reached", config.Config.APIKeyMaxPerUser), http.StatusForbidden)
+		return
+	}
+
+	key := &models.APIKey{
+		UserID:    userID,
+		Name:      req.Name,
+		Scopes:    scopes,
+		RateLimit: req.RateLimit,
+	}
+	key.Username, _ = claims["username"].(string)
+	key.Email, _ = claims["email"].(string)
+	if req.ExpiresInDays > 0 {
+		expires := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		key.ExpiresAt = &expires
+	}
+
+	raw, err := auth.CreateAPIKey(key)
+	if err != nil {
+		log.Printf("Error creating API key: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, APIKeyResponse{APIKey: key, Key: raw})
+}
+
+// APIKeysHandler lists the user's API keys without their secrets
+func APIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	keys, err := auth.ListAPIKeys(userID)
+	if err != nil {
+		log.Printf("Error listing API keys: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, keys)
+}
+
+// RevokeAPIKeyHandler revokes one of the user's API keys
+func RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	key, found, err := auth.RevokeAPIKey(r.PathValue("id"), userID)
+	if err != nil {
+		log.Printf("Error revoking API key: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, key)
+}
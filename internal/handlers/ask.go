@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"web-scraper/internal/ai"
+	"web-scraper/internal/config"
+	"web-scraper/internal/handlersArgs"
+	"web-scraper/internal/models"
+	"web-scraper/internal/prompts"
+	"web-scraper/internal/vectors"
+)
+
+// Where an answer's context came from
+const (
+	sourceIndex = "index"
+	sourceLive  = "live"
+)
+
+type CorpusAskRequest struct {
+	Question string `json:"question"`
+	Style    string `json:"style"`
+	// TopK is the number of chunks retrieved, capped by ASK_TOP_K
+	TopK int `json:"top_k"`
+}
+
+type CorpusAskResponse struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+	// Source is "index" when answered from stored pages, "live" when the
+	// retrieval was not confident enough and the engines were searched
+	Source     string                `json:"source"`
+	Confidence float64               `json:"confidence"`
+	Results    []models.SearchResult `json:"results"`
+	TokenUsage *models.TokenUsage    `json:"token_usage,omitempty"`
+	Duration   string                `json:"duration"`
+}
+
+// AskHandler answers a question from the pages scraped so far, falling back
+// to a live deep search when nothing stored is similar enough
+func AskHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Limitation
+	var limiter = handlersArgs.GetLimiter()
+	if !limiter.Allow() {
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	var req CorpusAskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Question = strings.TrimSpace(req.Question)
+	if req.Question == "" {
+		http.Error(w, "Missing question", http.StatusBadRequest)
+		return
+	}
+	if req.Style == "" {
+		req.Style = config.Config.DefaultPromptStyle
+	}
+	registry, err := prompts.GetRegistry()
+	if err != nil {
+		log.Printf("Error loading prompt templates: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !registry.HasStyle(req.Style) {
+		http.Error(w, "Invalid style", http.StatusBadRequest)
+		return
+	}
+	req.TopK = capLimit(req.TopK, config.Config.AskTopK)
+
+	// A live deep search can outlast the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(2 * time.Minute)); err != nil {
+		log.Printf("Error extending write deadline: %v", err)
+	}
+
+	response, err := answerFromCorpus(req)
+	if err != nil {
+		log.Printf("Ask error: %v", err)
+		http.Error(w, aiErrorMessage, http.StatusBadGateway)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func answerFromCorpus(req CorpusAskRequest) (CorpusAskResponse, error) {
+	startTime := time.Now()
+	response := CorpusAskResponse{Question: req.Question}
+
+	matches, embedUsage := retrieve(req.Question, req.TopK)
+	if len(matches) > 0 {
+		response.Confidence = matches[0].Similarity
+	}
+
+	var results []models.SearchResult
+	if len(matches) > 0 && response.Confidence >= config.Config.AskMinSimilarity {
+		response.Source = sourceIndex
+		results = groupMatches(matches)
+	} else {
+		log.Printf("Retrieval confidence %.2f too low for %q, searching live", response.Confidence, req.Question)
+		response.Source = sourceLive
+		results = runQueries(defaultEngines(), []string{req.Question}, true)
+	}
+	response.Results = results
+
+	answer, usage, err := getAIResults(summaryRequest{
+		Query: req.Question,
+		Style: req.Style,
+		Metadata: map[string]string{
+			"type":         "ask",
+			"source":       response.Source,
+			"style":        req.Style,
+			"result_count": strconv.Itoa(len(results)),
+		},
+	}, results)
+	if err != nil {
+		return response, err
+	}
+	response.Answer = answer
+	response.TokenUsage = addUsage(usage, embedUsage)
+	response.Duration = time.Since(startTime).String()
+	return response, nil
+}
+
+// retrieve embeds the question and returns the most similar stored chunks.
+// Embedding errors leave the question to the live search.
+func retrieve(question string, k int) ([]vectors.Match, ai.Usage) {
+	embedder := handlersArgs.GetEmbedder()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	embedded, usage, err := embedder.Embed(ctx, []string{question})
+	if err != nil {
+		log.Printf("Error embedding question: %v", err)
+		return nil, ai.Usage{}
+	}
+	return vectors.GetStore().Search(embedded[0], embedder.Model(), k), usage
+}
+
+// groupMatches turns retrieved chunks into one result per page, ordered by
+// the page's best match, with the page content made of its matched chunks
+func groupMatches(matches []vectors.Match) []models.SearchResult {
+	var results []models.SearchResult
+	byLink := make(map[string]int)
+	for _, match := range matches {
+		i, ok := byLink[match.Link]
+		if !ok {
+			results = append(results, models.SearchResult{
+				Title:     match.Title,
+				Link:      match.Link,
+				Source:    "Index",
+				Relevance: match.Similarity,
+			})
+			i = len(results) - 1
+			byLink[match.Link] = i
+		}
+		if results[i].InnerContent != "" {
+			results[i].InnerContent += "\n\n"
+		}
+		results[i].InnerContent += match.Text
+	}
+	return results
+}
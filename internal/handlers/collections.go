@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"web-scraper/internal/collections"
+	"web-scraper/internal/config"
+	"web-scraper/internal/handlersArgs"
+	"web-scraper/internal/middleware"
+	"web-scraper/internal/models"
+	"web-scraper/internal/prompts"
+	"web-scraper/internal/search"
+)
+
+type CollectionRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+}
+
+// CollectionItemRequest saves either a search result as returned by the
+// search endpoints or, with only URL set, a page scraped on the spot
+type CollectionItemRequest struct {
+	URL    string               `json:"url,omitempty"`
+	Result *models.SearchResult `json:"result,omitempty"`
+	Note   string               `json:"note"`
+	Tags   []string             `json:"tags"`
+}
+
+type AnnotationRequest struct {
+	Note string   `json:"note"`
+	Tags []string `json:"tags"`
+}
+
+type SynthesizeRequest struct {
+	// Question focuses the synthesis; without it the whole collection is
+	// summarized
+	Question string `json:"question"`
+	// Tag limits the synthesis to items carrying it
+	Tag string `json:"tag"`
+}
+
+type SynthesizeResponse struct {
+	CollectionID string             `json:"collection_id"`
+	Question     string             `json:"question,omitempty"`
+	Synthesis    string             `json:"synthesis"`
+	ItemCount    int                `json:"item_count"`
+	TokenUsage   *models.TokenUsage `json:"token_usage,omitempty"`
+	Duration     string             `json:"duration"`
+}
+
+// normalizeTags trims and lowercases tags and drops empty and repeated ones
+func normalizeTags(tags []string) []string {
+	var normalized []string
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// CreateCollectionHandler creates an empty collection
+func CreateCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var req CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Missing name", http.StatusBadRequest)
+		return
+	}
+
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	collection := &models.Collection{
+		UserID:      userID,
+		Name:        req.Name,
+		Description: strings.TrimSpace(req.Description),
+		Tags:        normalizeTags(req.Tags),
+	}
+	if err := collections.Create(collection); err != nil {
+		log.Printf("Error creating collection: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/api/collections/"+collection.ID)
+	respondWithJSON(w, http.StatusCreated, collection)
+}
+
+// CollectionsHandler lists the user's collections, optionally by tag
+func CollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	list, err := collections.List(userID, strings.ToLower(r.URL.Query().Get("tag")))
+	if err != nil {
+		log.Printf("Error listing collections: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+// CollectionHandler returns a collection with its items, optionally only
+// those with a tag
+func CollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := loadCollection(w, r)
+	if !ok {
+		return
+	}
+
+	items, err := collections.Items(collection.ID, strings.ToLower(r.URL.Query().Get("tag")))
+	if err != nil {
+		log.Printf("Error loading collection items: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	collection.Items = items
+	respondWithJSON(w, http.StatusOK, collection)
+}
+
+// UpdateCollectionHandler replaces the name, description and tags of a
+// collection
+func UpdateCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var req CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Missing name", http.StatusBadRequest)
+		return
+	}
+
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	collection, found, err := collections.Update(r.PathValue("id"), userID, func(collection *models.Collection) {
+		collection.Name = req.Name
+		collection.Description = strings.TrimSpace(req.Description)
+		collection.Tags = normalizeTags(req.Tags)
+	})
+	if err != nil {
+		log.Printf("Error updating collection: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, collection)
+}
+
+// DeleteCollectionHandler removes a collection and everything saved in it
+func DeleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	found, err := collections.Delete(r.PathValue("id"), userID)
+	if err != nil {
+		log.Printf("Error deleting collection: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddCollectionItemHandler saves a result in a collection. Results saved
+// without page content get it fetched, so the collection keeps a snapshot
+// of the page.
+func AddCollectionItemHandler(w http.ResponseWriter, r *http.Request) {
+	var req CollectionItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	collection, ok := loadCollection(w, r)
+	if !ok {
+		return
+	}
+	if collection.ItemCount >= config.Config.CollectionMaxItems {
+		http.Error(w, fmt.Sprintf("Collection limit of %d items reached", config.Config.CollectionMaxItems), http.StatusForbidden)
+		return
+	}
+
+	item := &models.CollectionItem{
+		Note: strings.TrimSpace(req.Note),
+		Tags: normalizeTags(req.Tags),
+	}
+	switch {
+	case req.Result != nil:
+		link, err := validateScrapeURL(req.Result.Link)
+		if err != nil {
+			http.Error(w, "Invalid result link", http.StatusBadRequest)
+			return
+		}
+		item.Result = *req.Result
+		item.Result.Link = link
+		if item.Result.InnerContent == "" {
+			content, err := search.FetchPage(item.Result.Link)
+			if err != nil {
+				// Keep the result even if the page cannot be fetched now
+				log.Printf("Error fetching %s for collection: %v", item.Result.Link, err)
+			}
+			item.Result.InnerContent = content
+		}
+	case req.URL != "":
+		link, err := validateScrapeURL(req.URL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		scraped := scrapeURL(link, scrapeOptions{Format: search.FormatText})
+		if scraped.Error != "" {
+			http.Error(w, scraped.Error, http.StatusBadGateway)
+			return
+		}
+		item.Result = scraped.SearchResult
+	default:
+		http.Error(w, "Missing url or result", http.StatusBadRequest)
+		return
+	}
+
+	if err := collections.AddItem(collection, item); err != nil {
+		if err == collections.ErrDuplicate {
+			http.Error(w, "Page is already in the collection", http.StatusConflict)
+			return
+		}
+		log.Printf("Error saving collection item: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, item)
+}
+
+// UpdateCollectionItemHandler replaces the note and tags of a saved result
+func UpdateCollectionItemHandler(w http.ResponseWriter, r *http.Request) {
+	var req AnnotationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	collection, ok := loadCollection(w, r)
+	if !ok {
+		return
+	}
+	item, found, err := collections.UpdateItem(collection.ID, r.PathValue("item"), func(item *models.CollectionItem) {
+		item.Note = strings.TrimSpace(req.Note)
+		item.Tags = normalizeTags(req.Tags)
+	})
+	if err != nil {
+		log.Printf("Error updating collection item: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, item)
+}
+
+// DeleteCollectionItemHandler removes a saved result from a collection
+func DeleteCollectionItemHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := loadCollection(w, r)
+	if !ok {
+		return
+	}
+	found, err := collections.DeleteItem(collection.ID, r.PathValue("item"))
+	if err != nil {
+		log.Printf("Error deleting collection item: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SynthesizeCollectionHandler asks the model for a synthesis across the
+// saved results and notes of a collection
+func SynthesizeCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	// Limitation
+	var limiter = handlersArgs.GetLimiter()
+	if !limiter.Allow() {
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	var req SynthesizeRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	collection, ok := loadCollection(w, r)
+	if !ok {
+		return
+	}
+	items, err := collections.Items(collection.ID, strings.ToLower(strings.TrimSpace(req.Tag)))
+	if err != nil {
+		log.Printf("Error loading collection items: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if len(items) == 0 {
+		http.Error(w, "Collection has no items to synthesize", http.StatusBadRequest)
+		return
+	}
+
+	// Large collections take a while to synthesize
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(2 * time.Minute)); err != nil {
+		log.Printf("Error extending write deadline: %v", err)
+	}
+
+	startTime := time.Now()
+	question := strings.TrimSpace(req.Question)
+	synthesis, usage, err := synthesizeCollection(collection, items, question)
+	if err != nil {
+		log.Printf("AI error: %v", err)
+		http.Error(w, aiErrorMessage, http.StatusBadGateway)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, SynthesizeResponse{
+		CollectionID: collection.ID,
+		Question:     question,
+		Synthesis:    synthesis,
+		ItemCount:    len(items),
+		TokenUsage:   usage,
+		Duration:     time.Since(startTime).String(),
+	})
+}
+
+func synthesizeCollection(collection *models.Collection, items []models.CollectionItem, question string) (string, *models.TokenUsage, error) {
+	results := make([]models.SearchResult, len(items))
+	var notes []string
+	for i, item := range items {
+		results[i] = item.Result
+		note := item.Note
+		if len(item.Tags) > 0 {
+			note = strings.TrimSpace(note + " (tags: " + strings.Join(item.Tags, ", ") + ")")
+		}
+		if note != "" {
+			notes = append(notes, fmt.Sprintf("[%d] %s", i+1, note))
+		}
+	}
+
+	query := question
+	if query == "" {
+		query = collection.Name
+	}
+	return getAIResults(summaryRequest{
+		Query: query,
+		Style: prompts.CollectionTemplate,
+		Metadata: map[string]string{
+			"collection":  collection.Name,
+			"description": collection.Description,
+			"question":    question,
+			"notes":       strings.Join(notes, "\n"),
+		},
+	}, results)
+}
+
+func loadCollection(w http.ResponseWriter, r *http.Request) (*models.Collection, bool) {
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	collection, found, err := collections.Get(r.PathValue("id"), userID)
+	if err != nil {
+		log.Printf("Error loading collection: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !found {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return nil, false
+	}
+	return collection, true
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"web-scraper/internal/crawl"
+	"web-scraper/internal/handlersArgs"
+	"web-scraper/internal/middleware"
+	"web-scraper/internal/models"
+)
+
+const (
+	defaultCrawlPages = 20
+	maxCrawlPages     = 100
+)
+
+// CreateCrawlHandler starts a bounded crawl from a seed URL in the background
+func CreateCrawlHandler(w http.ResponseWriter, r *http.Request) {
+	// Limitation
+	var limiter = handlersArgs.GetLimiter()
+	if !limiter.Allow() {
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	var opts models.CrawlOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := crawl.Normalize(&opts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	job, err := crawl.Start(userID, opts)
+	if err != nil {
+		log.Printf("Error starting crawl: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, job)
+}
+
+// CrawlHandler returns the status of a crawl
+func CrawlHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := loadCrawl(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+// CrawlPagesHandler lists the pages of a crawl in fetch order
+func CrawlPagesHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := loadCrawl(w, r)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	offset, limit := 0, defaultCrawlPages
+	if value := params.Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid offset parameter", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+	if value := params.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxCrawlPages {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxCrawlPages), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	pages, err := crawl.Pages(job.ID, offset, limit)
+	if err != nil {
+		log.Printf("Error listing crawl pages: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, models.CrawlPagesResponse{
+		CrawlID: job.ID,
+		Total:   job.Pages,
+		Offset:  offset,
+		Limit:   limit,
+		Pages:   pages,
+	})
+}
+
+// CrawlExportHandler streams every page of a crawl as JSON lines or CSV
+func CrawlExportHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := loadCrawl(w, r)
+	if !ok {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "jsonl"
+	}
+	if format != "jsonl" && format != "csv" {
+		http.Error(w, "Invalid format parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Large crawls take longer to write than the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(5 * time.Minute)); err != nil {
+		log.Printf("Error extending write deadline: %v", err)
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=crawl-%s.%s", job.ID, format))
+
+	var err error
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		writer := csv.NewWriter(w)
+		_ = writer.Write([]string{"url", "depth", "status_code", "title", "fetched_at", "error", "content"})
+		err = crawl.EachPage(job.ID, func(page models.CrawlPage) error {
+			return writer.Write([]string{
+				page.URL,
+				strconv.Itoa(page.Depth),
+				strconv.Itoa(page.StatusCode),
+				page.Title,
+				page.FetchedAt.Format(time.RFC3339),
+				page.Error,
+				page.Content,
+			})
+		})
+		writer.Flush()
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(w)
+		err = crawl.EachPage(job.ID, func(page models.CrawlPage) error {
+			return encoder.Encode(page)
+		})
+	}
+	if err != nil {
+		// Headers are already sent, so the export is just cut short
+		log.Printf("Error exporting crawl %s: %v", job.ID, err)
+	}
+}
+
+func loadCrawl(w http.ResponseWriter, r *http.Request) (*models.Crawl, bool) {
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	job, found, err := crawl.Get(r.PathValue("id"), userID)
+	if err != nil {
+		log.Printf("Error loading crawl: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !found {
+		http.Error(w, "Crawl not found", http.StatusNotFound)
+		return nil, false
+	}
+	return job, true
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"web-scraper/internal/handlersArgs"
+	"web-scraper/internal/history"
+	"web-scraper/internal/middleware"
+	"web-scraper/internal/models"
+	"web-scraper/internal/schemas"
+	"web-scraper/internal/sessions"
+)
+
+const (
+	defaultHistoryEntries = 20
+	maxHistoryEntries     = 100
+)
+
+// recordSearch adds a search to the user's history
+func recordSearch(opts searchOptions, userID string, response models.SearchResponse, cacheHit bool, startTime time.Time) {
+	if userID == "" {
+		return
+	}
+
+	entry := &models.HistoryEntry{
+		UserID:      userID,
+		Query:       opts.Query,
+		Type:        models.JobSearch,
+		Mode:        opts.Mode,
+		Style:       opts.Style,
+		Engines:     engineNames(defaultEngines()),
+		Rewrite:     opts.Rewrite,
+		MaxQueries:  opts.MaxQueries,
+		Rerank:      opts.Rerank,
+		CacheHit:    cacheHit,
+		ResultCount: len(response.Results),
+		SessionID:   response.SessionID,
+		Duration:    time.Since(startTime).String(),
+		CreatedAt:   startTime,
+	}
+	if opts.Deep {
+		entry.Type = models.JobDeep
+	}
+	if opts.Schema != nil {
+		entry.Schema = opts.Schema.Name
+		if _, registered := schemas.Get(opts.Schema.Name); !registered {
+			entry.CustomSchema = opts.Schema.Raw
+		}
+	}
+
+	if err := history.Record(entry); err != nil {
+		log.Printf("Error recording search history: %v", err)
+	}
+}
+
+// historySearchOptions rebuilds the options of a recorded search, validating
+// them again in case styles or schemas changed since
+func historySearchOptions(entry *models.HistoryEntry) (searchOptions, error) {
+	params := url.Values{}
+	params.Set("search", entry.Query)
+	params.Set("mode", entry.Mode)
+	params.Set("style", entry.Style)
+	if entry.Rewrite {
+		params.Set("rewrite", "true")
+		params.Set("max_queries", strconv.Itoa(entry.MaxQueries))
+	}
+	if entry.Rerank {
+		params.Set("rerank", "true")
+	}
+	if entry.Schema != "" {
+		params.Set("output", "json")
+		if len(entry.CustomSchema) == 0 {
+			params.Set("schema", entry.Schema)
+		}
+	}
+
+	return parseSearchParams(params, entry.Type == models.JobDeep, func() ([]byte, error) {
+		return entry.CustomSchema, nil
+	})
+}
+
+// HistoryHandler lists the user's searches, newest first
+func HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	filter := history.Filter{
+		Query: params.Get("q"),
+		Type:  params.Get("type"),
+		Limit: defaultHistoryEntries,
+	}
+	if filter.Type != "" && filter.Type != models.JobSearch && filter.Type != models.JobDeep {
+		http.Error(w, "Invalid type, expected search or deep", http.StatusBadRequest)
+		return
+	}
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxHistoryEntries {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxHistoryEntries), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+	if offset := params.Get("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid offset parameter", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = n
+	}
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := params.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, name+" must be an RFC 3339 time", http.StatusBadRequest)
+				return
+			}
+			*t = parsed
+		}
+	}
+	if cacheHit := params.Get("cache_hit"); cacheHit != "" {
+		hit, err := strconv.ParseBool(cacheHit)
+		if err != nil {
+			http.Error(w, "Invalid cache_hit parameter", http.StatusBadRequest)
+			return
+		}
+		filter.CacheHit = &hit
+	}
+
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	entries, total, err := history.List(userID, filter)
+	if err != nil {
+		log.Printf("Error listing history: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, models.HistoryResponse{
+		Total:   total,
+		Offset:  filter.Offset,
+		Limit:   filter.Limit,
+		Entries: entries,
+	})
+}
+
+// HistoryEntryHandler returns a single history entry
+func HistoryEntryHandler(w http.ResponseWriter, r *http.Request) {
+	entry, ok := loadHistoryEntry(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, entry)
+}
+
+// ReplayHistoryHandler runs a recorded search again, answering from the
+// cache when the response is still cached
+func ReplayHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	// Limitation
+	var limiter = handlersArgs.GetLimiter()
+	if !limiter.Allow() {
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	entry, ok := loadHistoryEntry(w, r)
+	if !ok {
+		return
+	}
+	opts, err := historySearchOptions(entry)
+	if err != nil {
+		http.Error(w, "Search can no longer be replayed: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	// A deep search missing from the cache can outlast the server write
+	// timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(2 * time.Minute)); err != nil {
+		log.Printf("Error extending write deadline: %v", err)
+	}
+
+	response := cachedSearch(opts, entry.UserID, nil)
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// DeleteHistoryEntryHandler removes a single history entry and the session
+// of its follow-up questions
+func DeleteHistoryEntryHandler(w http.ResponseWriter, r *http.Request) {
+	entry, ok := loadHistoryEntry(w, r)
+	if !ok {
+		return
+	}
+	if _, err := history.Delete(entry.ID, entry.UserID); err != nil {
+		log.Printf("Error deleting history entry: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if entry.SessionID != "" {
+		if _, err := sessions.Delete(entry.SessionID, entry.UserID); err != nil {
+			log.Printf("Error deleting session: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ClearHistoryHandler removes the user's whole search history and their
+// sessions, which hold the same searches
+func ClearHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	removed, err := history.DeleteAll(userID)
+	if err != nil {
+		log.Printf("Error clearing history: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	removedSessions, err := sessions.DeleteAll(userID)
+	if err != nil {
+		log.Printf("Error clearing sessions: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]int{"deleted": removed, "sessions_deleted": removedSessions})
+}
+
+func loadHistoryEntry(w http.ResponseWriter, r *http.Request) (*models.HistoryEntry, bool) {
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	entry, found, err := history.Get(r.PathValue("id"), userID)
+	if err != nil {
+		log.Printf("Error loading history entry: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !found {
+		http.Error(w, "History entry not found", http.StatusNotFound)
+		return nil, false
+	}
+	return entry, true
+}
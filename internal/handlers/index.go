@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"web-scraper/internal/config"
+	"web-scraper/internal/handlersArgs"
+	"web-scraper/internal/index"
+	"web-scraper/internal/models"
+	"web-scraper/internal/vectors"
+)
+
+const (
+	defaultIndexResults = 10
+	maxIndexResults     = 100
+)
+
+// IndexSearchHandler searches the pages collected by earlier deep searches
+// without scraping anything
+func IndexSearchHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := params.Get("q")
+	if q == "" {
+		http.Error(w, "Missing q parameter", http.StatusBadRequest)
+		return
+	}
+
+	opts := index.SearchOptions{
+		Size:   defaultIndexResults,
+		Source: params.Get("source"),
+	}
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxIndexResults {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxIndexResults), http.StatusBadRequest)
+			return
+		}
+		opts.Size = n
+	}
+	if offset := params.Get("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid offset parameter", http.StatusBadRequest)
+			return
+		}
+		opts.From = n
+	}
+	if since := params.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			http.Error(w, "since must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		opts.Since = t
+	}
+	if content := params.Get("content"); content != "" {
+		enabled, err := strconv.ParseBool(content)
+		if err != nil {
+			http.Error(w, "Invalid content parameter", http.StatusBadRequest)
+			return
+		}
+		opts.Content = enabled
+	}
+
+	response, err := index.GetIndex().Search(q, opts)
+	if err != nil {
+		// Query string syntax errors are the caller's
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// indexResults stores the fetched pages of a deep search in the local
+// full-text index and vector store
+func indexResults(results []models.SearchResult) {
+	if err := index.GetIndex().AddResults(results); err != nil {
+		log.Printf("Error indexing pages: %v", err)
+	}
+
+	if !config.Config.VectorIndexEnabled {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, err := vectors.GetStore().AddResults(ctx, handlersArgs.GetEmbedder(), results); err != nil {
+		log.Printf("Error embedding pages: %v", err)
+	}
+}
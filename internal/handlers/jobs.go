@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"web-scraper/internal/auth"
+	"web-scraper/internal/config"
+	"web-scraper/internal/fetcher"
+	"web-scraper/internal/handlersArgs"
+	"web-scraper/internal/jobs"
+	"web-scraper/internal/middleware"
+	"web-scraper/internal/models"
+)
+
+type JobRequest struct {
+	// Type is "search" or "deep"
+	Type string `json:"type"`
+	// Params takes the query parameters of /api/scraper, e.g. "search"
+	Params      map[string]string `json:"params"`
+	Schema      json.RawMessage   `json:"schema,omitempty"`
+	CallbackURL string            `json:"callback_url,omitempty"`
+}
+
+// CreateJobHandler queues a search to run in the background and returns the
+// job to poll
+func CreateJobHandler(w http.ResponseWriter, r *http.Request) {
+	// Limitation
+	var limiter = handlersArgs.GetLimiter()
+	if !limiter.Allow() {
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	var req JobRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxSchemaBytes+4096)).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Type == "" {
+		req.Type = models.JobSearch
+	}
+	if req.Type != models.JobSearch && req.Type != models.JobDeep {
+		http.Error(w, "Invalid type, expected search or deep", http.StatusBadRequest)
+		return
+	}
+
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	job := &models.Job{
+		UserID:      userID,
+		Type:        req.Type,
+		Params:      req.Params,
+		Schema:      req.Schema,
+		CallbackURL: req.CallbackURL,
+	}
+	if _, err := jobSearchOptions(job); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateWebhookURL(job.CallbackURL, "callback_url"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if job.CallbackURL != "" {
+		job.WebhookSecret = auth.RandomToken()
+	}
+
+	if err := jobs.Enqueue(job); err != nil {
+		if err == jobs.ErrQueueFull {
+			http.Error(w, "Job queue is full, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		log.Printf("Error queueing job: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	respondWithJSON(w, http.StatusAccepted, job)
+}
+
+// JobHandler returns the status of a job, with the search response once it
+// has completed
+func JobHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	job, found, err := jobs.Get(r.PathValue("id"), userID)
+	if err != nil {
+		log.Printf("Error loading job: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, job.WithoutSecret())
+}
+
+// RunJob runs a queued search job; it is the runner of the job workers. A
+// search whose AI step failed fails the job.
+func RunJob(job *models.Job, stage func(string)) (*models.SearchResponse, error) {
+	opts, err := jobSearchOptions(job)
+	if err != nil {
+		return nil, err
+	}
+	response := cachedSearch(opts, job.UserID, stage)
+	if response.FormattedResult == aiErrorMessage {
+		return nil, errors.New(aiErrorMessage)
+	}
+	return &response, nil
+}
+
+// jobSearchOptions validates the job's parameters like those of a search
+// request
+func jobSearchOptions(job *models.Job) (searchOptions, error) {
+	params := url.Values{}
+	for key, value := range job.Params {
+		params.Set(key, value)
+	}
+	return parseSearchParams(params, job.Type == models.JobDeep, func() ([]byte, error) {
+		if len(job.Schema) == 0 {
+			return nil, fmt.Errorf("Missing schema parameter")
+		}
+		return job.Schema, nil
+	})
+}
+
+// validateWebhookURL checks a webhook URL given in the request field
+func validateWebhookURL(raw, field string) error {
+	if raw == "" {
+		return nil
+	}
+	if !config.Config.WebhooksEnabled {
+		return fmt.Errorf("Webhooks are not enabled on this server")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Invalid %s", field)
+	}
+	if fetcher.GetPolicy().Denied(u.Hostname()) {
+		return fmt.Errorf("%s host is on the domain denylist", field)
+	}
+	if err := fetcher.CheckHost(u.Hostname()); err != nil {
+		return fmt.Errorf("%s host is not a public address", field)
+	}
+	return nil
+}
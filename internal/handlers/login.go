@@ -2,15 +2,21 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
-	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
-	"math/rand"
+	"log"
+	"net"
 	"net/http"
-	"os"
-	"time"
+	"net/mail"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"web-scraper/internal/audit"
+	"web-scraper/internal/auth"
+	"web-scraper/internal/config"
 	"web-scraper/internal/database"
 	"web-scraper/internal/models"
+	"web-scraper/internal/storage"
 )
 
 type SignupRequest struct {
@@ -23,12 +29,19 @@ type SignupRequest struct {
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	// CaptchaToken is the CAPTCHA response, needed after repeated failures
+	CaptchaToken string `json:"captcha_token,omitempty"`
 }
 
 type AuthResponse struct {
-	Token   string `json:"token,omitempty"`
-	Success bool   `json:"success,omitempty"`
-	Message string `json:"message,omitempty"`
+	// Token is the access token
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+	Success      bool   `json:"success,omitempty"`
+	Message      string `json:"message,omitempty"`
+	// CaptchaRequired is set when the next login needs a CAPTCHA
+	CaptchaRequired bool `json:"captcha_required,omitempty"`
 }
 
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
@@ -45,22 +58,95 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	}
 }
 
-// Helper functions remain the same
+var (
+	trustedProxies     []netip.Prefix
+	trustedProxiesOnce sync.Once
+)
+
+// isTrustedProxy reports whether ip is in TRUSTED_PROXIES
+func isTrustedProxy(ip string) bool {
+	trustedProxiesOnce.Do(func() {
+		for _, entry := range strings.Split(config.Config.TrustedProxies, ",") {
+			if entry = strings.TrimSpace(entry); entry == "" {
+				continue
+			}
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				addr, addrErr := netip.ParseAddr(entry)
+				if addrErr != nil {
+					log.Printf("Invalid trusted proxy %q: %v", entry, err)
+					continue
+				}
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			trustedProxies = append(trustedProxies, prefix)
+		}
+	})
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client. Forwarding headers are only
+// believed when the connection comes from a trusted proxy, since anyone
+// else can set them. In X-Forwarded-For the entries added by trusted
+// proxies are skipped from the right; earlier ones can be forged.
+func clientIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !isTrustedProxy(remote) {
+		return remote
+	}
+
+	header := config.Config.ClientIPHeader
+	if !strings.EqualFold(header, "X-Forwarded-For") {
+		if ip, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get(header))); err == nil {
+			return ip.String()
+		}
+		return remote
+	}
+	entries := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(entries) - 1; i >= 0; i-- {
+		ip, err := netip.ParseAddr(strings.TrimSpace(entries[i]))
+		if err != nil {
+			break
+		}
+		if !isTrustedProxy(ip.String()) {
+			return ip.String()
+		}
+	}
+	return remote
+}
+
+// generateUserId returns a random user ID, long enough not to collide
 func generateUserId() string {
-	rand.Seed(time.Now().UnixNano())
-	return fmt.Sprintf("%d", rand.Intn(1000000))
+	return storage.NewID()
 }
 
-func generateToken(user models.User) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id":  user.UserID,
-		"username": user.Username,
-		"email":    user.Email,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
+// respondWithTokens starts a session for the user and returns its tokens
+func respondWithTokens(w http.ResponseWriter, user models.User) {
+	tokens, err := auth.IssueTokens(user)
+	if err != nil {
+		log.Printf("Error issuing tokens: %v", err)
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	respondWithJSON(w, http.StatusOK, AuthResponse{
+		Success:      true,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+	})
 }
 
 func Signup(w http.ResponseWriter, r *http.Request) {
@@ -68,6 +154,10 @@ func Signup(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	ip := clientIP(r)
+	if !allowAccountRequest(w, ip) {
+		return
+	}
 
 	var req SignupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -83,50 +173,52 @@ func Signup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ip := r.Header.Get("X-Forwarded-For")
-	db := database.GetDB()
+	req.Email = strings.TrimSpace(req.Email)
+	if address, err := mail.ParseAddress(req.Email); err != nil || address.Address != req.Email {
+		respondWithJSON(w, http.StatusUnprocessableEntity, AuthResponse{
+			Success: false,
+			Message: "Invalid email address",
+		})
+		return
+	}
 
-	// Check if username exists
-	data, _, err := db.Client.From("users").Select("*", "", false).Eq("username", req.Username).Execute()
+	users, err := database.GetUsers()
 	if err != nil {
+		log.Printf("Error opening user store: %v", err)
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
-	var existingUsers []models.User
-	if err := json.Unmarshal(data, &existingUsers); err != nil {
-		http.Error(w, "Failed to parse database response", http.StatusInternalServerError)
+	// Check if username exists
+	_, err = users.FindByUsername(req.Username)
+	if err == nil {
+		respondWithJSON(w, http.StatusUnprocessableEntity, AuthResponse{
+			Success: false,
+			Message: "User with this username already exists",
+		})
+		return
+	}
+	if err != database.ErrUserNotFound {
+		log.Printf("Error looking up user: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
-	if len(existingUsers) > 0 {
+	// Check if email is in use; it identifies the account for password
+	// resets
+	_, err = users.FindByEmail(req.Email)
+	if err == nil {
 		respondWithJSON(w, http.StatusUnprocessableEntity, AuthResponse{
 			Success: false,
-			Message: "User with this username already exists",
+			Message: "User with this email already exists",
 		})
 		return
 	}
-
-	// Check if IP exists
-	//data, _, err = db.Client.From("users").Select("*", "", false).Eq("ip", ip).Execute()
-	//if err != nil {
-	//	http.Error(w, "Database error", http.StatusInternalServerError)
-	//	return
-	//}
-	//
-	//var existingIPUsers []models.User
-	//if err := json.Unmarshal(data, &existingIPUsers); err != nil {
-	//	http.Error(w, "Failed to parse database response", http.StatusInternalServerError)
-	//	return
-	//}
-	//
-	//if len(existingIPUsers) > 0 {
-	//	respondWithJSON(w, http.StatusUnauthorized, AuthResponse{
-	//		Success: false,
-	//		Message: "IP should be unique",
-	//	})
-	//	return
-	//}
+	if err != database.ErrUserNotFound {
+		log.Printf("Error looking up user: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
 
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
@@ -136,56 +228,41 @@ func Signup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	userId := generateUserId()
-
-	// Create new user with only the required fields
-	newUser := map[string]interface{}{
-		"username":  req.Username,
-		"user_id":   userId,
-		"hash_pass": string(hashedPassword),
-		"from":      "web",
-		"chat_id":   userId,
-		"email":     req.Email,
-		"ip":        ip,
-		// Don't include created_at as it's handled by the database
-		// Don't include id as it's auto-generated
-		"active_command": nil,
-	}
-
-	// Insert new user
-	_, _, err = db.Client.From("users").Insert(newUser, true, "", "*", "").Execute()
-	if err != nil {
-		fmt.Printf("Insert error: %v\n", err)
-		http.Error(w, "Failed to create user", http.StatusInternalServerError)
-		return
-	}
-
-	// Fetch the newly created user
-	data, _, err = db.Client.From("users").Select("*", "", false).Eq("user_id", userId).Execute()
-	if err != nil {
-		http.Error(w, "Failed to fetch created user", http.StatusInternalServerError)
-		return
-	}
-	var insertedUsers []models.User
-	if err := json.Unmarshal(data, &insertedUsers); err != nil {
-		http.Error(w, "Failed to parse database response", http.StatusInternalServerError)
-		return
+	user := &models.User{
+		Username: req.Username,
+		UserID:   userId,
+		HashPass: string(hashedPassword),
+		From:     "web",
+		ChatID:   userId,
+		Email:    req.Email,
+		IP:       ip,
+		Role:     auth.RoleUser,
 	}
 
-	if len(insertedUsers) == 0 {
-		http.Error(w, "Failed to fetch created user", http.StatusInternalServerError)
+	if err := users.Create(user); err != nil {
+		if err == database.ErrUserExists {
+			respondWithJSON(w, http.StatusUnprocessableEntity, AuthResponse{
+				Success: false,
+				Message: "User with this username already exists",
+			})
+			return
+		}
+		if err == database.ErrUserIDExists {
+			log.Printf("Generated user ID %s is taken", userId)
+			http.Error(w, "Failed to create user, try again", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Insert error: %v", err)
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
 		return
 	}
 
-	token, err := generateToken(insertedUsers[0])
-	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
-		return
+	if err := sendVerificationEmail(user); err != nil {
+		// The user can ask for another one
+		log.Printf("Error sending verification email: %v", err)
 	}
 
-	respondWithJSON(w, http.StatusOK, AuthResponse{
-		Success: true,
-		Token:   token,
-	})
+	respondWithTokens(w, *user)
 }
 
 func Login(w http.ResponseWriter, r *http.Request) {
@@ -200,48 +277,98 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db := database.GetDB()
-
-	data, _, err := db.Client.From("users").Select("*", "", false).Eq("username", req.Username).Execute()
+	ip := clientIP(r)
+	status, err := auth.CheckLogin(req.Username, ip)
 	if err != nil {
-		respondWithJSON(w, http.StatusUnauthorized, AuthResponse{
+		log.Printf("Error checking login attempts: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if status.Locked() {
+		audit.Record(models.AuditEvent{Type: models.AuditLoginBlocked, Username: req.Username, IP: ip})
+		w.Header().Set("Retry-After", strconv.Itoa(int(status.RetryAfter.Seconds())+1))
+		respondWithJSON(w, http.StatusTooManyRequests, AuthResponse{
 			Success: false,
-			Message: "Invalid credentials",
+			Message: "Too many failed login attempts, try again later",
 		})
 		return
 	}
+	if status.CaptchaRequired {
+		ok := false
+		if req.CaptchaToken != "" {
+			ok, err = auth.VerifyCaptcha(req.CaptchaToken, ip)
+			if err != nil {
+				log.Printf("Error verifying CAPTCHA: %v", err)
+				http.Error(w, "CAPTCHA verification failed", http.StatusBadGateway)
+				return
+			}
+			if !ok {
+				loginFailed(w, req.Username, ip, models.AuditCaptchaFailed)
+				return
+			}
+		}
+		if !ok {
+			respondWithJSON(w, http.StatusUnauthorized, AuthResponse{
+				Success:         false,
+				Message:         "CAPTCHA required",
+				CaptchaRequired: true,
+			})
+			return
+		}
+	}
 
-	var users []models.User
-	if err := json.Unmarshal(data, &users); err != nil {
-		http.Error(w, "Failed to parse database response", http.StatusInternalServerError)
+	users, err := database.GetUsers()
+	if err != nil {
+		log.Printf("Error opening user store: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
-
-	if len(users) == 0 {
-		respondWithJSON(w, http.StatusUnauthorized, AuthResponse{
-			Success: false,
-			Message: "Invalid credentials",
-		})
+	user, err := users.FindByUsername(req.Username)
+	if err == database.ErrUserNotFound {
+		loginFailed(w, req.Username, ip, models.AuditLoginFailed)
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up user: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
-	user := users[0]
 	if err := bcrypt.CompareHashAndPassword([]byte(user.HashPass), []byte(req.Password)); err != nil {
-		respondWithJSON(w, http.StatusUnauthorized, AuthResponse{
-			Success: false,
-			Message: "Invalid credentials",
-		})
+		loginFailed(w, req.Username, ip, models.AuditLoginFailed)
 		return
 	}
 
-	token, err := generateToken(user)
+	if err := auth.RecordLoginSuccess(req.Username, user.UserID, ip); err != nil {
+		log.Printf("Error clearing login attempts: %v", err)
+	}
+	respondWithTokens(w, *user)
+}
+
+// loginFailed counts a failed login and responds to it. Unknown usernames
+// are counted too so responses do not reveal which ones exist.
+func loginFailed(w http.ResponseWriter, username, ip, event string) {
+	status, err := auth.RecordLoginFailure(username, ip, event)
 	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
-		return
+		log.Printf("Error recording failed login: %v", err)
 	}
+	respondWithJSON(w, http.StatusUnauthorized, AuthResponse{
+		Success:         false,
+		Message:         "Invalid credentials",
+		CaptchaRequired: status.CaptchaRequired,
+	})
+}
 
-	respondWithJSON(w, http.StatusOK, AuthResponse{
-		Success: true,
-		Token:   token,
+// allowAccountRequest applies the per-IP limit on account requests, writing
+// the response when it is exceeded
+func allowAccountRequest(w http.ResponseWriter, ip string) bool {
+	if auth.AllowAccountRequest(ip) {
+		return true
+	}
+	w.Header().Set("Retry-After", "60")
+	respondWithJSON(w, http.StatusTooManyRequests, AuthResponse{
+		Success: false,
+		Message: "Too many requests, try again later",
 	})
+	return false
 }
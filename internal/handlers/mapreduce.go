@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"web-scraper/internal/ai"
+	"web-scraper/internal/config"
+	"web-scraper/internal/handlersArgs"
+	"web-scraper/internal/models"
+	"web-scraper/internal/packer"
+	"web-scraper/internal/prompts"
+)
+
+const notRelevant = "NOT RELEVANT"
+
+// summarizePage runs the map step for a single result using the cheap model
+func summarizePage(ctx context.Context, provider ai.Provider, req summaryRequest, result models.SearchResult) (string, ai.Usage, error) {
+	model := config.Config.CheapModels[provider.Name()]
+	packed := packer.Pack(req.Query, []models.SearchResult{result}, packer.Options{
+		Budget:    config.Config.MapPageTokens,
+		Tokenizer: packer.ForModel(model),
+	})
+
+	registry, err := prompts.GetRegistry()
+	if err != nil {
+		return "", ai.Usage{}, err
+	}
+	prompt, err := registry.Render(prompts.MapTemplate, req.promptData(packed.Results))
+	if err != nil {
+		return "", ai.Usage{}, err
+	}
+
+	resp, err := provider.Complete(ctx, ai.CompletionRequest{
+		Model: model,
+		Messages: []ai.Message{
+			{Role: "user", Content: prompt},
+		},
+		MaxTokens: config.Config.MapSummaryTokens,
+	})
+	if err != nil {
+		return "", ai.Usage{}, err
+	}
+
+	summary := strings.TrimSpace(resp.Content)
+	if strings.HasPrefix(summary, notRelevant) {
+		summary = ""
+	}
+	return summary, resp.Usage, nil
+}
+
+// getMapReduceResults summarizes every page independently and in parallel,
+// stores the summaries on the results and then synthesizes them into one
+// cited answer with the requested style
+func getMapReduceResults(req summaryRequest, results []models.SearchResult) (string, *models.TokenUsage, error) {
+	provider := handlersArgs.GetAIProvider()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	usage := &models.TokenUsage{
+		ContextLimit: config.Config.ContextTokenLimits[provider.Name()],
+	}
+
+	// Map
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		sem = make(chan struct{}, max(config.Config.MapConcurrency, 1))
+	)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			summary, pageUsage, err := summarizePage(ctx, provider, req, results[i])
+			if err != nil {
+				log.Printf("Error summarizing %s: %v", results[i].Link, err)
+				return
+			}
+
+			mu.Lock()
+			results[i].Summary = summary
+			usage.PromptTokens += pageUsage.PromptTokens
+			usage.CompletionTokens += pageUsage.CompletionTokens
+			usage.TotalTokens += pageUsage.TotalTokens
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	// Reduce
+	var summaries []packer.PackedResult
+	for i, result := range results {
+		if result.Summary == "" {
+			continue
+		}
+		summaries = append(summaries, packer.PackedResult{SearchResult: result, Rank: i + 1})
+	}
+	if len(summaries) == 0 {
+		if ctx.Err() != nil {
+			return "", usage, fmt.Errorf("AI processing timed out")
+		}
+		return "", usage, fmt.Errorf("no relevant page summaries to synthesize")
+	}
+	registry, err := prompts.GetRegistry()
+	if err != nil {
+		return "", usage, err
+	}
+	prompt, err := registry.Render(req.Style, req.promptData(summaries))
+	if err != nil {
+		return "", usage, err
+	}
+	usage.ContextTokens = packer.ForModel(provider.Model()).Count(prompt)
+
+	resp, err := provider.Complete(ctx, ai.CompletionRequest{
+		Messages: []ai.Message{
+			{Role: "user", Content: prompt},
+		},
+		MaxTokens: config.Config.MaxCompletionTokens,
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", usage, fmt.Errorf("AI processing timed out")
+		}
+		return "", usage, err
+	}
+
+	usage.PromptTokens += resp.Usage.PromptTokens
+	usage.CompletionTokens += resp.Usage.CompletionTokens
+	usage.TotalTokens += resp.Usage.TotalTokens
+	log.Printf("Map-reduce summarized %d/%d pages using %d tokens", len(summaries), len(results), usage.TotalTokens)
+	return resp.Content, usage, nil
+}
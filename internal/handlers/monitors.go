@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"web-scraper/internal/auth"
+	"web-scraper/internal/config"
+	"web-scraper/internal/handlersArgs"
+	"web-scraper/internal/middleware"
+	"web-scraper/internal/models"
+	"web-scraper/internal/monitors"
+	"web-scraper/internal/prompts"
+	"web-scraper/internal/search"
+)
+
+const defaultMonitorRuns = 20
+
+type MonitorRequest struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+	// Engines defaults to DuckDuckGo
+	Engines []string `json:"engines"`
+	// Schedule is a cron expression such as "0 9 * * 1-5" or a descriptor
+	// such as "@daily", in server local time unless prefixed "CRON_TZ=..."
+	Schedule   string `json:"schedule"`
+	Deep       bool   `json:"deep"`
+	WebhookURL string `json:"webhook_url,omitempty"`
+	Paused     bool   `json:"paused"`
+}
+
+// apply validates the request and copies it onto the monitor. A monitor
+// given its first webhook gets a secret to sign the alerts with.
+func (req MonitorRequest) apply(monitor *models.Monitor) error {
+	req.Query = strings.TrimSpace(req.Query)
+	if req.Query == "" {
+		return fmt.Errorf("Missing query")
+	}
+	if len(req.Engines) == 0 {
+		req.Engines = []string{"duckduckgo"}
+	}
+	for i, name := range req.Engines {
+		if _, ok := search.EngineByName(name); !ok {
+			return fmt.Errorf("Unknown engine %q, expected duckduckgo, bing or google", name)
+		}
+		req.Engines[i] = strings.ToLower(strings.TrimSpace(name))
+	}
+	if _, err := monitors.ParseSchedule(req.Schedule, config.Config.MonitorMinInterval); err != nil {
+		return err
+	}
+	if err := validateWebhookURL(req.WebhookURL, "webhook_url"); err != nil {
+		return err
+	}
+
+	monitor.Name = strings.TrimSpace(req.Name)
+	if monitor.Name == "" {
+		monitor.Name = req.Query
+	}
+	monitor.Query = req.Query
+	monitor.Engines = req.Engines
+	monitor.Schedule = req.Schedule
+	monitor.Deep = req.Deep
+	monitor.WebhookURL = req.WebhookURL
+	if monitor.WebhookURL != "" && monitor.WebhookSecret == "" {
+		monitor.WebhookSecret = auth.RandomToken()
+	}
+	monitor.Paused = req.Paused
+	return nil
+}
+
+// CreateMonitorHandler saves a monitor and schedules its runs
+func CreateMonitorHandler(w http.ResponseWriter, r *http.Request) {
+	var req MonitorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	monitor := &models.Monitor{UserID: userID}
+	if err := req.apply(monitor); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	count, err := monitors.Count(userID)
+	if err != nil {
+		log.Printf("Error counting monitors: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if count >= config.Config.MonitorMaxPerUser {
+		http.Error(w, fmt.Sprintf("Monitor limit of %d reached", config.Config.MonitorMaxPerUser), http.StatusForbidden)
+		return
+	}
+
+	if err := monitors.Create(monitor); err != nil {
+		log.Printf("Error creating monitor: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/api/monitors/"+monitor.ID)
+	respondWithJSON(w, http.StatusCreated, monitor)
+}
+
+// MonitorsHandler lists the user's monitors
+func MonitorsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	list, err := monitors.List(userID)
+	if err != nil {
+		log.Printf("Error listing monitors: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	for i := range list {
+		list[i].WebhookSecret = ""
+	}
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+// MonitorHandler returns a monitor with its next scheduled run
+func MonitorHandler(w http.ResponseWriter, r *http.Request) {
+	monitor, ok := loadMonitor(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, monitor.WithoutSecret())
+}
+
+// UpdateMonitorHandler replaces the settings of a monitor
+func UpdateMonitorHandler(w http.ResponseWriter, r *http.Request) {
+	var req MonitorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var (
+		invalid   error
+		newSecret bool
+	)
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	monitor, found, err := monitors.Update(r.PathValue("id"), userID, func(monitor *models.Monitor) error {
+		hadSecret := monitor.WebhookSecret != ""
+		invalid = req.apply(monitor)
+		newSecret = !hadSecret && monitor.WebhookSecret != ""
+		return invalid
+	})
+	switch {
+	case !found && err == nil:
+		http.Error(w, "Monitor not found", http.StatusNotFound)
+	case invalid != nil:
+		http.Error(w, invalid.Error(), http.StatusBadRequest)
+	case err != nil:
+		log.Printf("Error updating monitor: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	case newSecret:
+		// Shown once, like on creation
+		respondWithJSON(w, http.StatusOK, monitor)
+	default:
+		respondWithJSON(w, http.StatusOK, monitor.WithoutSecret())
+	}
+}
+
+// DeleteMonitorHandler removes a monitor and its run history
+func DeleteMonitorHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	found, err := monitors.Delete(r.PathValue("id"), userID)
+	if err != nil {
+		log.Printf("Error deleting monitor: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Monitor not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MonitorRunsHandler returns the latest runs of a monitor, newest first
+func MonitorRunsHandler(w http.ResponseWriter, r *http.Request) {
+	monitor, ok := loadMonitor(w, r)
+	if !ok {
+		return
+	}
+
+	limit := defaultMonitorRuns
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	runs, err := monitors.Runs(monitor.ID, limit)
+	if err != nil {
+		log.Printf("Error loading monitor runs: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, runs)
+}
+
+// RunMonitorHandler runs a monitor immediately and returns the run
+func RunMonitorHandler(w http.ResponseWriter, r *http.Request) {
+	// Limitation
+	var limiter = handlersArgs.GetLimiter()
+	if !limiter.Allow() {
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	monitor, ok := loadMonitor(w, r)
+	if !ok {
+		return
+	}
+
+	// A deep search and the webhook retries can outlast the server write
+	// timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(5 * time.Minute)); err != nil {
+		log.Printf("Error extending write deadline: %v", err)
+	}
+
+	run, err := monitors.RunNow(monitor.ID)
+	if err == monitors.ErrRunning {
+		http.Error(w, "Monitor is already running", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error running monitor: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, run)
+}
+
+func loadMonitor(w http.ResponseWriter, r *http.Request) (*models.Monitor, bool) {
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	monitor, found, err := monitors.Get(r.PathValue("id"), userID)
+	if err != nil {
+		log.Printf("Error loading monitor: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !found {
+		http.Error(w, "Monitor not found", http.StatusNotFound)
+		return nil, false
+	}
+	return monitor, true
+}
+
+// SearchMonitor runs the search of a monitor; it is the searcher of the
+// monitor scheduler
+func SearchMonitor(monitor *models.Monitor) ([]models.SearchResult, error) {
+	var engines []search.SearchEngine
+	for _, name := range monitor.Engines {
+		engine, ok := search.EngineByName(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown engine %q", name)
+		}
+		engines = append(engines, engine)
+	}
+	if len(engines) == 0 {
+		engines = defaultEngines()
+	}
+	return runQueries(engines, []string{monitor.Query}, monitor.Deep), nil
+}
+
+// SummarizeMonitorChanges writes the "what's new" summary of a monitor run
+func SummarizeMonitorChanges(monitor *models.Monitor, changes models.MonitorChanges, results []models.SearchResult) (string, *models.TokenUsage, error) {
+	var dropped []string
+	for _, result := range changes.Dropped {
+		dropped = append(dropped, fmt.Sprintf("- %s (%s)", result.Title, result.Link))
+	}
+
+	return getAIResults(summaryRequest{
+		Query: monitor.Query,
+		Style: prompts.MonitorTemplate,
+		Metadata: map[string]string{
+			"new_count":     strconv.Itoa(len(changes.New)),
+			"changed_count": strconv.Itoa(len(changes.Changed)),
+			"dropped":       strings.Join(dropped, "\n"),
+		},
+	}, results)
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"web-scraper/internal/audit"
+	"web-scraper/internal/auth"
+	"web-scraper/internal/config"
+	"web-scraper/internal/database"
+	"web-scraper/internal/models"
+)
+
+// Cookie binding a sign-on to the browser that started it
+const oidcStateCookie = "oidc_state"
+
+var (
+	errNoAccount    = errors.New("no account for this identity")
+	errEmailInUse   = errors.New("an account with this email exists; sign in with its password")
+	usernameInvalid = regexp.MustCompile(`[^a-z0-9._-]+`)
+)
+
+// OIDCLoginHandler sends the user to the identity provider to sign in
+func OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if !auth.OIDCEnabled() {
+		http.Error(w, "Single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+
+	authURL, state, err := auth.OIDCAuthURL()
+	if err != nil {
+		log.Printf("Error starting sign-on: %v", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+	// The callback only accepts the state from the browser holding this
+	// cookie, so a victim cannot be signed in to an attacker's account
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc",
+		MaxAge:   int(auth.OIDCStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallbackHandler finishes a sign-on: it finds, links or creates the
+// user of the identity and issues the service's own tokens
+func OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if !auth.OIDCEnabled() {
+		http.Error(w, "Single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if reason := query.Get("error"); reason != "" {
+		if description := query.Get("error_description"); description != "" {
+			reason += ": " + description
+		}
+		respondWithJSON(w, http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Message: "Sign-on failed: " + reason,
+		})
+		return
+	}
+
+	state := query.Get("state")
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/api/auth/oidc",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		respondWithJSON(w, http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Message: "Sign-on was not started from this browser, start again",
+		})
+		return
+	}
+
+	identity, err := auth.OIDCExchange(r.Context(), state, query.Get("code"))
+	if err == auth.ErrInvalidToken {
+		respondWithJSON(w, http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Message: "Invalid or expired sign-on, start again",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error finishing sign-on: %v", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	if !allowedDomain(identity) {
+		respondWithJSON(w, http.StatusForbidden, AuthResponse{
+			Success: false,
+			Message: "Sign-on is not open to this email domain",
+		})
+		return
+	}
+
+	user, err := oidcUser(identity, clientIP(r))
+	switch err {
+	case nil:
+	case errNoAccount:
+		respondWithJSON(w, http.StatusForbidden, AuthResponse{Success: false, Message: "No account for this identity"})
+		return
+	case errEmailInUse:
+		respondWithJSON(w, http.StatusConflict, AuthResponse{Success: false, Message: err.Error()})
+		return
+	default:
+		log.Printf("Error signing on user: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if config.Config.OIDCSuccessURL == "" {
+		respondWithTokens(w, *user)
+		return
+	}
+
+	// Hand the tokens to the front-end in the fragment, which browsers do
+	// not send to servers
+	tokens, err := auth.IssueTokens(*user)
+	if err != nil {
+		log.Printf("Error issuing tokens: %v", err)
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	fragment := url.Values{
+		"token":         {tokens.AccessToken},
+		"refresh_token": {tokens.RefreshToken},
+		"expires_in":    {strconv.Itoa(tokens.ExpiresIn)},
+	}
+	http.Redirect(w, r, config.Config.OIDCSuccessURL+"#"+fragment.Encode(), http.StatusFound)
+}
+
+// allowedDomain checks the identity's email against OIDC_ALLOWED_DOMAINS
+func allowedDomain(identity *auth.OIDCIdentity) bool {
+	if strings.TrimSpace(config.Config.OIDCAllowedDomains) == "" {
+		return true
+	}
+	at := strings.LastIndex(identity.Email, "@")
+	if !identity.EmailVerified || at < 0 {
+		return false
+	}
+	domain := strings.ToLower(identity.Email[at+1:])
+	for _, allowed := range strings.Split(config.Config.OIDCAllowedDomains, ",") {
+		if strings.ToLower(strings.TrimSpace(allowed)) == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// oidcUser returns the user linked to the identity. Otherwise the account
+// with the identity's email is linked, if both the provider and the account
+// verified the email, or a new account is created when auto-provisioning is on.
+func oidcUser(identity *auth.OIDCIdentity, ip string) (*models.User, error) {
+	users, err := database.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+	user, err := users.FindByOIDCSubject(identity.Subject)
+	if err != database.ErrUserNotFound {
+		return user, err
+	}
+
+	if identity.Email != "" {
+		user, err = users.FindByEmail(identity.Email)
+		switch {
+		case err == database.ErrUserNotFound:
+		case err != nil:
+			return nil, err
+		case !identity.EmailVerified || !user.EmailVerified || user.OIDCSubject != "":
+			// Linking on an email either side did not verify would hand over
+			// the account, or the sign-on of whoever registered it
+			return nil, errEmailInUse
+		default:
+			user.OIDCSubject = identity.Subject
+			if err := users.Update(user); err != nil {
+				return nil, err
+			}
+			audit.Record(models.AuditEvent{
+				Type:     models.AuditOIDCLinked,
+				Username: user.Username,
+				UserID:   user.UserID,
+				IP:       ip,
+				Detail:   identity.Subject,
+			})
+			return user, nil
+		}
+	}
+
+	if !config.Config.OIDCAutoProvision {
+		return nil, errNoAccount
+	}
+	return provisionUser(identity, ip)
+}
+
+// provisionUser creates an account for the identity. It has an unusable
+// random password until the user sets one with a password reset.
+func provisionUser(identity *auth.OIDCIdentity, ip string) (*models.User, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(auth.RandomToken()), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	base := identity.Username
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	base = strings.Trim(usernameInvalid.ReplaceAllString(strings.ToLower(base), "-"), "-")
+	if base == "" {
+		base = "user"
+	}
+
+	users, err := database.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 0; attempt < 5; attempt++ {
+		username := base
+		if attempt > 0 {
+			username = fmt.Sprintf("%s-%s", base, generateUserId()[:6])
+		}
+		userID := generateUserId()
+		user := &models.User{
+			Username:      username,
+			UserID:        userID,
+			HashPass:      string(hashedPassword),
+			From:          "oidc",
+			ChatID:        userID,
+			Email:         identity.Email,
+			EmailVerified: identity.EmailVerified,
+			IP:            ip,
+			Role:          auth.RoleUser,
+			OIDCSubject:   identity.Subject,
+		}
+		err := users.Create(user)
+		if err == database.ErrUserExists || err == database.ErrUserIDExists {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		audit.Record(models.AuditEvent{
+			Type:     models.AuditOIDCProvisioned,
+			Username: user.Username,
+			UserID:   user.UserID,
+			IP:       ip,
+			Detail:   identity.Subject,
+		})
+		return user, nil
+	}
+	return nil, fmt.Errorf("no free username for %q", base)
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v4"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+	"web-scraper/internal/config"
+	"web-scraper/internal/database"
+	"web-scraper/internal/models"
+	"web-scraper/internal/storage"
+)
+
+// mockIssuer is an OpenID provider serving discovery, JWKS and the token
+// endpoint. The authorization step is skipped: tests read the state, nonce
+// and PKCE challenge from the redirect and call the callback directly.
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+	verifiers []string
+}
+
+func newMockIssuer() *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	m := &mockIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("GET /jwks", m.jwks)
+	mux.HandleFunc("POST /token", m.token)
+	m.server = httptest.NewServer(mux)
+	return m
+}
+
+func (m *mockIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                m.server.URL,
+		"authorization_endpoint":                m.server.URL + "/authorize",
+		"token_endpoint":                        m.server.URL + "/token",
+		"jwks_uri":                              m.server.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (m *mockIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	encode := base64.RawURLEncoding.EncodeToString
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   encode(m.key.N.Bytes()),
+			"e":   encode(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+// token redeems any code whose PKCE verifier matches the expected challenge
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	verifier := r.PostFormValue("code_verifier")
+	m.verifiers = append(m.verifiers, verifier)
+	sum := sha256.Sum256([]byte(verifier))
+	if verifier == "" || base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   m.server.URL,
+		"aud":   config.Config.OIDCClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": m.nonce,
+	}
+	for name, value := range m.claims {
+		claims[name] = value
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = "test"
+	signed, err := idToken.SignedString(m.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     signed,
+	})
+}
+
+var issuer *mockIssuer
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "handlers-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("JWT_SECRET", "test-secret")
+	config.Config.DataDir = dir
+	config.Config.UserStore = "sqlite"
+	config.Config.SQLitePath = ""
+
+	issuer = newMockIssuer()
+	config.Config.OIDCIssuerURL = issuer.server.URL
+	config.Config.OIDCClientID = "client"
+	config.Config.OIDCClientSecret = "secret"
+	config.Config.OIDCAutoProvision = true
+	config.Config.OIDCAllowedDomains = ""
+	config.Config.OIDCSuccessURL = ""
+
+	code := m.Run()
+	issuer.server.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// signOn starts a sign-on, has the provider answer with the given ID token
+// claims and returns the callback request of the browser. nonce replaces the
+// sign-on's nonce when set.
+func signOn(t *testing.T, claims jwt.MapClaims, nonce string) *http.Request {
+	t.Helper()
+	login := httptest.NewRecorder()
+	OIDCLoginHandler(login, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil))
+	if login.Code != http.StatusFound {
+		t.Fatalf("login returned %d: %s", login.Code, login.Body)
+	}
+	location, err := url.Parse(login.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := location.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization URL has no PKCE challenge: %s", location)
+	}
+	cookies := login.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcStateCookie || !cookies[0].HttpOnly || !cookies[0].Secure {
+		t.Fatalf("unexpected state cookies %v", cookies)
+	}
+
+	issuer.mu.Lock()
+	issuer.challenge = query.Get("code_challenge")
+	issuer.nonce = query.Get("nonce")
+	if nonce != "" {
+		issuer.nonce = nonce
+	}
+	issuer.claims = claims
+	issuer.mu.Unlock()
+
+	callback := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?"+url.Values{
+		"state": {query.Get("state")},
+		"code":  {"code"},
+	}.Encode(), nil)
+	callback.AddCookie(cookies[0])
+	return callback
+}
+
+func callback(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	OIDCCallbackHandler(rec, req)
+	return rec
+}
+
+func TestOIDCProvisionsUser(t *testing.T) {
+	req := signOn(t, jwt.MapClaims{
+		"sub":                "alice-sub",
+		"email":              "alice@example.com",
+		"email_verified":     true,
+		"preferred_username": "Alice",
+	}, "")
+	rec := callback(req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback returned %d: %s", rec.Code, rec.Body)
+	}
+	var response AuthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil || response.Token == "" {
+		t.Fatalf("no token in response: %v", err)
+	}
+
+	issuer.mu.Lock()
+	verifier := issuer.verifiers[len(issuer.verifiers)-1]
+	issuer.mu.Unlock()
+	if verifier == "" {
+		t.Error("token request did not send the PKCE verifier")
+	}
+
+	users, err := database.GetUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := users.FindByOIDCSubject(issuer.server.URL + "|alice-sub")
+	if err != nil {
+		t.Fatalf("provisioned user not found: %v", err)
+	}
+	if user.Username != "alice" || !user.EmailVerified || user.From != "oidc" {
+		t.Errorf("unexpected provisioned user %+v", user)
+	}
+
+	// The same state cannot be used again
+	if rec := callback(req); rec.Code != http.StatusUnauthorized {
+		t.Errorf("reused state returned %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestOIDCRejectsNonceMismatch(t *testing.T) {
+	req := signOn(t, jwt.MapClaims{"sub": "nonce-sub", "email": "nonce@example.com"}, "other-nonce")
+	if rec := callback(req); rec.Code != http.StatusUnauthorized {
+		t.Errorf("nonce mismatch returned %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestOIDCRequiresStateCookie(t *testing.T) {
+	req := signOn(t, jwt.MapClaims{"sub": "cookie-sub"}, "")
+	req.Header.Del("Cookie")
+	if rec := callback(req); rec.Code != http.StatusUnauthorized {
+		t.Errorf("callback without cookie returned %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestOIDCLinksOnlyVerifiedEmail(t *testing.T) {
+	users, err := database.GetUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Unique per run, so the test can be repeated against the same store
+	id := storage.NewID()
+	existing := &models.User{
+		Username: "bob-" + id,
+		UserID:   id,
+		HashPass: "x",
+		Email:    "bob-" + id + "@example.com",
+		From:     "web",
+		ChatID:   id,
+	}
+	if err := users.Create(existing); err != nil {
+		t.Fatal(err)
+	}
+
+	link := func(providerVerified bool) int {
+		req := signOn(t, jwt.MapClaims{
+			"sub":            "bob-sub-" + id,
+			"email":          existing.Email,
+			"email_verified": providerVerified,
+		}, "")
+		return callback(req).Code
+	}
+
+	// Neither side verified, then only the provider did
+	for _, providerVerified := range []bool{false, true} {
+		if code := link(providerVerified); code != http.StatusConflict {
+			t.Fatalf("provider verified %v returned %d, want %d", providerVerified, code, http.StatusConflict)
+		}
+		if user, _ := users.FindByID(id); user.OIDCSubject != "" {
+			t.Fatalf("account was linked on an unverified email")
+		}
+	}
+
+	existing.EmailVerified = true
+	if err := users.Update(existing); err != nil {
+		t.Fatal(err)
+	}
+	if code := link(true); code != http.StatusOK {
+		t.Fatalf("verified email returned %d", code)
+	}
+	if user, _ := users.FindByID(id); user.OIDCSubject != issuer.server.URL+"|bob-sub-"+id {
+		t.Errorf("account was not linked, subject %q", user.OIDCSubject)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"web-scraper/internal/config"
+	"web-scraper/internal/handlersArgs"
+	"web-scraper/internal/models"
+	"web-scraper/internal/research"
+)
+
+type ResearchRequest struct {
+	Question string `json:"question"`
+	// Optional limits, capped by the server configuration
+	MaxSteps  int `json:"max_steps"`
+	MaxTokens int `json:"max_tokens"`
+}
+
+// ResearchHandler runs the research agent on a question and returns its
+// report with the sources and the trace of tool calls
+func ResearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Limitation
+	var limiter = handlersArgs.GetLimiter()
+	if !limiter.Allow() {
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	var req ResearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Question = strings.TrimSpace(req.Question)
+	if req.Question == "" {
+		http.Error(w, "Missing question", http.StatusBadRequest)
+		return
+	}
+
+	opts := research.Options{
+		MaxSteps:    capLimit(req.MaxSteps, config.Config.ResearchMaxSteps),
+		TokenBudget: capLimit(req.MaxTokens, config.Config.ResearchTokenBudget),
+		Search: func(query string) []models.SearchResult {
+			return runQueries(defaultEngines(), []string{query}, false)
+		},
+	}
+
+	// Research runs far longer than the server write timeout allows
+	timeout := config.Config.ResearchTimeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + time.Minute)); err != nil {
+		log.Printf("Error extending write deadline: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	report, err := research.Run(ctx, handlersArgs.GetAIProvider(), req.Question, opts)
+	if err != nil {
+		log.Printf("Research error: %v", err)
+		http.Error(w, aiErrorMessage, http.StatusBadGateway)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+// capLimit returns the requested limit, or the maximum when it is unset or
+// larger than the maximum
+func capLimit(requested, max int) int {
+	if requested <= 0 || requested > max {
+		return max
+	}
+	return requested
+}
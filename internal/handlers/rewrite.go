@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"web-scraper/internal/ai"
+	"web-scraper/internal/config"
+	"web-scraper/internal/handlersArgs"
+	"web-scraper/internal/prompts"
+)
+
+var rewriteSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"queries": {"type": "array", "items": {"type": "string"}}
+	},
+	"required": ["queries"]
+}`)
+
+// rewriteQuery asks the cheap model to turn a conversational question into
+// up to maxQueries keyword queries for the search engines
+func rewriteQuery(query string, maxQueries int) ([]string, ai.Usage, error) {
+	provider := handlersArgs.GetAIProvider()
+
+	registry, err := prompts.GetRegistry()
+	if err != nil {
+		return nil, ai.Usage{}, err
+	}
+	prompt, err := registry.Render(prompts.RewriteTemplate, prompts.Data{
+		Query:    query,
+		Metadata: map[string]string{"max_queries": strconv.Itoa(maxQueries)},
+		Date:     time.Now(),
+	})
+	if err != nil {
+		return nil, ai.Usage{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	resp, err := provider.Complete(ctx, ai.CompletionRequest{
+		Model: config.Config.StructuredModels[provider.Name()],
+		Messages: []ai.Message{
+			{Role: "user", Content: prompt},
+		},
+		MaxTokens: 300,
+		JSONSchema: &ai.JSONSchema{
+			Name:   "search_queries",
+			Schema: rewriteSchema,
+		},
+	})
+	if err != nil {
+		return nil, ai.Usage{}, err
+	}
+
+	var parsed struct {
+		Queries []string `json:"queries"`
+	}
+	if err := json.Unmarshal([]byte(stripCodeFence(resp.Content)), &parsed); err != nil {
+		return nil, resp.Usage, fmt.Errorf("error parsing rewritten queries: %v", err)
+	}
+
+	seen := map[string]bool{}
+	var queries []string
+	for _, q := range parsed.Queries {
+		q = strings.TrimSpace(q)
+		if q == "" || seen[strings.ToLower(q)] {
+			continue
+		}
+		seen[strings.ToLower(q)] = true
+		queries = append(queries, q)
+		if len(queries) == maxQueries {
+			break
+		}
+	}
+	if len(queries) == 0 {
+		return nil, resp.Usage, fmt.Errorf("no rewritten queries returned")
+	}
+	return queries, resp.Usage, nil
+}
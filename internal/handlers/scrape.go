@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"web-scraper/internal/ai"
+	"web-scraper/internal/cache"
+	"web-scraper/internal/fetcher"
+	"web-scraper/internal/handlersArgs"
+	"web-scraper/internal/models"
+	"web-scraper/internal/prompts"
+	"web-scraper/internal/search"
+)
+
+const (
+	// Most URLs accepted by one batch request
+	maxScrapeBatch = 10
+	// Pages of a batch fetched at the same time
+	scrapeConcurrency = 4
+)
+
+// scrapeOptions holds the parameters shared by single and batch scrapes
+type scrapeOptions struct {
+	Format   string `json:"format"`
+	Summary  bool   `json:"summary"`
+	Question string `json:"question"`
+}
+
+type ScrapeBatchRequest struct {
+	URLs []string `json:"urls"`
+	scrapeOptions
+}
+
+// ScrapeResponse is the scraped page in the search result shape, with the
+// optional summary in Summary and the answer to the question in Answer
+type ScrapeResponse struct {
+	models.SearchResult
+	Format     string             `json:"format"`
+	Question   string             `json:"question,omitempty"`
+	Answer     string             `json:"answer,omitempty"`
+	TokenUsage *models.TokenUsage `json:"token_usage,omitempty"`
+	Duration   string             `json:"duration"`
+	Error      string             `json:"error,omitempty"`
+}
+
+type ScrapeBatchResponse struct {
+	Results  []ScrapeResponse `json:"results"`
+	Duration string           `json:"duration"`
+}
+
+// ScrapeHandler scrapes known pages: GET /api/scrape?url= for one page, or a
+// POST with {"urls": [...]} for a batch
+func ScrapeHandler(w http.ResponseWriter, r *http.Request) {
+	// Limitation
+	var limiter = handlersArgs.GetLimiter()
+	if !limiter.Allow() {
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	// Set CORS headers
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+
+	switch r.Method {
+	case http.MethodGet:
+		serveScrape(w, r)
+	case http.MethodPost:
+		serveScrapeBatch(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func serveScrape(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	opts := scrapeOptions{
+		Format:   params.Get("format"),
+		Question: params.Get("question"),
+	}
+	if summary := params.Get("summary"); summary != "" {
+		enabled, err := strconv.ParseBool(summary)
+		if err != nil {
+			http.Error(w, "Invalid summary parameter", http.StatusBadRequest)
+			return
+		}
+		opts.Summary = enabled
+	}
+
+	link, err := validateScrapeURL(params.Get("url"))
+	if err == nil {
+		err = opts.validate()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := scrapeURL(link, opts)
+	if response.Error != "" && response.InnerContent == "" {
+		http.Error(w, response.Error, http.StatusBadGateway)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func serveScrapeBatch(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	var req ScrapeBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.URLs) == 0 || len(req.URLs) > maxScrapeBatch {
+		http.Error(w, fmt.Sprintf("urls must contain between 1 and %d URLs", maxScrapeBatch), http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A batch with summaries can outlast the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(2 * time.Minute)); err != nil {
+		log.Printf("Error extending write deadline: %v", err)
+	}
+
+	results := make([]ScrapeResponse, len(req.URLs))
+	sem := make(chan struct{}, scrapeConcurrency)
+	var wg sync.WaitGroup
+	for i, raw := range req.URLs {
+		link, err := validateScrapeURL(raw)
+		if err != nil {
+			results[i] = ScrapeResponse{
+				SearchResult: models.SearchResult{Link: raw},
+				Format:       req.Format,
+				Error:        err.Error(),
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = scrapeURL(link, req.scrapeOptions)
+		}()
+	}
+	wg.Wait()
+
+	respondWithJSON(w, http.StatusOK, ScrapeBatchResponse{
+		Results:  results,
+		Duration: time.Since(startTime).String(),
+	})
+}
+
+func (o *scrapeOptions) validate() error {
+	switch o.Format {
+	case "":
+		o.Format = search.FormatText
+	case search.FormatText, search.FormatMarkdown, search.FormatHTML:
+	default:
+		return fmt.Errorf("Invalid format parameter")
+	}
+	o.Question = strings.TrimSpace(o.Question)
+	return nil
+}
+
+func validateScrapeURL(raw string) (string, error) {
+	if raw == "" {
+		return "", fmt.Errorf("Missing url parameter")
+	}
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("Invalid url %q", raw)
+	}
+	if err := fetcher.CheckHost(u.Hostname()); err != nil {
+		return "", fmt.Errorf("Url host is not a public address")
+	}
+	return u.String(), nil
+}
+
+func (o scrapeOptions) cacheKey(link string) string {
+	var summary, question string
+	if o.Summary {
+		summary = "summary"
+	}
+	if o.Question != "" {
+		question = "question=" + o.Question
+	}
+	return cacheKey("scrape:"+link, "format="+o.Format, summary, question)
+}
+
+// scrapeURL fetches and extracts one page and runs the requested AI steps.
+// Responses are cached in the search cache as a one-result search.
+func scrapeURL(link string, opts scrapeOptions) ScrapeResponse {
+	key := opts.cacheKey(link)
+	if cached, found := cache.GetInstance().Get(key); found && len(cached.Results) == 1 {
+		log.Printf("Cache hit for scrape: %s", link)
+		return ScrapeResponse{
+			SearchResult: cached.Results[0],
+			Format:       opts.Format,
+			Question:     opts.Question,
+			Answer:       cached.FormattedResult,
+			TokenUsage:   cached.TokenUsage,
+			Duration:     cached.Duration,
+		}
+	}
+
+	startTime := time.Now()
+	response := ScrapeResponse{
+		SearchResult: models.SearchResult{Link: link, Source: "Scrape"},
+		Format:       opts.Format,
+		Question:     opts.Question,
+	}
+
+	page, err := search.ScrapePage(link, opts.Format)
+	if err != nil {
+		log.Printf("Error scraping %s: %v", link, err)
+		response.Error = "Error scraping page: " + err.Error()
+		response.Duration = time.Since(startTime).String()
+		return response
+	}
+	response.Title = page.Title
+	response.Snippet = page.Metadata["description"]
+	response.InnerContent = page.Content
+	response.Metadata = page.Metadata
+
+	if opts.Summary {
+		summary, usage, err := summarizeScrape(response.SearchResult, "")
+		if err != nil {
+			log.Printf("AI error: %v", err)
+			response.Error = aiErrorMessage
+		}
+		response.Summary = summary
+		response.TokenUsage = usage
+	}
+	if opts.Question != "" {
+		answer, usage, err := summarizeScrape(response.SearchResult, opts.Question)
+		if err != nil {
+			log.Printf("AI error: %v", err)
+			response.Error = aiErrorMessage
+		}
+		response.Answer = answer
+		if response.TokenUsage == nil {
+			response.TokenUsage = usage
+		} else if usage != nil {
+			response.TokenUsage = addUsage(response.TokenUsage, ai.Usage{
+				PromptTokens:     usage.PromptTokens,
+				CompletionTokens: usage.CompletionTokens,
+				TotalTokens:      usage.TotalTokens,
+			})
+		}
+	}
+	response.Duration = time.Since(startTime).String()
+
+	if response.Error == "" {
+		err := cache.GetInstance().Set(key, models.SearchResponse{
+			Query:           link,
+			Results:         []models.SearchResult{response.SearchResult},
+			FormattedResult: response.Answer,
+			TokenUsage:      response.TokenUsage,
+			Duration:        response.Duration,
+		})
+		if err != nil {
+			log.Printf("Error caching response: %v", err)
+		}
+	}
+	return response
+}
+
+// summarizeScrape summarizes the page, or answers the question about it
+func summarizeScrape(result models.SearchResult, question string) (string, *models.TokenUsage, error) {
+	return getAIResults(summaryRequest{
+		Query: question,
+		Style: prompts.ScrapeTemplate,
+		Metadata: map[string]string{
+			"type": "scrape",
+		},
+	}, []models.SearchResult{result})
+}
@@ -1,179 +1,159 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
-	"web-scraper/internal/cache"
+	"web-scraper/internal/ai"
+	"web-scraper/internal/config"
 	"web-scraper/internal/handlersArgs"
 	"web-scraper/internal/models"
+	"web-scraper/internal/packer"
+	"web-scraper/internal/prompts"
 	"web-scraper/internal/search"
 )
 
 func SearchDeepHandler(w http.ResponseWriter, r *http.Request) {
-	// Limitation
-	var limiter = handlersArgs.GetLimiter()
-	if !limiter.Allow() {
-		http.Error(w, "Too many requests", http.StatusTooManyRequests)
-		return
-	}
-
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET")
-	w.Header().Set("Content-Type", "application/json")
+	serveSearch(w, r, true)
+}
 
-	query := r.URL.Query().Get("search")
-	if query == "" {
-		http.Error(w, "Missing search parameter", http.StatusBadRequest)
-		return
+// cacheKey builds the cache key for a query and the options that change the
+// response. Options left at their defaults keep the plain query as key.
+func cacheKey(query string, options ...string) string {
+	key := query
+	for _, option := range options {
+		if option != "" {
+			key += "|" + option
+		}
 	}
+	return key
+}
 
-	// Check cache
-	if cached, found := cache.GetInstance().Get(query); found {
-		log.Printf("Cache hit for query: %s", query)
-		err := json.NewEncoder(w).Encode(cached)
-		if err != nil {
-			log.Printf("Error encoding cached response: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-		}
-		return
+// styleOption keeps the default style out of the cache key
+func styleOption(style string) string {
+	if style == config.Config.DefaultPromptStyle {
+		return ""
 	}
+	return "style=" + style
+}
 
-	// Perform search
-	startTime := time.Now()
+// searchMetadata describes the search for prompt templates
+func searchMetadata(engines []search.SearchEngine, metadata map[string]string) map[string]string {
+	metadata["engines"] = strings.Join(engineNames(engines), ", ")
+	return metadata
+}
 
-	// Create search engines
-	searchEngines := []search.SearchEngine{
-		&search.DuckDuckGoSearch{},
+func engineNames(engines []search.SearchEngine) []string {
+	var names []string
+	for _, engine := range engines {
+		names = append(names, engine.GetName())
 	}
+	return names
+}
 
-	// Create channels for results and errors
-	resultsChan := make(chan []models.SearchResult, len(searchEngines))
-	errorsChan := make(chan error, len(searchEngines))
-
-	// Create wait group
-	var wg sync.WaitGroup
-
-	// Launch searches in parallel
-	for _, engine := range searchEngines {
-		wg.Add(1)
-		go func(e search.SearchEngine) {
-			defer wg.Done()
-			log.Println("Searching engine:", engine.GetName())
-			log.Println("Searching query:", query)
-			results, err := e.DeepSearch(query)
-			if err != nil {
-				errorsChan <- err
-				return
-			}
-			resultsChan <- results
-		}(engine)
+// addUsage adds the tokens of an extra AI call to the reported usage
+func addUsage(total *models.TokenUsage, usage ai.Usage) *models.TokenUsage {
+	if usage.TotalTokens == 0 {
+		return total
 	}
-
-	// Wait for all searches to complete in a separate goroutine
-	go func() {
-		wg.Wait()
-		close(resultsChan)
-		close(errorsChan)
-	}()
-
-	// Collect all results
-	var allResults []models.SearchResult
-	for results := range resultsChan {
-		allResults = append(allResults, results...)
+	if total == nil {
+		total = &models.TokenUsage{}
 	}
+	total.PromptTokens += usage.PromptTokens
+	total.CompletionTokens += usage.CompletionTokens
+	total.TotalTokens += usage.TotalTokens
+	return total
+}
+
+// summaryRequest carries what the AI step needs besides the results
+type summaryRequest struct {
+	Query    string
+	Style    string
+	Metadata map[string]string
+	History  []models.SessionTurn
+}
 
-	// Check for errors
-	for err := range errorsChan {
-		log.Printf("Search error: %v", err)
+func (sr summaryRequest) promptData(results []packer.PackedResult) prompts.Data {
+	return prompts.Data{
+		Query:    sr.Query,
+		Results:  results,
+		Metadata: sr.Metadata,
+		Date:     time.Now(),
+		History:  sr.History,
 	}
+}
+
+// Fewest context tokens left for results before a prompt is refused
+const minResultTokens = 512
 
-	// Process with OpenAI
-	openAIResult, err := getOpenAIResults(query, allResults)
+// buildPrompt renders the style template with as much of the results as fits
+// into the provider context window, leaving room for the completion
+func buildPrompt(provider ai.Provider, req summaryRequest, results []models.SearchResult) (string, packer.Packed, error) {
+	registry, err := prompts.GetRegistry()
 	if err != nil {
-		log.Printf("OpenAI error: %v", err)
-		openAIResult = "Error processing results with AI"
+		return "", packer.Packed{}, err
 	}
+	tokenizer := packer.ForModel(provider.Model())
 
-	// Create response
-	response := models.SearchResponse{
-		Query:           query,
-		Results:         allResults,
-		FormattedResult: openAIResult,
-		Duration:        time.Since(startTime).String(),
+	// Render without results to measure the template overhead
+	empty, err := registry.Render(req.Style, req.promptData(nil))
+	if err != nil {
+		return "", packer.Packed{}, err
 	}
 
-	// Store in cache
-	err1 := cache.GetInstance().Set(query, response)
-	if err1 != nil {
-		log.Printf("Error caching response: %v", err1)
+	limit := config.Config.ContextTokenLimits[provider.Name()]
+	reserved := config.Config.MaxCompletionTokens + tokenizer.Count(empty)
+	budget := limit - reserved
+	if budget < minResultTokens {
+		return "", packer.Packed{}, fmt.Errorf("context window of %d tokens leaves %d for results after the prompt and completion; lower MAX_COMPLETION_TOKENS", limit, budget)
 	}
 
-	// Send response
-	err = json.NewEncoder(w).Encode(response)
+	packed := packer.Pack(req.Query, results, packer.Options{
+		Budget:    budget,
+		Tokenizer: tokenizer,
+	})
+	log.Printf("Packed %d/%d results into %d/%d context tokens", len(packed.Results), len(results), packed.Tokens, packed.Budget)
+
+	prompt, err := registry.Render(req.Style, req.promptData(packed.Results))
 	if err != nil {
-		log.Printf("Error encoding response: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return "", packer.Packed{}, err
 	}
+	return prompt, packed, nil
 }
 
-func formatSearchResultsForAI(query string, results []models.SearchResult) string {
-	var formattedText strings.Builder
-
-	// Add the query
-	formattedText.WriteString(fmt.Sprintf("Search Query: %s\n\n", query))
-
-	// Add search results
-	formattedText.WriteString("Search Results:\n")
-	for _, result := range results {
-		formattedText.WriteString(fmt.Sprintf("\nTitle: %s\n", result.Title))
-		formattedText.WriteString(fmt.Sprintf("URL: %s\n", result.Link))
-		formattedText.WriteString(fmt.Sprintf("Description: %s\n", result.Snippet))
-		formattedText.WriteString(fmt.Sprintf("PageContent: %s\n", result.InnerContent))
+func getAIResults(req summaryRequest, results []models.SearchResult) (string, *models.TokenUsage, error) {
+	provider := handlersArgs.GetAIProvider()
+	prompt, packed, err := buildPrompt(provider, req, results)
+	if err != nil {
+		return "", nil, err
 	}
 
-	// Add instructions
-	formattedText.WriteString(`
-		Instructions:
-		You are tasked with generating a response based on the search results from a given query. The goal is to summarize the key information and insights from the search results in a clear and concise manner.
-		1. Review the search results and identify the most relevant and important information.
-		2. Summarize the key points and insights from the search results.
-		3. Provide a brief overview of the main topics and themes covered in the search results.
-		3. Use simple, straightforward language that is easy to understand.
-		4. Avoid repeating information or including unnecessary details.
-		5. Keep the response concise and focused on the main points.
-		7. Attach links to the original sources of information under each point.
-	`)
-
-	return formattedText.String()
-}
-
-func getOpenAIResults(query string, results []models.SearchResult) (string, error) {
-	resultChan := make(chan string, 1)
-	errChan := make(chan error, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-	go func() {
-		var openAIClient = handlersArgs.GetOpenAiClient()
-		result, err := openAIClient.FormatResults(formatSearchResultsForAI(query, results))
-		if err != nil {
-			errChan <- err
-			return
+	resp, err := provider.Complete(ctx, ai.CompletionRequest{
+		Messages: []ai.Message{
+			{Role: "user", Content: prompt},
+		},
+		MaxTokens: config.Config.MaxCompletionTokens,
+	})
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", nil, fmt.Errorf("AI processing timed out")
 		}
-		resultChan <- result
-	}()
-
-	select {
-	case err := <-errChan:
-		return "", err
-	case result := <-resultChan:
-		return result, nil
-	case <-time.After(30 * time.Second):
-		return "", fmt.Errorf("AI processing timed out")
+		return "", nil, err
+	}
+
+	usage := &models.TokenUsage{
+		ContextTokens:    packed.Tokens,
+		ContextLimit:     config.Config.ContextTokenLimits[provider.Name()],
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+		TotalTokens:      resp.Usage.TotalTokens,
 	}
+	return resp.Content, usage, nil
 }
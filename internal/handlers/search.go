@@ -1,18 +1,197 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"web-scraper/internal/ai"
 	"web-scraper/internal/cache"
+	"web-scraper/internal/config"
 	"web-scraper/internal/handlersArgs"
+	"web-scraper/internal/middleware"
 	"web-scraper/internal/models"
+	"web-scraper/internal/prompts"
+	"web-scraper/internal/rerank"
+	"web-scraper/internal/schemas"
 	"web-scraper/internal/search"
 )
 
+// Largest custom JSON schema accepted in a request body
+const maxSchemaBytes = 64 * 1024
+
+// FormattedResult of a search whose AI step failed
+const aiErrorMessage = "Error processing results with AI"
+
+// searchOptions holds the request parameters shared by the search handlers
+type searchOptions struct {
+	Query  string
+	Deep   bool
+	Mode   string
+	Style  string
+	Output string
+	Schema *schemas.Schema
+	// Rewrite expands the query into up to MaxQueries engine queries
+	Rewrite    bool
+	MaxQueries int
+	// Rerank orders the results by semantic similarity to the query
+	Rerank bool
+}
+
 func SearchHandler(w http.ResponseWriter, r *http.Request) {
+	serveSearch(w, r, false)
+}
+
+// parseSearchOptions reads and validates the search parameters. With
+// output=json the schema is either a registered name or, for POST requests,
+// a JSON Schema sent as the request body.
+func parseSearchOptions(r *http.Request, deep bool) (searchOptions, error) {
+	return parseSearchParams(r.URL.Query(), deep, func() ([]byte, error) {
+		if r.Method != http.MethodPost {
+			return nil, fmt.Errorf("Missing schema parameter")
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxSchemaBytes))
+		if err != nil {
+			return nil, fmt.Errorf("Error reading schema: %v", err)
+		}
+		return body, nil
+	})
+}
+
+// parseSearchParams validates search parameters; customSchema supplies the
+// JSON Schema for output=json when no registered schema is named
+func parseSearchParams(params url.Values, deep bool, customSchema func() ([]byte, error)) (searchOptions, error) {
+	opts := searchOptions{
+		Query:  params.Get("search"),
+		Deep:   deep,
+		Mode:   params.Get("mode"),
+		Style:  params.Get("style"),
+		Output: params.Get("output"),
+	}
+
+	if opts.Query == "" {
+		return opts, fmt.Errorf("Missing search parameter")
+	}
+
+	// Summarization mode: "single" (default) packs every page into one
+	// prompt, "mapreduce" summarizes pages independently first
+	if opts.Mode == "single" {
+		opts.Mode = ""
+	}
+	if opts.Mode != "" && (opts.Mode != "mapreduce" || !deep) {
+		return opts, fmt.Errorf("Invalid mode parameter")
+	}
+
+	if opts.Style == "" {
+		opts.Style = config.Config.DefaultPromptStyle
+	}
+	registry, err := prompts.GetRegistry()
+	if err != nil {
+		return opts, err
+	}
+	if !registry.HasStyle(opts.Style) {
+		return opts, fmt.Errorf("Invalid style parameter")
+	}
+
+	if rewrite := params.Get("rewrite"); rewrite != "" {
+		enabled, err := strconv.ParseBool(rewrite)
+		if err != nil {
+			return opts, fmt.Errorf("Invalid rewrite parameter")
+		}
+		opts.Rewrite = enabled
+	}
+	if opts.Rewrite {
+		opts.MaxQueries = config.Config.MaxRewriteQueries
+		if maxQueries := params.Get("max_queries"); maxQueries != "" {
+			n, err := strconv.Atoi(maxQueries)
+			if err != nil || n < 1 || n > config.Config.MaxRewriteQueries {
+				return opts, fmt.Errorf("max_queries must be between 1 and %d", config.Config.MaxRewriteQueries)
+			}
+			opts.MaxQueries = n
+		}
+	}
+
+	if rerank := params.Get("rerank"); rerank != "" {
+		enabled, err := strconv.ParseBool(rerank)
+		if err != nil {
+			return opts, fmt.Errorf("Invalid rerank parameter")
+		}
+		opts.Rerank = enabled
+	}
+
+	switch opts.Output {
+	case "", "markdown":
+		opts.Output = ""
+	case "json":
+		if opts.Mode != "" {
+			return opts, fmt.Errorf("Mode %s is not supported with JSON output", opts.Mode)
+		}
+		schema, err := requestSchema(params, customSchema)
+		if err != nil {
+			return opts, err
+		}
+		opts.Schema = schema
+	default:
+		return opts, fmt.Errorf("Invalid output parameter")
+	}
+
+	return opts, nil
+}
+
+func requestSchema(params url.Values, customSchema func() ([]byte, error)) (*schemas.Schema, error) {
+	if name := params.Get("schema"); name != "" {
+		schema, ok := schemas.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("Unknown schema %q, registered schemas: %v", name, schemas.Names())
+		}
+		return schema, nil
+	}
+
+	body, err := customSchema()
+	if err != nil {
+		return nil, err
+	}
+	return schemas.ParseCustom(body)
+}
+
+func (o searchOptions) cacheKey() string {
+	var output string
+	if o.Schema != nil {
+		output = "schema=" + o.Schema.Name
+	}
+	var rewrite string
+	if o.Rewrite {
+		rewrite = "rewrite=" + strconv.Itoa(o.MaxQueries)
+	}
+	var rerank string
+	if o.Rerank {
+		rerank = "rerank"
+	}
+	return cacheKey(o.Query, o.Mode, styleOption(o.Style), output, rewrite, rerank)
+}
+
+// SearchForUser runs a search with the default options on behalf of the
+// user, as the search endpoints would; it is the searcher of the chat bot
+func SearchForUser(userID, query string, deep bool) (*models.SearchResponse, error) {
+	opts, err := parseSearchParams(url.Values{"search": {query}}, deep, func() ([]byte, error) {
+		return nil, fmt.Errorf("Missing schema parameter")
+	})
+	if err != nil {
+		return nil, err
+	}
+	response := cachedSearch(opts, userID, nil)
+	return &response, nil
+}
+
+// serveSearch handles both the plain and the deep search endpoints
+func serveSearch(w http.ResponseWriter, r *http.Request, deep bool) {
 	// Limitation
 	var limiter = handlersArgs.GetLimiter()
 	if !limiter.Allow() {
@@ -22,34 +201,195 @@ func SearchHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Set CORS headers
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
 	w.Header().Set("Content-Type", "application/json")
 
-	query := r.URL.Query().Get("search")
-	if query == "" {
-		http.Error(w, "Missing search parameter", http.StatusBadRequest)
+	opts, err := parseSearchOptions(r, deep)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	response := cachedSearch(opts, userID, nil)
+
+	// Send response
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// cachedSearch answers from the cache or runs the search and caches it.
+// Deep search results are kept as a session of the user for follow-up
+// questions, and every search is recorded in the user's history.
+func cachedSearch(opts searchOptions, userID string, progress func(stage string)) models.SearchResponse {
+	startTime := time.Now()
+	key := opts.cacheKey()
+
 	// Check cache
-	if cached, found := cache.GetInstance().Get(query); found {
-		log.Printf("Cache hit for query: %s", query)
-		err := json.NewEncoder(w).Encode(cached)
-		if err != nil {
-			log.Printf("Error encoding cached response: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+	if cached, found := cache.GetInstance().Get(key); found {
+		log.Printf("Cache hit for query: %s", opts.Query)
+		if opts.Deep {
+			attachSession(userID, &cached)
 		}
-		return
+		recordSearch(opts, userID, cached, true, startTime)
+		return cached
+	}
+
+	response := runSearch(opts, progress)
+
+	// Store in cache
+	if err := cache.GetInstance().Set(key, response); err != nil {
+		log.Printf("Error caching response: %v", err)
+	}
+
+	if opts.Deep {
+		attachSession(userID, &response)
+	}
+	recordSearch(opts, userID, response, false, startTime)
+	return response
+}
+
+// Stages of a search reported to the progress callback
+const (
+	stageRewriting   = "rewriting"
+	stageSearching   = "searching"
+	stageReranking   = "reranking"
+	stageSummarizing = "summarizing"
+)
+
+// runSearch queries the engines and processes the results with AI. progress,
+// if set, is called as the search enters each stage.
+func runSearch(opts searchOptions, progress func(stage string)) models.SearchResponse {
+	if progress == nil {
+		progress = func(string) {}
 	}
 
 	// Perform search
 	startTime := time.Now()
 
 	// Create search engines
-	searchEngines := []search.SearchEngine{
+	searchEngines := defaultEngines()
+
+	queries := []string{opts.Query}
+	var rewriteUsage ai.Usage
+	if opts.Rewrite {
+		progress(stageRewriting)
+		rewritten, usage, err := rewriteQuery(opts.Query, opts.MaxQueries)
+		rewriteUsage = usage
+		if err != nil {
+			log.Printf("Query rewrite error: %v", err)
+		} else {
+			log.Printf("Rewrote %q into %q", opts.Query, rewritten)
+			queries = rewritten
+		}
+	}
+
+	progress(stageSearching)
+	allResults := runQueries(searchEngines, queries, opts.Deep)
+
+	var rerankUsage ai.Usage
+	if opts.Rerank {
+		progress(stageReranking)
+		allResults, rerankUsage = rerankResults(opts.Query, allResults)
+	}
+
+	searchType := "search"
+	if opts.Deep {
+		searchType = "deep"
+	}
+	summary := summaryRequest{
+		Query: opts.Query,
+		Style: opts.Style,
+		Metadata: searchMetadata(searchEngines, map[string]string{
+			"type":         searchType,
+			"mode":         opts.Mode,
+			"style":        opts.Style,
+			"result_count": strconv.Itoa(len(allResults)),
+			"queries":      strings.Join(queries, "; "),
+		}),
+	}
+
+	// Create response
+	response := models.SearchResponse{
+		Query:   opts.Query,
+		Results: allResults,
+	}
+	if opts.Rewrite {
+		response.RewrittenQueries = queries
+	}
+
+	// Process with AI
+	progress(stageSummarizing)
+	var err error
+	switch {
+	case opts.Schema != nil:
+		response.Schema = opts.Schema.Name
+		response.Structured, response.TokenUsage, err = getStructuredResults(summary, opts.Schema, allResults)
+	case opts.Mode == "mapreduce":
+		response.FormattedResult, response.TokenUsage, err = getMapReduceResults(summary, allResults)
+	default:
+		response.FormattedResult, response.TokenUsage, err = getAIResults(summary, allResults)
+	}
+	if err != nil {
+		log.Printf("AI error: %v", err)
+		response.FormattedResult = aiErrorMessage
+	}
+	response.TokenUsage = addUsage(response.TokenUsage, rewriteUsage)
+	response.TokenUsage = addUsage(response.TokenUsage, rerankUsage)
+
+	response.Duration = time.Since(startTime).String()
+	return response
+}
+
+// rerankResults reorders the results by semantic similarity to the query.
+// If embedding fails the engine order is kept.
+func rerankResults(query string, results []models.SearchResult) ([]models.SearchResult, ai.Usage) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	reranked, usage, err := rerank.Rerank(ctx, handlersArgs.GetEmbedder(), query, results, rerank.Options{
+		Weight:    config.Config.RerankWeight,
+		Threshold: config.Config.RerankThreshold,
+	})
+	if err != nil {
+		log.Printf("Rerank error: %v", err)
+		return results, ai.Usage{}
+	}
+	return reranked, usage
+}
+
+func defaultEngines() []search.SearchEngine {
+	return []search.SearchEngine{
 		&search.DuckDuckGoSearch{},
 	}
+}
+
+// runQueries runs every query through the engines and fuses the result lists
+func runQueries(searchEngines []search.SearchEngine, queries []string, deep bool) []models.SearchResult {
+	if len(queries) == 1 {
+		return runEngines(searchEngines, queries[0], deep)
+	}
+
+	lists := make([][]models.SearchResult, len(queries))
+	var wg sync.WaitGroup
+	for i, query := range queries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lists[i] = runEngines(searchEngines, query, deep)
+		}()
+	}
+	wg.Wait()
+
+	return search.Fuse(lists)
+}
 
+// runEngines searches all engines in parallel and merges their results
+func runEngines(searchEngines []search.SearchEngine, query string, deep bool) []models.SearchResult {
 	// Create channels for results and errors
 	resultsChan := make(chan []models.SearchResult, len(searchEngines))
 	errorsChan := make(chan error, len(searchEngines))
@@ -62,9 +402,17 @@ func SearchHandler(w http.ResponseWriter, r *http.Request) {
 		wg.Add(1)
 		go func(e search.SearchEngine) {
 			defer wg.Done()
-			log.Println("Searching engine:", engine.GetName())
+			log.Println("Searching engine:", e.GetName())
 			log.Println("Searching query:", query)
-			results, err := e.Search(query)
+			var (
+				results []models.SearchResult
+				err     error
+			)
+			if deep {
+				results, err = e.DeepSearch(query)
+			} else {
+				results, err = e.Search(query)
+			}
 			if err != nil {
 				errorsChan <- err
 				return
@@ -91,34 +439,12 @@ func SearchHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Search error: %v", err)
 	}
 
-	// Process with OpenAI
-	openAIResult, err := getOpenAIResults(query, allResults)
-	if err != nil {
-		log.Printf("OpenAI error: %v", err)
-		openAIResult = "Error processing results with AI"
+	// Keep the downloaded pages searchable after the response is cached.
+	// The indexer gets its own copy, since the caller goes on to fill in
+	// the summaries.
+	if deep {
+		go indexResults(append([]models.SearchResult(nil), allResults...))
 	}
 
-	// Create response
-	response := models.SearchResponse{
-		Query:           query,
-		Results:         allResults,
-		FormattedResult: openAIResult,
-		Duration:        time.Since(startTime).String(),
-	}
-
-	println(openAIResult)
-
-	// Store in cache
-	err1 := cache.GetInstance().Set(query, response)
-	if err1 != nil {
-		log.Printf("Error caching response: %v", err1)
-	}
-
-	// Send response
-	err = json.NewEncoder(w).Encode(response)
-	if err != nil {
-		log.Printf("Error encoding response: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
+	return allResults
 }
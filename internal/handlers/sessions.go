@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"web-scraper/internal/ai"
+	"web-scraper/internal/config"
+	"web-scraper/internal/handlersArgs"
+	"web-scraper/internal/middleware"
+	"web-scraper/internal/models"
+	"web-scraper/internal/packer"
+	"web-scraper/internal/prompts"
+	"web-scraper/internal/search"
+	"web-scraper/internal/sessions"
+)
+
+type AskRequest struct {
+	Question string `json:"question"`
+}
+
+type AskResponse struct {
+	SessionID       string             `json:"session_id"`
+	Question        string             `json:"question"`
+	Answer          string             `json:"answer"`
+	SearchedQueries []string           `json:"searched_queries,omitempty"`
+	NewResults      int                `json:"new_results"`
+	TokenUsage      *models.TokenUsage `json:"token_usage,omitempty"`
+	Duration        string             `json:"duration"`
+}
+
+var followUpSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"needs_search": {"type": "boolean"},
+		"queries": {"type": "array", "items": {"type": "string"}}
+	},
+	"required": ["needs_search", "queries"]
+}`)
+
+// attachSession stores the response as a new session owned by the user
+func attachSession(userID string, response *models.SearchResponse) {
+	if userID == "" {
+		return
+	}
+
+	seed := *response
+	if seed.FormattedResult == aiErrorMessage {
+		// Don't start the conversation with a failed summary
+		seed.FormattedResult = ""
+	}
+
+	session, err := sessions.Create(userID, seed)
+	if err != nil {
+		log.Printf("Error creating session: %v", err)
+		return
+	}
+	response.SessionID = session.ID
+}
+
+// SessionHandler returns a stored session with its results and conversation
+func SessionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	session, found, err := sessions.Get(r.PathValue("id"), userID)
+	if err != nil {
+		log.Printf("Error loading session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, session)
+}
+
+// SessionAskHandler answers a follow-up question using the stored session
+// context, searching for new information only when the question needs it
+func SessionAskHandler(w http.ResponseWriter, r *http.Request) {
+	// Limitation
+	var limiter = handlersArgs.GetLimiter()
+	if !limiter.Allow() {
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	var req AskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Question = strings.TrimSpace(req.Question)
+	if req.Question == "" {
+		http.Error(w, "Missing question", http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue("id")
+	unlock := sessions.Lock(id)
+	defer unlock()
+
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	session, found, err := sessions.Get(id, userID)
+	if err != nil {
+		log.Printf("Error loading session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	// The follow-up searches and the answer can outlast the server write
+	// timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(2 * time.Minute)); err != nil {
+		log.Printf("Error extending write deadline: %v", err)
+	}
+
+	response, err := answerFollowUp(session, req.Question)
+	if err != nil {
+		log.Printf("Follow-up error: %v", err)
+		http.Error(w, aiErrorMessage, http.StatusBadGateway)
+		return
+	}
+
+	if err := sessions.Save(session); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// answerFollowUp runs the incremental searches the question needs, answers
+// it and appends both turns to the session
+func answerFollowUp(session *models.Session, question string) (AskResponse, error) {
+	startTime := time.Now()
+	response := AskResponse{
+		SessionID: session.ID,
+		Question:  question,
+	}
+
+	history := session.Turns
+	if len(history) > config.Config.SessionHistoryTurns {
+		history = history[len(history)-config.Config.SessionHistoryTurns:]
+	}
+
+	queries, planUsage, err := planFollowUp(session, question, history)
+	if err != nil {
+		// Answer from what we have rather than failing the question
+		log.Printf("Follow-up planning error: %v", err)
+	}
+
+	if len(queries) > 0 {
+		log.Printf("Follow-up in session %s searches %q", session.ID, queries)
+		newResults := runQueries(defaultEngines(), queries, true)
+		before := len(session.Results)
+		session.Results = search.Fuse([][]models.SearchResult{session.Results, newResults})
+		response.SearchedQueries = queries
+		response.NewResults = len(session.Results) - before
+	}
+
+	answer, usage, err := getAIResults(summaryRequest{
+		Query: question,
+		Style: prompts.AskTemplate,
+		Metadata: map[string]string{
+			"original_query": session.Query,
+		},
+		History: history,
+	}, session.Results)
+	if err != nil {
+		return response, err
+	}
+	response.Answer = answer
+	response.TokenUsage = addUsage(usage, planUsage)
+
+	now := time.Now()
+	session.Turns = append(session.Turns,
+		models.SessionTurn{Role: "user", Content: question, Queries: queries, At: now},
+		models.SessionTurn{Role: "assistant", Content: answer, At: now},
+	)
+
+	response.Duration = time.Since(startTime).String()
+	return response, nil
+}
+
+// planFollowUp asks the model whether the stored results cover the question
+// and which queries to search if they do not
+func planFollowUp(session *models.Session, question string, history []models.SessionTurn) ([]string, ai.Usage, error) {
+	provider := handlersArgs.GetAIProvider()
+
+	results := make([]packer.PackedResult, len(session.Results))
+	for i, result := range session.Results {
+		results[i] = packer.PackedResult{SearchResult: result, Rank: i + 1}
+	}
+
+	registry, err := prompts.GetRegistry()
+	if err != nil {
+		return nil, ai.Usage{}, err
+	}
+	prompt, err := registry.Render(prompts.FollowUpTemplate, prompts.Data{
+		Query:   question,
+		Results: results,
+		Metadata: map[string]string{
+			"original_query": session.Query,
+			"max_queries":    strconv.Itoa(config.Config.MaxRewriteQueries),
+		},
+		Date:    time.Now(),
+		History: history,
+	})
+	if err != nil {
+		return nil, ai.Usage{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	resp, err := provider.Complete(ctx, ai.CompletionRequest{
+		Model: config.Config.StructuredModels[provider.Name()],
+		Messages: []ai.Message{
+			{Role: "user", Content: prompt},
+		},
+		MaxTokens: 300,
+		JSONSchema: &ai.JSONSchema{
+			Name:   "follow_up_plan",
+			Schema: followUpSchema,
+		},
+	})
+	if err != nil {
+		return nil, ai.Usage{}, err
+	}
+
+	var plan struct {
+		NeedsSearch bool     `json:"needs_search"`
+		Queries     []string `json:"queries"`
+	}
+	if err := json.Unmarshal([]byte(stripCodeFence(resp.Content)), &plan); err != nil {
+		return nil, resp.Usage, fmt.Errorf("error parsing follow-up plan: %v", err)
+	}
+	if !plan.NeedsSearch {
+		return nil, resp.Usage, nil
+	}
+
+	var queries []string
+	for _, q := range plan.Queries {
+		if q = strings.TrimSpace(q); q != "" && len(queries) < config.Config.MaxRewriteQueries {
+			queries = append(queries, q)
+		}
+	}
+	return queries, resp.Usage, nil
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"web-scraper/internal/ai"
+	"web-scraper/internal/config"
+	"web-scraper/internal/handlersArgs"
+	"web-scraper/internal/models"
+	"web-scraper/internal/prompts"
+	"web-scraper/internal/schemas"
+)
+
+const repairInstructions = `The JSON you returned does not match the schema:
+%v
+
+Return the corrected JSON object only.`
+
+// getStructuredResults asks the provider for an answer matching the schema
+// and validates it, feeding validation errors back for a repair attempt
+func getStructuredResults(req summaryRequest, schema *schemas.Schema, results []models.SearchResult) (json.RawMessage, *models.TokenUsage, error) {
+	provider := handlersArgs.GetAIProvider()
+
+	req.Style = prompts.JSONTemplate
+	req.Metadata["schema"] = schema.Name
+	req.Metadata["schema_description"] = schema.Description
+	req.Metadata["schema_json"] = string(schema.Raw)
+
+	prompt, packed, err := buildPrompt(provider, req, results)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 45*time.Second)
+	defer cancel()
+
+	completion := ai.CompletionRequest{
+		Model: config.Config.StructuredModels[provider.Name()],
+		Messages: []ai.Message{
+			{Role: "user", Content: prompt},
+		},
+		MaxTokens: config.Config.MaxCompletionTokens,
+		JSONSchema: &ai.JSONSchema{
+			Name:        schema.Name,
+			Description: schema.Description,
+			Schema:      schema.Raw,
+		},
+	}
+	usage := &models.TokenUsage{
+		ContextTokens: packed.Tokens,
+		ContextLimit:  config.Config.ContextTokenLimits[provider.Name()],
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := provider.Complete(ctx, completion)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, usage, fmt.Errorf("AI processing timed out")
+			}
+			return nil, usage, err
+		}
+		usage.PromptTokens += resp.Usage.PromptTokens
+		usage.CompletionTokens += resp.Usage.CompletionTokens
+		usage.TotalTokens += resp.Usage.TotalTokens
+
+		output := []byte(stripCodeFence(resp.Content))
+		validationErr := schema.Validate(output)
+		if validationErr == nil {
+			return json.RawMessage(output), usage, nil
+		}
+
+		if attempt >= config.Config.JSONRepairAttempts {
+			return nil, usage, fmt.Errorf("structured output does not match schema %s: %v", schema.Name, validationErr)
+		}
+		log.Printf("Structured output failed validation against %s, retrying: %v", schema.Name, validationErr)
+
+		completion.Messages = append(completion.Messages,
+			ai.Message{Role: "assistant", Content: resp.Content},
+			ai.Message{Role: "user", Content: fmt.Sprintf(repairInstructions, validationErr)},
+		)
+	}
+}
+
+// stripCodeFence removes a markdown code fence models sometimes wrap JSON in
+func stripCodeFence(content string) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "```") {
+		return content
+	}
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimSuffix(content, "```")
+	return strings.TrimSpace(content)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"web-scraper/internal/auth"
+	"web-scraper/internal/middleware"
+)
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type LogoutRequest struct {
+	// All ends every session of the user, not only the current one
+	All bool `json:"all"`
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new access and
+// refresh token. The old refresh token stops working.
+func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.RefreshToken == "" {
+		http.Error(w, "Missing refresh_token", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := auth.Refresh(req.RefreshToken)
+	switch err {
+	case nil:
+	case auth.ErrInvalidToken, auth.ErrTokenReuse:
+		respondWithJSON(w, http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Message: "Invalid refresh token",
+		})
+		return
+	default:
+		log.Printf("Error refreshing token: %v", err)
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, AuthResponse{
+		Success:      true,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+	})
+}
+
+// LogoutHandler revokes the access token of the request and its session's
+// refresh tokens
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	var req LogoutRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	claims, _ := middleware.GetUserClaimsFromContext(r.Context())
+	err := auth.Logout(claims)
+	if err == nil && req.All {
+		userID, _ := middleware.GetUserIDFromContext(r.Context())
+		err = auth.RevokeUser(userID)
+	}
+	if err != nil {
+		log.Printf("Error logging out: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, AuthResponse{
+		Success: true,
+		Message: "Logged out",
+	})
+}
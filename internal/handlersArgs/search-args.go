@@ -12,11 +12,14 @@ type HandlersArgs struct{}
 var (
 	limiter      = rate.NewLimiter(rate.Every(1*time.Second), config.Config.RateLimit)
 	openAIClient *ai.OpenAIClient
+	aiProvider   ai.Provider
+	embedder     ai.Embedder
 )
 
 func init() {
 	openAIClient = ai.NewOpenAIClient(config.Config.OpenAIKey)
-
+	aiProvider = ai.NewProvider(config.Config.AIProvider)
+	embedder = ai.NewEmbedder(config.Config.EmbeddingProvider)
 }
 
 func GetOpenAiClient() *ai.OpenAIClient {
@@ -27,6 +30,24 @@ func GetOpenAiClient() *ai.OpenAIClient {
 	return openAIClient
 }
 
+// GetAIProvider returns the provider selected by AI_PROVIDER
+func GetAIProvider() ai.Provider {
+	if aiProvider == nil {
+		aiProvider = ai.NewProvider(config.Config.AIProvider)
+	}
+
+	return aiProvider
+}
+
+// GetEmbedder returns the embedding provider selected by EMBEDDING_PROVIDER
+func GetEmbedder() ai.Embedder {
+	if embedder == nil {
+		embedder = ai.NewEmbedder(config.Config.EmbeddingProvider)
+	}
+
+	return embedder
+}
+
 func GetLimiter() *rate.Limiter {
 	return limiter
 }
@@ -0,0 +1,166 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"web-scraper/internal/models"
+	"web-scraper/internal/storage"
+)
+
+const bucket = "history"
+
+// Filter selects history entries; zero fields match everything
+type Filter struct {
+	// Query matches entries whose query contains it, ignoring case
+	Query    string
+	Type     string
+	CacheHit *bool
+	Since    time.Time
+	Until    time.Time
+	Offset   int
+	Limit    int
+}
+
+func (f Filter) matches(entry *models.HistoryEntry) bool {
+	switch {
+	case f.Query != "" && !strings.Contains(strings.ToLower(entry.Query), strings.ToLower(f.Query)):
+		return false
+	case f.Type != "" && entry.Type != f.Type:
+		return false
+	case f.CacheHit != nil && entry.CacheHit != *f.CacheHit:
+		return false
+	case !f.Since.IsZero() && entry.CreatedAt.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !entry.CreatedAt.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+// key groups entries by user in the order they were made
+func key(entry *models.HistoryEntry) string {
+	return fmt.Sprintf("%s/%020d/%s", entry.UserID, entry.CreatedAt.UnixNano(), entry.ID)
+}
+
+// Record stores a search in the user's history
+func Record(entry *models.HistoryEntry) error {
+	entry.ID = storage.NewID()
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	return storage.GetStore().Put(bucket, key(entry), entry)
+}
+
+// List returns the user's entries matching the filter, newest first, and
+// the number of matching entries
+func List(userID string, filter Filter) ([]models.HistoryEntry, int, error) {
+	var matched []models.HistoryEntry
+	err := each(userID, func(entry *models.HistoryEntry) error {
+		if filter.matches(entry) {
+			matched = append(matched, *entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries := []models.HistoryEntry{}
+	for i := len(matched) - 1 - filter.Offset; i >= 0 && len(entries) < filter.Limit; i-- {
+		entries = append(entries, matched[i])
+	}
+	return entries, len(matched), nil
+}
+
+// Get returns the user's entry with the given id
+func Get(id, userID string) (*models.HistoryEntry, bool, error) {
+	var found *models.HistoryEntry
+	err := each(userID, func(entry *models.HistoryEntry) error {
+		if entry.ID == id {
+			found = entry
+			return storage.ErrStop
+		}
+		return nil
+	})
+	return found, found != nil, err
+}
+
+// Delete removes the user's entry with the given id
+func Delete(id, userID string) (bool, error) {
+	entry, found, err := Get(id, userID)
+	if err != nil || !found {
+		return false, err
+	}
+	return true, storage.GetStore().Delete(bucket, key(entry))
+}
+
+// DeleteAll removes the user's whole history and returns the number of
+// entries removed
+func DeleteAll(userID string) (int, error) {
+	return deleteWhere(userID+"/", func(entry *models.HistoryEntry) bool {
+		return true
+	})
+}
+
+// Prune deletes entries older than ttl
+func Prune(ttl time.Duration) (int, error) {
+	cutoff := time.Now().Add(-ttl)
+	return deleteWhere("", func(entry *models.HistoryEntry) bool {
+		return entry.CreatedAt.Before(cutoff)
+	})
+}
+
+// StartPruning prunes expired entries now and then every interval
+func StartPruning(ttl, interval time.Duration) {
+	go func() {
+		for {
+			removed, err := Prune(ttl)
+			if err != nil {
+				log.Printf("Error pruning history: %v", err)
+			} else if removed > 0 {
+				log.Printf("Pruned %d history entries", removed)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func each(userID string, fn func(entry *models.HistoryEntry) error) error {
+	return storage.GetStore().ForEach(bucket, userID+"/", func(key string, data []byte) error {
+		var entry models.HistoryEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			log.Printf("Error decoding history entry %s: %v", key, err)
+			return nil
+		}
+		return fn(&entry)
+	})
+}
+
+func deleteWhere(prefix string, match func(entry *models.HistoryEntry) bool) (int, error) {
+	store := storage.GetStore()
+	var keys []string
+	err := store.ForEach(bucket, prefix, func(key string, data []byte) error {
+		var entry models.HistoryEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			log.Printf("Error decoding history entry %s: %v", key, err)
+			return nil
+		}
+		if match(&entry) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, key := range keys {
+		if err := store.Delete(bucket, key); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
@@ -0,0 +1,209 @@
+package index
+
+import (
+	"fmt"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"web-scraper/internal/config"
+	"web-scraper/internal/models"
+	"web-scraper/internal/search"
+)
+
+// Index is the local full-text index of every page fetched by deep searches
+type Index struct {
+	idx bleve.Index
+}
+
+// SearchOptions filters and pages an index search
+type SearchOptions struct {
+	Size   int
+	From   int
+	Source string
+	Since  time.Time
+	// Content includes the full page body in the hits
+	Content bool
+}
+
+func newMapping() mapping.IndexMapping {
+	text := bleve.NewTextFieldMapping()
+	text.Analyzer = en.AnalyzerName
+	keyword := bleve.NewKeywordFieldMapping()
+
+	page := bleve.NewDocumentMapping()
+	page.AddFieldMappingsAt("url", keyword)
+	page.AddFieldMappingsAt("title", text)
+	page.AddFieldMappingsAt("description", text)
+	page.AddFieldMappingsAt("content", text)
+	page.AddFieldMappingsAt("source", keyword)
+	page.AddFieldMappingsAt("canonical", keyword)
+	page.AddFieldMappingsAt("language", keyword)
+	page.AddFieldMappingsAt("published_time", keyword)
+	page.AddFieldMappingsAt("fetched_at", bleve.NewDateTimeFieldMapping())
+
+	m := bleve.NewIndexMapping()
+	m.DefaultMapping = page
+	m.DefaultAnalyzer = en.AnalyzerName
+	return m
+}
+
+// Open opens the index at path, creating it if it does not exist
+func Open(path string) (*Index, error) {
+	if _, err := os.Stat(path); err == nil {
+		idx, err := bleve.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("error opening index %s: %v", path, err)
+		}
+		return &Index{idx: idx}, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating data directory: %v", err)
+	}
+	idx, err := bleve.New(path, newMapping())
+	if err != nil {
+		return nil, fmt.Errorf("error creating index %s: %v", path, err)
+	}
+	return &Index{idx: idx}, nil
+}
+
+func (i *Index) Close() error {
+	return i.idx.Close()
+}
+
+// Add indexes the pages, replacing earlier versions of the same URL
+func (i *Index) Add(pages []models.IndexedPage) error {
+	batch := i.idx.NewBatch()
+	for _, page := range pages {
+		if err := batch.Index(search.NormalizeURL(page.URL), page); err != nil {
+			return fmt.Errorf("error indexing %s: %v", page.URL, err)
+		}
+	}
+	return i.idx.Batch(batch)
+}
+
+// AddResults indexes the pages of deep search results that have content.
+// The page's own description is preferred over the engine's snippet. The
+// index is shared by all users, so nothing about the search is stored.
+func (i *Index) AddResults(results []models.SearchResult) error {
+	now := time.Now()
+	var pages []models.IndexedPage
+	for _, result := range results {
+		if result.InnerContent == "" {
+			continue
+		}
+		description := result.Metadata["description"]
+		if description == "" {
+			description = result.Snippet
+		}
+		pages = append(pages, models.IndexedPage{
+			URL:           result.Link,
+			Title:         result.Title,
+			Description:   description,
+			Content:       result.InnerContent,
+			Source:        result.Source,
+			Canonical:     result.Metadata["canonical"],
+			Language:      result.Metadata["lang"],
+			PublishedTime: result.Metadata["published_time"],
+			FetchedAt:     now,
+		})
+	}
+	if len(pages) == 0 {
+		return nil
+	}
+	return i.Add(pages)
+}
+
+func (i *Index) Count() (uint64, error) {
+	return i.idx.DocCount()
+}
+
+// Search runs a query string query (e.g. `+title:golang "error handling"`)
+// against the indexed pages
+func (i *Index) Search(q string, opts SearchOptions) (models.IndexSearchResponse, error) {
+	startTime := time.Now()
+
+	conjuncts := []query.Query{bleve.NewQueryStringQuery(q)}
+	if opts.Source != "" {
+		source := bleve.NewTermQuery(opts.Source)
+		source.SetField("source")
+		conjuncts = append(conjuncts, source)
+	}
+	if !opts.Since.IsZero() {
+		since := bleve.NewDateRangeQuery(opts.Since, time.Time{})
+		since.SetField("fetched_at")
+		conjuncts = append(conjuncts, since)
+	}
+
+	req := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(conjuncts...), opts.Size, opts.From, false)
+	req.Fields = []string{"url", "title", "description", "source", "canonical", "language", "published_time", "fetched_at"}
+	if opts.Content {
+		req.Fields = append(req.Fields, "content")
+	}
+	req.Highlight = bleve.NewHighlightWithStyle("html")
+	req.Highlight.AddField("title")
+	req.Highlight.AddField("content")
+
+	res, err := i.idx.Search(req)
+	if err != nil {
+		return models.IndexSearchResponse{}, err
+	}
+
+	response := models.IndexSearchResponse{
+		Query: q,
+		Total: res.Total,
+		Hits:  []models.IndexHit{},
+	}
+	for _, hit := range res.Hits {
+		page := models.IndexedPage{
+			URL:           stringField(hit.Fields, "url"),
+			Title:         stringField(hit.Fields, "title"),
+			Description:   stringField(hit.Fields, "description"),
+			Content:       stringField(hit.Fields, "content"),
+			Source:        stringField(hit.Fields, "source"),
+			Canonical:     stringField(hit.Fields, "canonical"),
+			Language:      stringField(hit.Fields, "language"),
+			PublishedTime: stringField(hit.Fields, "published_time"),
+		}
+		page.FetchedAt, _ = time.Parse(time.RFC3339, stringField(hit.Fields, "fetched_at"))
+
+		var highlights []string
+		for _, field := range []string{"title", "content"} {
+			highlights = append(highlights, hit.Fragments[field]...)
+		}
+		response.Hits = append(response.Hits, models.IndexHit{
+			IndexedPage: page,
+			Score:       hit.Score,
+			Highlights:  highlights,
+		})
+	}
+	response.Duration = time.Since(startTime).String()
+	return response, nil
+}
+
+func stringField(fields map[string]interface{}, name string) string {
+	value, _ := fields[name].(string)
+	return value
+}
+
+var (
+	instance *Index
+	once     sync.Once
+)
+
+// GetIndex returns the singleton index in the configured data directory
+func GetIndex() *Index {
+	once.Do(func() {
+		var err error
+		instance, err = Open(filepath.Join(config.Config.DataDir, "pages.bleve"))
+		if err != nil {
+			panic(err)
+		}
+	})
+	return instance
+}
@@ -0,0 +1,227 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+	"web-scraper/internal/models"
+	"web-scraper/internal/storage"
+)
+
+const bucket = "jobs"
+
+// ErrQueueFull is returned by Enqueue when the queue has no room left
+var ErrQueueFull = errors.New("job queue is full")
+
+// Runner runs a job and returns its result. It calls stage as the job
+// moves through its steps.
+type Runner func(job *models.Job, stage func(string)) (*models.SearchResponse, error)
+
+var (
+	queue  chan string
+	runner Runner
+)
+
+// Start runs the worker pool. Jobs left queued or running by a previous
+// process are queued again, oldest first.
+func Start(workers, size int, run Runner) error {
+	queue = make(chan string, size)
+	runner = run
+
+	pending, err := pendingJobs()
+	if err != nil {
+		return err
+	}
+	for _, job := range pending {
+		job.Status = models.JobQueued
+		job.Stage = ""
+		select {
+		case queue <- job.ID:
+		default:
+			job.Status = models.JobFailed
+			job.Error = "queue full after server restart"
+		}
+		if err := save(&job); err != nil {
+			return err
+		}
+	}
+	if len(pending) > 0 {
+		log.Printf("Requeued %d jobs", len(pending))
+	}
+
+	for i := 0; i < workers; i++ {
+		go worker()
+	}
+	return nil
+}
+
+// Enqueue stores the job and queues it for the workers
+func Enqueue(job *models.Job) error {
+	job.ID = storage.NewID()
+	job.Status = models.JobQueued
+	job.CreatedAt = time.Now()
+	if err := save(job); err != nil {
+		return err
+	}
+
+	select {
+	case queue <- job.ID:
+		return nil
+	default:
+		if err := storage.GetStore().Delete(bucket, job.ID); err != nil {
+			log.Printf("Error deleting rejected job %s: %v", job.ID, err)
+		}
+		return ErrQueueFull
+	}
+}
+
+// Get returns the job if it exists and belongs to the user
+func Get(id, userID string) (*models.Job, bool, error) {
+	var job models.Job
+	found, err := storage.GetStore().Get(bucket, id, &job)
+	if err != nil || !found || job.UserID != userID {
+		return nil, false, err
+	}
+	return &job, true, nil
+}
+
+func save(job *models.Job) error {
+	return storage.GetStore().Put(bucket, job.ID, job)
+}
+
+func pendingJobs() ([]models.Job, error) {
+	var pending []models.Job
+	err := storage.GetStore().ForEach(bucket, "", func(key string, data []byte) error {
+		var job models.Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			log.Printf("Error decoding job %s: %v", key, err)
+			return nil
+		}
+		if job.Status == models.JobQueued || job.Status == models.JobRunning {
+			pending = append(pending, job)
+		}
+		return nil
+	})
+	sort.Slice(pending, func(a, b int) bool {
+		return pending[a].CreatedAt.Before(pending[b].CreatedAt)
+	})
+	return pending, err
+}
+
+func worker() {
+	for id := range queue {
+		var job models.Job
+		found, err := storage.GetStore().Get(bucket, id, &job)
+		if err != nil || !found {
+			log.Printf("Error loading job %s: %v", id, err)
+			continue
+		}
+		process(&job)
+	}
+}
+
+func process(job *models.Job) {
+	started := time.Now()
+	job.Status = models.JobRunning
+	job.StartedAt = &started
+	if err := save(job); err != nil {
+		log.Printf("Error saving job %s: %v", job.ID, err)
+	}
+
+	result, err := runSafely(job)
+
+	finished := time.Now()
+	job.FinishedAt = &finished
+	job.Stage = ""
+	if err != nil {
+		job.Status = models.JobFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = models.JobCompleted
+		job.Result = result
+	}
+	if err := save(job); err != nil {
+		log.Printf("Error saving job %s: %v", job.ID, err)
+	}
+	log.Printf("Job %s %s in %s", job.ID, job.Status, finished.Sub(started))
+
+	if job.CallbackURL != "" {
+		// Retries can take a while, so they don't hold up the worker
+		go deliverCallback(job)
+	}
+}
+
+// deliverCallback posts the finished job to its callback URL and records
+// the delivery
+func deliverCallback(job *models.Job) {
+	job.Callback = Deliver(job.CallbackURL, job.WebhookSecret, job.ID, job.WithoutSecret())
+	if err := save(job); err != nil {
+		log.Printf("Error saving job %s: %v", job.ID, err)
+	}
+}
+
+// runSafely keeps a panicking job from taking its worker down
+func runSafely(job *models.Job) (result *models.SearchResponse, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Job %s panicked: %v", job.ID, r)
+			err = fmt.Errorf("internal error")
+		}
+	}()
+
+	return runner(job, func(stage string) {
+		job.Stage = stage
+		if err := save(job); err != nil {
+			log.Printf("Error saving job %s: %v", job.ID, err)
+		}
+	})
+}
+
+// Prune deletes finished jobs older than ttl
+func Prune(ttl time.Duration) (int, error) {
+	store := storage.GetStore()
+	cutoff := time.Now().Add(-ttl)
+
+	var expired []string
+	err := store.ForEach(bucket, "", func(key string, data []byte) error {
+		var job struct {
+			FinishedAt *time.Time `json:"finished_at"`
+		}
+		if err := json.Unmarshal(data, &job); err != nil {
+			log.Printf("Error decoding job %s: %v", key, err)
+			return nil
+		}
+		if job.FinishedAt != nil && job.FinishedAt.Before(cutoff) {
+			expired = append(expired, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range expired {
+		if err := store.Delete(bucket, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
+
+// StartPruning prunes expired jobs now and then every interval
+func StartPruning(ttl, interval time.Duration) {
+	go func() {
+		for {
+			removed, err := Prune(ttl)
+			if err != nil {
+				log.Printf("Error pruning jobs: %v", err)
+			} else if removed > 0 {
+				log.Printf("Pruned %d expired jobs", removed)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"web-scraper/internal/fetcher"
+	"web-scraper/internal/models"
+)
+
+// Delivery attempts of a webhook and the wait before each retry
+var retryDelays = []time.Duration{0, 2 * time.Second, 10 * time.Second}
+
+// Webhooks only reach public addresses and redirects are not followed, so
+// a webhook URL cannot be pointed at internal services
+var webhookClient = &http.Client{
+	Transport: fetcher.NewTransport(),
+	Timeout:   10 * time.Second,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// Sign returns the signature of a webhook: the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the secret of the job or monitor. Receivers recompute it
+// to verify the X-Webhook-Signature header and reject stale timestamps.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliver posts payload as JSON to url, signed with secret and retrying
+// failed deliveries. id is sent as X-Webhook-Id so receivers can drop
+// duplicates.
+func Deliver(url, secret, id string, payload interface{}) *models.WebhookDelivery {
+	delivery := &models.WebhookDelivery{}
+	if secret == "" {
+		// Saved before each webhook had a secret of its own
+		delivery.Error = "webhook has no signing secret"
+		return delivery
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+
+	for _, delay := range retryDelays {
+		time.Sleep(delay)
+		delivery.Attempts++
+
+		status, err := post(url, secret, id, body)
+		delivery.StatusCode = status
+		if err == nil {
+			delivery.Delivered = true
+			delivery.Error = ""
+			return delivery
+		}
+		delivery.Error = err.Error()
+		log.Printf("Webhook %s attempt %d failed: %v", id, delivery.Attempts, err)
+	}
+	return delivery
+}
+
+func post(url, secret, id string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", id)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", Sign(secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
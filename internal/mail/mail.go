@@ -0,0 +1,107 @@
+package mail
+
+import (
+	"fmt"
+	"io"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"web-scraper/internal/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends plain text email
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTPMailer sends email through an SMTP server, authenticating with PLAIN
+// when a username is set
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	host := m.Addr
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, format(m.From, msg))
+}
+
+// LogMailer writes email to an io.Writer instead of sending it, for
+// development and tests
+type LogMailer struct {
+	Out  io.Writer
+	From string
+
+	mu sync.Mutex
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := fmt.Fprintf(m.Out, "----- mail -----\n%s\n----------------\n", format(m.From, msg))
+	return err
+}
+
+// format renders the message as an RFC 5322 email
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// NewMailer returns the mailer named in the config: "smtp" or "log"
+func NewMailer() (Mailer, error) {
+	switch config.Config.Mailer {
+	case "smtp":
+		if config.Config.SMTPHost == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for the smtp mailer")
+		}
+		return &SMTPMailer{
+			Addr:     fmt.Sprintf("%s:%d", config.Config.SMTPHost, config.Config.SMTPPort),
+			Username: config.Config.SMTPUsername,
+			Password: config.Config.SMTPPassword,
+			From:     config.Config.MailFrom,
+		}, nil
+	case "log":
+		return &LogMailer{Out: os.Stdout, From: config.Config.MailFrom}, nil
+	}
+	return nil, fmt.Errorf("unknown mailer %q", config.Config.Mailer)
+}
+
+var (
+	mailer     Mailer
+	mailerErr  error
+	mailerOnce sync.Once
+)
+
+// GetMailer returns the singleton mailer. It is built on the first call; an
+// error building it is returned by every call.
+func GetMailer() (Mailer, error) {
+	mailerOnce.Do(func() {
+		mailer, mailerErr = NewMailer()
+	})
+	return mailer, mailerErr
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"context"
 	"github.com/golang-jwt/jwt/v4"
+	"web-scraper/internal/auth"
 )
 
 type contextKey string
@@ -17,3 +18,33 @@ func GetUserClaimsFromContext(ctx context.Context) (jwt.MapClaims, bool) {
 	claims, ok := ctx.Value(UserClaimsKey).(jwt.MapClaims)
 	return claims, ok
 }
+
+// GetUserIDFromContext returns the user_id claim of the authenticated user
+func GetUserIDFromContext(ctx context.Context) (string, bool) {
+	claims, ok := GetUserClaimsFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	userID, ok := claims["user_id"].(string)
+	return userID, ok && userID != ""
+}
+
+// GetRoleFromContext returns the role claim of the authenticated user.
+// Tokens issued before roles existed belong to plain users.
+func GetRoleFromContext(ctx context.Context) string {
+	claims, _ := GetUserClaimsFromContext(ctx)
+	if role, ok := claims["role"].(string); ok && role != "" {
+		return role
+	}
+	return auth.RoleUser
+}
+
+// GetEmailVerifiedFromContext reports whether the authenticated user has
+// verified their email. Tokens without the claim predate verification and
+// API keys can only be created by verified users, so both count as
+// verified.
+func GetEmailVerifiedFromContext(ctx context.Context) bool {
+	claims, _ := GetUserClaimsFromContext(ctx)
+	verified, ok := claims["email_verified"].(bool)
+	return verified || !ok
+}
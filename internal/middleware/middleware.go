@@ -2,13 +2,12 @@ package middleware
 
 import (
 	"encoding/json"
-	"fmt"
-	"github.com/golang-jwt/jwt/v4"
 	"log"
 	"net/http"
-	"os"
 	"strings"
 	"time"
+	"web-scraper/internal/auth"
+	"web-scraper/internal/config"
 )
 
 // LoggingMiddleware logs all requests
@@ -39,8 +38,29 @@ type AuthResponse struct {
 	Message string `json:"message"`
 }
 
+// AuthMiddleware requires a valid, unrevoked access token or API key and
+// puts its claims in the request context
 func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if apiKey := apiKeyFromRequest(r); apiKey != "" {
+			claims, err := auth.AuthenticateAPIKey(apiKey, r.URL.Path)
+			switch err {
+			case nil:
+				r = r.WithContext(setUserClaimsToContext(r.Context(), claims))
+				next(w, r)
+			case auth.ErrInvalidToken:
+				respondWithError(w, "Invalid API key", http.StatusUnauthorized)
+			case auth.ErrScope:
+				respondWithError(w, err.Error(), http.StatusForbidden)
+			case auth.ErrRateLimited:
+				respondWithError(w, err.Error(), http.StatusTooManyRequests)
+			default:
+				log.Printf("Error checking API key: %v", err)
+				respondWithError(w, "Internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
 			respondWithError(w, "No authorization header", http.StatusUnauthorized)
@@ -54,23 +74,14 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		tokenString := bearerToken[1]
-		claims := jwt.MapClaims{}
-
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
-
-		if err != nil {
+		claims, err := auth.ParseAccessToken(bearerToken[1])
+		if err == auth.ErrInvalidToken {
 			respondWithError(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
-
-		if !token.Valid {
-			respondWithError(w, "Invalid token", http.StatusUnauthorized)
+		if err != nil {
+			log.Printf("Error checking token: %v", err)
+			respondWithError(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
@@ -80,6 +91,48 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// apiKeyFromRequest returns the API key sent as "Authorization: ApiKey ..."
+// or in the X-API-Key header
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "ApiKey "); ok {
+		return strings.TrimSpace(key)
+	}
+	return ""
+}
+
+// RequireRole only lets users with one of the roles through. It must run
+// after AuthMiddleware, i.e. come before it in ChainMiddleware.
+func RequireRole(roles ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			role := GetRoleFromContext(r.Context())
+			for _, allowed := range roles {
+				if role == allowed {
+					next(w, r)
+					return
+				}
+			}
+			respondWithError(w, "Insufficient role", http.StatusForbidden)
+		}
+	}
+}
+
+// RequireVerifiedEmail turns away users who have not verified their email
+// unless verification is disabled. Like RequireRole it must run after
+// AuthMiddleware.
+func RequireVerifiedEmail(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.Config.RequireEmailVerification && !GetEmailVerifiedFromContext(r.Context()) {
+			respondWithError(w, "Email address not verified", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
 func respondWithError(w http.ResponseWriter, message string, status int) {
 	response := AuthResponse{
 		Success: false,
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// APIKey is a long-lived credential for service access. Only a hash of the
+// key is stored; Prefix identifies it in listings.
+type APIKey struct {
+	ID     string   `json:"id"`
+	UserID string   `json:"user_id"`
+	Name   string   `json:"name"`
+	Prefix string   `json:"prefix"`
+	Scopes []string `json:"scopes"`
+	// RateLimit is the number of requests per minute the key may make
+	RateLimit int `json:"rate_limit"`
+
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+
+	// Identity of the owner when the key was created, put in the request
+	// claims like those of an access token
+	Username string `json:"username"`
+	Email    string `json:"email,omitempty"`
+}
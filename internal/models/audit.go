@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Audit event types
+const (
+	AuditLoginFailed       = "login_failed"
+	AuditLoginLocked       = "login_locked"
+	AuditLoginBlocked      = "login_blocked"
+	AuditCaptchaFailed     = "captcha_failed"
+	AuditLoginAfterFailure = "login_after_failures"
+	AuditLockoutReset      = "lockout_reset"
+	AuditOIDCLinked        = "oidc_linked"
+	AuditOIDCProvisioned   = "oidc_provisioned"
+)
+
+// AuditEvent records a security relevant event such as a failed login
+type AuditEvent struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Username string `json:"username,omitempty"`
+	UserID   string `json:"user_id,omitempty"`
+	IP       string `json:"ip,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
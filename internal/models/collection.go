@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Collection groups search results saved by a user
+type Collection struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	ItemCount   int       `json:"item_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	// Items is set when a single collection is returned
+	Items []CollectionItem `json:"items,omitempty"`
+}
+
+// CollectionItem is a saved search result with the user's annotations. The
+// result keeps the page content as it was when saved.
+type CollectionItem struct {
+	ID           string       `json:"id"`
+	CollectionID string       `json:"collection_id"`
+	Result       SearchResult `json:"result"`
+	Note         string       `json:"note,omitempty"`
+	Tags         []string     `json:"tags,omitempty"`
+	SavedAt      time.Time    `json:"saved_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// Crawl statuses
+const (
+	CrawlQueued    = "queued"
+	CrawlRunning   = "running"
+	CrawlCompleted = "completed"
+	CrawlFailed    = "failed"
+)
+
+// CrawlOptions bound a site crawl
+type CrawlOptions struct {
+	SeedURL string `json:"seed_url"`
+	// MaxDepth is the number of link hops followed from the seed
+	MaxDepth int `json:"max_depth"`
+	MaxPages int `json:"max_pages"`
+	// AnyHost follows links to other hosts; by default the crawl stays on
+	// the seed's host
+	AnyHost    bool   `json:"any_host"`
+	PathPrefix string `json:"path_prefix,omitempty"`
+	// Allow and Deny are regular expressions matched against page URLs
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+	// Sitemap also crawls the URLs listed in the host's sitemap.xml
+	Sitemap bool   `json:"sitemap"`
+	Format  string `json:"format"`
+}
+
+type Crawl struct {
+	ID         string       `json:"id"`
+	UserID     string       `json:"user_id"`
+	Options    CrawlOptions `json:"options"`
+	Status     string       `json:"status"`
+	Pages      int          `json:"pages"`
+	Error      string       `json:"error,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+	StartedAt  *time.Time   `json:"started_at,omitempty"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+}
+
+// CrawlPage is a page fetched by a crawl
+type CrawlPage struct {
+	URL        string            `json:"url"`
+	Depth      int               `json:"depth"`
+	Title      string            `json:"title"`
+	Content    string            `json:"content"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	StatusCode int               `json:"status_code"`
+	Error      string            `json:"error,omitempty"`
+	FetchedAt  time.Time         `json:"fetched_at"`
+}
+
+type CrawlPagesResponse struct {
+	CrawlID string      `json:"crawl_id"`
+	Total   int         `json:"total"`
+	Offset  int         `json:"offset"`
+	Limit   int         `json:"limit"`
+	Pages   []CrawlPage `json:"pages"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// HistoryEntry records a search made by a user
+type HistoryEntry struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	Query  string `json:"query"`
+	// Type is "search" or "deep"
+	Type    string   `json:"type"`
+	Mode    string   `json:"mode,omitempty"`
+	Style   string   `json:"style"`
+	Engines []string `json:"engines"`
+	// Schema is the name of the output schema for JSON output; custom
+	// schemas are kept in CustomSchema so the search can be replayed
+	Schema       string          `json:"schema,omitempty"`
+	CustomSchema json.RawMessage `json:"custom_schema,omitempty"`
+	Rewrite      bool            `json:"rewrite,omitempty"`
+	MaxQueries   int             `json:"max_queries,omitempty"`
+	Rerank       bool            `json:"rerank,omitempty"`
+
+	CacheHit    bool      `json:"cache_hit"`
+	ResultCount int       `json:"result_count"`
+	SessionID   string    `json:"session_id,omitempty"`
+	Duration    string    `json:"duration"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type HistoryResponse struct {
+	Total   int            `json:"total"`
+	Offset  int            `json:"offset"`
+	Limit   int            `json:"limit"`
+	Entries []HistoryEntry `json:"entries"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// IndexedPage is a scraped page stored in the local full-text index
+type IndexedPage struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Content     string `json:"content,omitempty"`
+	Source      string `json:"source"`
+	// Read from the page's link and meta tags when present
+	Canonical     string    `json:"canonical,omitempty"`
+	Language      string    `json:"language,omitempty"`
+	PublishedTime string    `json:"published_time,omitempty"`
+	FetchedAt     time.Time `json:"fetched_at"`
+}
+
+type IndexHit struct {
+	IndexedPage
+	Score      float64  `json:"score"`
+	Highlights []string `json:"highlights,omitempty"`
+}
+
+type IndexSearchResponse struct {
+	Query    string     `json:"query"`
+	Total    uint64     `json:"total"`
+	Hits     []IndexHit `json:"hits"`
+	Duration string     `json:"duration"`
+}
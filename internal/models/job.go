@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Job statuses
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// Job types
+const (
+	JobSearch = "search"
+	JobDeep   = "deep"
+)
+
+// Job is a search run in the background
+type Job struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	Type   string `json:"type"`
+	// Params are the query parameters of the equivalent search request
+	Params map[string]string `json:"params"`
+	// Schema is a custom JSON Schema for output=json
+	Schema      json.RawMessage `json:"schema,omitempty"`
+	CallbackURL string          `json:"callback_url,omitempty"`
+	// WebhookSecret signs the callback. It is only shown on creation.
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+
+	Status string `json:"status"`
+	// Stage is the step a running job is at, e.g. "searching"
+	Stage    string           `json:"stage,omitempty"`
+	Result   *SearchResponse  `json:"result,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	Callback *WebhookDelivery `json:"callback,omitempty"`
+
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// WithoutSecret returns a copy of the job without its webhook secret
+func (j Job) WithoutSecret() *Job {
+	j.WebhookSecret = ""
+	return &j
+}
@@ -0,0 +1,80 @@
+package models
+
+import "time"
+
+// Monitor is a saved search run on a schedule to detect changes
+type Monitor struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+	Query  string `json:"query"`
+	// Engines are engine names, e.g. "duckduckgo"
+	Engines []string `json:"engines"`
+	// Schedule is a cron expression or descriptor such as "@daily"
+	Schedule string `json:"schedule"`
+	// Deep also fetches page content so content changes are detected
+	Deep       bool   `json:"deep"`
+	WebhookURL string `json:"webhook_url,omitempty"`
+	// WebhookSecret signs the alerts. It is only shown when it is created.
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+	Paused        bool   `json:"paused"`
+
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// WithoutSecret returns a copy of the monitor without its webhook secret
+func (m Monitor) WithoutSecret() *Monitor {
+	m.WebhookSecret = ""
+	return &m
+}
+
+// MonitorResult is a search result as recorded by a monitor run
+type MonitorResult struct {
+	Title   string `json:"title"`
+	Link    string `json:"link"`
+	Snippet string `json:"snippet,omitempty"`
+	Source  string `json:"source,omitempty"`
+	// ContentHash is the hash of the page content, set for deep monitors
+	ContentHash string `json:"content_hash,omitempty"`
+}
+
+// MonitorChanges is the difference between two monitor runs
+type MonitorChanges struct {
+	New     []MonitorResult `json:"new"`
+	Changed []MonitorResult `json:"changed"`
+	Dropped []MonitorResult `json:"dropped"`
+}
+
+func (c MonitorChanges) Empty() bool {
+	return len(c.New) == 0 && len(c.Changed) == 0 && len(c.Dropped) == 0
+}
+
+// MonitorRun records one run of a monitor
+type MonitorRun struct {
+	ID        string `json:"id"`
+	MonitorID string `json:"monitor_id"`
+	// Baseline is set on the first run, which has nothing to compare with
+	Baseline    bool             `json:"baseline,omitempty"`
+	ResultCount int              `json:"result_count"`
+	Changes     *MonitorChanges  `json:"changes,omitempty"`
+	Summary     string           `json:"summary,omitempty"`
+	TokenUsage  *TokenUsage      `json:"token_usage,omitempty"`
+	Alert       *WebhookDelivery `json:"alert,omitempty"`
+	Error       string           `json:"error,omitempty"`
+
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// MonitorAlert is the webhook payload sent when a run finds changes
+type MonitorAlert struct {
+	Monitor *Monitor       `json:"monitor"`
+	RunID   string         `json:"run_id"`
+	Changes MonitorChanges `json:"changes"`
+	Summary string         `json:"summary"`
+	RunAt   time.Time      `json:"run_at"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "encoding/json"
+
+// ResearchReport is the result of a research agent run
+type ResearchReport struct {
+	Question string           `json:"question"`
+	Report   string           `json:"report"`
+	Sources  []ResearchSource `json:"sources"`
+	Trace    []ResearchStep   `json:"trace"`
+	// StopReason is "complete", "max_steps", "token_budget" or "timeout"
+	StopReason string      `json:"stop_reason"`
+	TokenUsage *TokenUsage `json:"token_usage,omitempty"`
+	Duration   string      `json:"duration"`
+}
+
+// ResearchSource is a page found during research; reports cite it as [ID]
+type ResearchSource struct {
+	ID      int    `json:"id"`
+	Title   string `json:"title"`
+	Link    string `json:"link"`
+	Snippet string `json:"snippet"`
+	Read    bool   `json:"read"`
+}
+
+// ResearchStep is one tool call made by the agent
+type ResearchStep struct {
+	Step int `json:"step"`
+	// Thought is the text the model wrote alongside its tool calls
+	Thought     string          `json:"thought,omitempty"`
+	Tool        string          `json:"tool"`
+	Arguments   json.RawMessage `json:"arguments"`
+	Observation string          `json:"observation"`
+	Tokens      int             `json:"tokens"`
+}
@@ -1,16 +1,40 @@
 package models
 
+import "encoding/json"
+
 type SearchResult struct {
 	Title        string `json:"title"`
 	Snippet      string `json:"snippet"`
 	Link         string `json:"link"`
 	InnerContent string `json:"inner_content"`
 	Source       string `json:"source"`
+	Summary      string `json:"summary,omitempty"`
+	// Relevance is the semantic similarity to the query when reranked
+	Relevance float64 `json:"relevance,omitempty"`
+	// Metadata of a fetched page (meta tags, status, fetch time)
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 type SearchResponse struct {
-	Query           string         `json:"query"`
-	Results         []SearchResult `json:"results"`
-	FormattedResult string         `json:"formatted_result"`
-	Duration        string         `json:"duration"`
+	Query string `json:"query"`
+	// RewrittenQueries are the engine queries used when query rewriting is on
+	RewrittenQueries []string       `json:"rewritten_queries,omitempty"`
+	Results          []SearchResult `json:"results"`
+	FormattedResult  string         `json:"formatted_result"`
+	Duration         string         `json:"duration"`
+	TokenUsage       *TokenUsage    `json:"token_usage,omitempty"`
+	// Structured is the schema-validated answer when output=json was requested
+	Schema     string          `json:"schema,omitempty"`
+	Structured json.RawMessage `json:"structured,omitempty"`
+	// SessionID identifies the stored session for follow-up questions
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// TokenUsage reports how much of the provider context the AI step used
+type TokenUsage struct {
+	ContextTokens    int `json:"context_tokens"`
+	ContextLimit     int `json:"context_limit"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
 }
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Session keeps the results and page content of a search so follow-up
+// questions can be answered without scraping everything again
+type Session struct {
+	ID        string         `json:"id"`
+	UserID    string         `json:"user_id"`
+	Query     string         `json:"query"`
+	Results   []SearchResult `json:"results"`
+	Turns     []SessionTurn  `json:"turns"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// SessionTurn is one message of the follow-up conversation
+type SessionTurn struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// Queries searched to answer this question, if any
+	Queries []string  `json:"queries,omitempty"`
+	At      time.Time `json:"at"`
+}
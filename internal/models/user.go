@@ -10,5 +10,9 @@ type User struct {
 	ActiveCommand *string `json:"active_command"`
 	HashPass      string  `json:"hash_pass"`
 	Email         string  `json:"email"`
+	EmailVerified bool    `json:"email_verified"`
 	IP            string  `json:"ip"`
+	Role          string  `json:"role"`
+	// OIDCSubject links the account to a single sign-on identity
+	OIDCSubject string `json:"oidc_subject,omitempty"`
 }
@@ -0,0 +1,9 @@
+package models
+
+// WebhookDelivery records the delivery of a signed webhook
+type WebhookDelivery struct {
+	Delivered  bool   `json:"delivered"`
+	Attempts   int    `json:"attempts"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
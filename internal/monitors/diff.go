@@ -0,0 +1,95 @@
+package monitors
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"web-scraper/internal/models"
+	"web-scraper/internal/search"
+)
+
+// snapshot records the results of a run, one per normalized URL
+func snapshot(results []models.SearchResult) []models.MonitorResult {
+	index := map[string]int{}
+	var recorded []models.MonitorResult
+	for _, result := range results {
+		key := search.NormalizeURL(result.Link)
+		hash := contentHash(result.InnerContent)
+		if i, ok := index[key]; ok {
+			// Several engines can return the same page
+			if recorded[i].ContentHash == "" {
+				recorded[i].ContentHash = hash
+			}
+			continue
+		}
+		index[key] = len(recorded)
+		recorded = append(recorded, models.MonitorResult{
+			Title:       result.Title,
+			Link:        result.Link,
+			Snippet:     result.Snippet,
+			Source:      result.Source,
+			ContentHash: hash,
+		})
+	}
+	return recorded
+}
+
+// contentHash hashes page content with whitespace collapsed, so reflowed
+// markup does not count as a change. Empty content has no hash.
+func contentHash(content string) string {
+	normalized := strings.Join(strings.Fields(content), " ")
+	if normalized == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:16])
+}
+
+// diff compares the results of a run with the previous one. A page counts
+// as changed only when both runs fetched its content.
+func diff(previous, current []models.MonitorResult) models.MonitorChanges {
+	before := map[string]models.MonitorResult{}
+	for _, result := range previous {
+		before[search.NormalizeURL(result.Link)] = result
+	}
+
+	var changes models.MonitorChanges
+	seen := map[string]bool{}
+	for _, result := range current {
+		key := search.NormalizeURL(result.Link)
+		seen[key] = true
+		old, ok := before[key]
+		switch {
+		case !ok:
+			changes.New = append(changes.New, result)
+		case old.ContentHash != "" && result.ContentHash != "" && old.ContentHash != result.ContentHash:
+			changes.Changed = append(changes.Changed, result)
+		}
+	}
+	for _, result := range previous {
+		if !seen[search.NormalizeURL(result.Link)] {
+			changes.Dropped = append(changes.Dropped, result)
+		}
+	}
+	return changes
+}
+
+// changedResults returns the full search results of the new and changed
+// pages, new ones first
+func changedResults(changes models.MonitorChanges, results []models.SearchResult) []models.SearchResult {
+	byKey := map[string]models.SearchResult{}
+	for _, result := range results {
+		key := search.NormalizeURL(result.Link)
+		if _, ok := byKey[key]; !ok || byKey[key].InnerContent == "" {
+			byKey[key] = result
+		}
+	}
+
+	var changed []models.SearchResult
+	for _, list := range [][]models.MonitorResult{changes.New, changes.Changed} {
+		for _, result := range list {
+			changed = append(changed, byKey[search.NormalizeURL(result.Link)])
+		}
+	}
+	return changed
+}
@@ -0,0 +1,262 @@
+package monitors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/robfig/cron/v3"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+	"web-scraper/internal/config"
+	"web-scraper/internal/fetcher"
+	"web-scraper/internal/jobs"
+	"web-scraper/internal/models"
+	"web-scraper/internal/storage"
+)
+
+// ErrRunning is returned by RunNow while the monitor is already running
+var ErrRunning = errors.New("monitor is already running")
+
+// Searcher runs the search of a monitor
+type Searcher func(monitor *models.Monitor) ([]models.SearchResult, error)
+
+// Summarizer writes a "what's new" summary of the changes found by a run.
+// results are the new and changed pages, new ones first.
+type Summarizer func(monitor *models.Monitor, changes models.MonitorChanges, results []models.SearchResult) (string, *models.TokenUsage, error)
+
+// Notifier is told about runs that found changes, after the webhook alert
+type Notifier func(monitor *models.Monitor, run *models.MonitorRun)
+
+var (
+	scheduler  *cron.Cron
+	searcher   Searcher
+	summarizer Summarizer
+	// slots bounds the number of monitors running at once
+	slots chan struct{}
+
+	entriesMu sync.Mutex
+	entries   = map[string]cron.EntryID{}
+	running   sync.Map
+
+	notifiersMu sync.Mutex
+	notifiers   []Notifier
+)
+
+// AddNotifier registers a notifier for runs that found changes
+func AddNotifier(notifier Notifier) {
+	notifiersMu.Lock()
+	defer notifiersMu.Unlock()
+	notifiers = append(notifiers, notifier)
+}
+
+// ParseSchedule parses a standard cron expression or descriptor and rejects
+// schedules firing more often than minInterval
+func ParseSchedule(spec string, minInterval time.Duration) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid schedule: %v", err)
+	}
+
+	// Cron gaps vary, e.g. "0,5 * * * *", so check a few of them
+	prev := schedule.Next(time.Now())
+	for i := 0; i < 10; i++ {
+		next := schedule.Next(prev)
+		if next.IsZero() {
+			break
+		}
+		if next.Sub(prev) < minInterval {
+			return nil, fmt.Errorf("Schedule runs more often than every %s", minInterval)
+		}
+		prev = next
+	}
+	return schedule, nil
+}
+
+// Start schedules all stored monitors and starts the scheduler
+func Start(search Searcher, summarize Summarizer, concurrency int) error {
+	searcher = search
+	summarizer = summarize
+	slots = make(chan struct{}, concurrency)
+	scheduler = cron.New()
+
+	var monitors []models.Monitor
+	err := storage.GetStore().ForEach(monitorsBucket, "", func(key string, data []byte) error {
+		var monitor models.Monitor
+		if err := json.Unmarshal(data, &monitor); err != nil {
+			log.Printf("Error decoding monitor %s: %v", key, err)
+			return nil
+		}
+		monitors = append(monitors, monitor)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := range monitors {
+		Schedule(&monitors[i])
+	}
+
+	scheduler.Start()
+	log.Printf("Scheduled %d monitors", len(entries))
+	return nil
+}
+
+// Schedule registers the monitor with the scheduler, replacing its previous
+// schedule. Paused monitors are only removed.
+func Schedule(monitor *models.Monitor) {
+	if scheduler == nil {
+		return
+	}
+	Unschedule(monitor.ID)
+	if monitor.Paused {
+		return
+	}
+
+	schedule, err := cron.ParseStandard(monitor.Schedule)
+	if err != nil {
+		log.Printf("Monitor %s has an invalid schedule %q: %v", monitor.ID, monitor.Schedule, err)
+		return
+	}
+
+	id := monitor.ID
+	entriesMu.Lock()
+	entries[id] = scheduler.Schedule(schedule, cron.FuncJob(func() {
+		if _, err := RunNow(id); err != nil {
+			log.Printf("Monitor %s: %v", id, err)
+		}
+	}))
+	entriesMu.Unlock()
+}
+
+func Unschedule(id string) {
+	entriesMu.Lock()
+	defer entriesMu.Unlock()
+	if entry, ok := entries[id]; ok {
+		scheduler.Remove(entry)
+		delete(entries, id)
+	}
+}
+
+// NextRun returns when the monitor runs next, or nil if it is not scheduled
+func NextRun(id string) *time.Time {
+	entriesMu.Lock()
+	entry, ok := entries[id]
+	entriesMu.Unlock()
+	if !ok {
+		return nil
+	}
+	next := scheduler.Entry(entry).Next
+	if next.IsZero() {
+		// Not yet computed until the scheduler picks up the new entry
+		next = scheduler.Entry(entry).Schedule.Next(time.Now())
+	}
+	return &next
+}
+
+// RunNow runs the monitor, compares its results with the previous run and
+// alerts the webhook if anything changed
+func RunNow(id string) (*models.MonitorRun, error) {
+	lock, _ := running.LoadOrStore(id, &sync.Mutex{})
+	if !lock.(*sync.Mutex).TryLock() {
+		return nil, ErrRunning
+	}
+	defer lock.(*sync.Mutex).Unlock()
+
+	slots <- struct{}{}
+	defer func() { <-slots }()
+
+	monitor, found, err := load(id)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("monitor not found")
+	}
+
+	run, current := execute(monitor)
+	if err := recordRun(monitor, run, current, config.Config.MonitorRunHistory); err != nil {
+		return run, fmt.Errorf("error saving run: %v", err)
+	}
+	return run, nil
+}
+
+// execute runs the search and diffs it against the stored snapshot. It
+// returns the snapshot of the new results, or nil if the search failed.
+func execute(monitor *models.Monitor) (*models.MonitorRun, []models.MonitorResult) {
+	run := &models.MonitorRun{
+		ID:        storage.NewID(),
+		MonitorID: monitor.ID,
+		StartedAt: time.Now(),
+	}
+	defer func() {
+		run.FinishedAt = time.Now()
+	}()
+
+	results, err := searcher(monitor)
+	if err == nil && len(results) == 0 {
+		// Usually an engine failure; diffing it would report every
+		// result as dropped
+		err = fmt.Errorf("search returned no results")
+	}
+	if err != nil {
+		run.Error = err.Error()
+		return run, nil
+	}
+
+	current := snapshot(results)
+	run.ResultCount = len(current)
+	previous, found, err := loadSnapshot(monitor.ID)
+	if err != nil {
+		run.Error = err.Error()
+		return run, nil
+	}
+	if !found {
+		run.Baseline = true
+		return run, current
+	}
+
+	changes := diff(previous, current)
+	if changes.Empty() {
+		return run, current
+	}
+	run.Changes = &changes
+	log.Printf("Monitor %s found %d new, %d changed and %d dropped results",
+		monitor.ID, len(changes.New), len(changes.Changed), len(changes.Dropped))
+
+	run.Summary, run.TokenUsage, err = summarizer(monitor, changes, changedResults(changes, results))
+	if err != nil {
+		log.Printf("Monitor %s summary error: %v", monitor.ID, err)
+		run.Summary = fmt.Sprintf("%d new, %d changed and %d dropped results for %q.",
+			len(changes.New), len(changes.Changed), len(changes.Dropped), monitor.Query)
+	}
+
+	if monitor.WebhookURL != "" && config.Config.WebhooksEnabled {
+		run.Alert = deliverAlert(monitor, run, changes)
+	}
+
+	notifiersMu.Lock()
+	notify := notifiers
+	notifiersMu.Unlock()
+	for _, notifier := range notify {
+		notifier(monitor, run)
+	}
+	return run, current
+}
+
+// deliverAlert posts the changes of a run to the monitor's webhook. Monitors
+// saved before webhook hosts were checked may still point at internal
+// addresses; those are reported as failed without being contacted.
+func deliverAlert(monitor *models.Monitor, run *models.MonitorRun, changes models.MonitorChanges) *models.WebhookDelivery {
+	if u, err := url.Parse(monitor.WebhookURL); err != nil || fetcher.CheckHost(u.Hostname()) != nil {
+		return &models.WebhookDelivery{Error: "webhook_url host is not a public address"}
+	}
+	return jobs.Deliver(monitor.WebhookURL, monitor.WebhookSecret, run.ID, models.MonitorAlert{
+		Monitor: monitor.WithoutSecret(),
+		RunID:   run.ID,
+		Changes: changes,
+		Summary: run.Summary,
+		RunAt:   run.StartedAt,
+	})
+}
@@ -0,0 +1,226 @@
+package monitors
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"web-scraper/internal/models"
+	"web-scraper/internal/storage"
+)
+
+const (
+	monitorsBucket  = "monitors"
+	snapshotsBucket = "monitor_snapshots"
+	runsBucket      = "monitor_runs"
+)
+
+// mu serializes read-modify-write updates of monitor records
+var mu sync.Mutex
+
+// Create stores a new monitor and schedules it
+func Create(monitor *models.Monitor) error {
+	now := time.Now()
+	monitor.ID = storage.NewID()
+	monitor.CreatedAt = now
+	monitor.UpdatedAt = now
+	if err := storage.GetStore().Put(monitorsBucket, monitor.ID, monitor); err != nil {
+		return err
+	}
+	Schedule(monitor)
+	monitor.NextRunAt = NextRun(monitor.ID)
+	return nil
+}
+
+// Get returns the monitor if it exists and belongs to the user
+func Get(id, userID string) (*models.Monitor, bool, error) {
+	monitor, found, err := load(id)
+	if err != nil || !found || monitor.UserID != userID {
+		return nil, false, err
+	}
+	monitor.NextRunAt = NextRun(monitor.ID)
+	return monitor, true, nil
+}
+
+// List returns the user's monitors, oldest first
+func List(userID string) ([]models.Monitor, error) {
+	monitors := []models.Monitor{}
+	err := storage.GetStore().ForEach(monitorsBucket, "", func(key string, data []byte) error {
+		var monitor models.Monitor
+		if err := json.Unmarshal(data, &monitor); err != nil {
+			return fmt.Errorf("error decoding monitor %s: %v", key, err)
+		}
+		if monitor.UserID == userID {
+			monitor.NextRunAt = NextRun(monitor.ID)
+			monitors = append(monitors, monitor)
+		}
+		return nil
+	})
+	sort.Slice(monitors, func(i, j int) bool {
+		return monitors[i].CreatedAt.Before(monitors[j].CreatedAt)
+	})
+	return monitors, err
+}
+
+// Update applies fn to the user's monitor, saves and reschedules it. A
+// monitor whose search changed starts again from a new baseline.
+func Update(id, userID string, fn func(monitor *models.Monitor) error) (*models.Monitor, bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	monitor, found, err := load(id)
+	if err != nil || !found || monitor.UserID != userID {
+		return nil, false, err
+	}
+	before := *monitor
+	if err := fn(monitor); err != nil {
+		return nil, true, err
+	}
+	monitor.ID = before.ID
+	monitor.UserID = before.UserID
+	monitor.CreatedAt = before.CreatedAt
+	monitor.UpdatedAt = time.Now()
+
+	if monitor.Query != before.Query || monitor.Deep != before.Deep ||
+		fmt.Sprint(monitor.Engines) != fmt.Sprint(before.Engines) {
+		if err := storage.GetStore().Delete(snapshotsBucket, id); err != nil {
+			return nil, true, err
+		}
+	}
+	if err := storage.GetStore().Put(monitorsBucket, id, monitor); err != nil {
+		return nil, true, err
+	}
+
+	Schedule(monitor)
+	monitor.NextRunAt = NextRun(monitor.ID)
+	return monitor, true, nil
+}
+
+// Delete removes the user's monitor with its snapshot and run history
+func Delete(id, userID string) (bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	monitor, found, err := load(id)
+	if err != nil || !found || monitor.UserID != userID {
+		return false, err
+	}
+	Unschedule(id)
+
+	store := storage.GetStore()
+	keys, err := runKeys(id)
+	if err != nil {
+		return true, err
+	}
+	for _, key := range keys {
+		if err := store.Delete(runsBucket, key); err != nil {
+			return true, err
+		}
+	}
+	if err := store.Delete(snapshotsBucket, id); err != nil {
+		return true, err
+	}
+	return true, store.Delete(monitorsBucket, id)
+}
+
+// Count returns the number of monitors the user has
+func Count(userID string) (int, error) {
+	monitors, err := List(userID)
+	return len(monitors), err
+}
+
+// Runs returns up to limit runs of a monitor, newest first
+func Runs(monitorID string, limit int) ([]models.MonitorRun, error) {
+	var runs []models.MonitorRun
+	err := storage.GetStore().ForEach(runsBucket, monitorID+"/", func(key string, data []byte) error {
+		var run models.MonitorRun
+		if err := json.Unmarshal(data, &run); err != nil {
+			return fmt.Errorf("error decoding %s: %v", key, err)
+		}
+		runs = append(runs, run)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	newest := []models.MonitorRun{}
+	for i := len(runs) - 1; i >= 0 && len(newest) < limit; i-- {
+		newest = append(newest, runs[i])
+	}
+	return newest, nil
+}
+
+func load(id string) (*models.Monitor, bool, error) {
+	var monitor models.Monitor
+	found, err := storage.GetStore().Get(monitorsBucket, id, &monitor)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	return &monitor, true, nil
+}
+
+// recordRun saves a finished run with the snapshot of its results, updates
+// the monitor's last run and drops runs beyond the history limit
+func recordRun(ran *models.Monitor, run *models.MonitorRun, current []models.MonitorResult, history int) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	monitor, found, err := load(run.MonitorID)
+	if err != nil || !found {
+		// Deleted while it was running
+		return err
+	}
+	monitor.LastRunAt = &run.StartedAt
+	monitor.LastError = run.Error
+
+	store := storage.GetStore()
+	if err := store.Put(monitorsBucket, monitor.ID, monitor); err != nil {
+		return err
+	}
+	// A search edited during the run has already been reset to a new baseline
+	sameSearch := monitor.Query == ran.Query && monitor.Deep == ran.Deep &&
+		fmt.Sprint(monitor.Engines) == fmt.Sprint(ran.Engines)
+	if current != nil && sameSearch {
+		if err := store.Put(snapshotsBucket, monitor.ID, current); err != nil {
+			return err
+		}
+	}
+	if err := store.Put(runsBucket, runKey(run.MonitorID, run.StartedAt), run); err != nil {
+		return err
+	}
+
+	keys, err := runKeys(run.MonitorID)
+	if err != nil {
+		return err
+	}
+	for len(keys) > history {
+		if err := store.Delete(runsBucket, keys[0]); err != nil {
+			return err
+		}
+		keys = keys[1:]
+	}
+	return nil
+}
+
+// runKey orders the runs of a monitor by start time
+func runKey(monitorID string, startedAt time.Time) string {
+	return fmt.Sprintf("%s/%020d", monitorID, startedAt.UnixNano())
+}
+
+func runKeys(monitorID string) ([]string, error) {
+	var keys []string
+	err := storage.GetStore().ForEach(runsBucket, monitorID+"/", func(key string, data []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	return keys, err
+}
+
+// loadSnapshot returns the results of the monitor's last successful run
+func loadSnapshot(monitorID string) ([]models.MonitorResult, bool, error) {
+	var results []models.MonitorResult
+	found, err := storage.GetStore().Get(snapshotsBucket, monitorID, &results)
+	return results, found, err
+}
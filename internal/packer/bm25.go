@@ -0,0 +1,119 @@
+package packer
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// BM25 tuning parameters, standard Okapi defaults
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "for": true, "from": true, "how": true, "in": true,
+	"is": true, "it": true, "of": true, "on": true, "or": true, "that": true,
+	"the": true, "this": true, "to": true, "was": true, "what": true,
+	"when": true, "where": true, "which": true, "who": true, "why": true,
+	"will": true, "with": true,
+}
+
+// Terms lowercases text and splits it into indexable terms
+func Terms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := words[:0]
+	for _, w := range words {
+		if len(w) < 2 || stopwords[w] {
+			continue
+		}
+		terms = append(terms, w)
+	}
+	return terms
+}
+
+// Chunk splits text into passages of roughly chunkWords words, preferring to
+// break at the end of a sentence
+func Chunk(text string, chunkWords int) []string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return nil
+	}
+
+	var chunks []string
+	start := 0
+	for i, w := range words {
+		size := i - start + 1
+		sentenceEnd := strings.HasSuffix(w, ".") || strings.HasSuffix(w, "!") || strings.HasSuffix(w, "?")
+		if (size >= chunkWords && sentenceEnd) || size >= chunkWords*3/2 {
+			chunks = append(chunks, strings.Join(words[start:i+1], " "))
+			start = i + 1
+		}
+	}
+	if start < len(words) {
+		chunks = append(chunks, strings.Join(words[start:], " "))
+	}
+	return chunks
+}
+
+// BM25 scores a fixed set of documents against a query
+type BM25 struct {
+	docs   []map[string]int
+	lens   []int
+	df     map[string]int
+	avgLen float64
+}
+
+func NewBM25(docs []string) *BM25 {
+	index := &BM25{
+		docs: make([]map[string]int, len(docs)),
+		lens: make([]int, len(docs)),
+		df:   make(map[string]int),
+	}
+
+	total := 0
+	for i, doc := range docs {
+		terms := Terms(doc)
+		tf := make(map[string]int, len(terms))
+		for _, t := range terms {
+			tf[t]++
+		}
+		for t := range tf {
+			index.df[t]++
+		}
+		index.docs[i] = tf
+		index.lens[i] = len(terms)
+		total += len(terms)
+	}
+
+	if len(docs) > 0 {
+		index.avgLen = float64(total) / float64(len(docs))
+	}
+	return index
+}
+
+// Score returns the BM25 score of document i for the query terms
+func (b *BM25) Score(i int, query []string) float64 {
+	if b.avgLen == 0 {
+		return 0
+	}
+
+	n := float64(len(b.docs))
+	score := 0.0
+	for _, term := range query {
+		tf := float64(b.docs[i][term])
+		if tf == 0 {
+			continue
+		}
+		df := float64(b.df[term])
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		norm := tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(b.lens[i])/b.avgLen))
+		score += idf * norm
+	}
+	return score
+}
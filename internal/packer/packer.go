@@ -0,0 +1,160 @@
+package packer
+
+import (
+	"sort"
+	"web-scraper/internal/models"
+)
+
+const (
+	defaultChunkWords = 120
+	// Tokens spent on labels and separators around each result
+	resultOverhead = 16
+)
+
+type Options struct {
+	// Budget is the number of tokens available for result context
+	Budget     int
+	Tokenizer  Tokenizer
+	ChunkWords int
+}
+
+// PackedResult is a search result with only its most relevant passages kept
+type PackedResult struct {
+	models.SearchResult
+	Rank     int
+	Passages []string
+	Tokens   int
+}
+
+type Packed struct {
+	Results []PackedResult
+	Tokens  int
+	Budget  int
+}
+
+type chunk struct {
+	result int
+	index  int
+	text   string
+	score  float64
+	tokens int
+}
+
+// Pack selects passages from each result so the whole context fits in
+// opts.Budget tokens. Higher ranked results get a larger share of the budget
+// (weight 1/rank), and any share a result does not use rolls over to the
+// results after it. Within a result, chunks are picked by BM25 relevance to
+// the query and emitted in their original order.
+func Pack(query string, results []models.SearchResult, opts Options) Packed {
+	if opts.Tokenizer == nil {
+		opts.Tokenizer = estimateTokenizer{}
+	}
+	if opts.ChunkWords <= 0 {
+		opts.ChunkWords = defaultChunkWords
+	}
+
+	// Chunk every page and score all chunks against one shared index so
+	// term rarity is measured across the whole result set
+	var texts []string
+	perResult := make([][]chunk, len(results))
+	for i, result := range results {
+		for j, text := range Chunk(result.InnerContent, opts.ChunkWords) {
+			perResult[i] = append(perResult[i], chunk{result: i, index: j, text: text})
+			texts = append(texts, text)
+		}
+	}
+
+	index := NewBM25(texts)
+	queryTerms := Terms(query)
+	n := 0
+	for i := range perResult {
+		for j := range perResult[i] {
+			perResult[i][j].score = index.Score(n, queryTerms)
+			n++
+		}
+	}
+
+	weights := make([]float64, len(results))
+	weightLeft := 0.0
+	for i := range results {
+		weights[i] = 1 / float64(i+1)
+		weightLeft += weights[i]
+	}
+
+	packed := Packed{Budget: opts.Budget}
+	remaining := opts.Budget
+	for i, result := range results {
+		share := int(float64(remaining) * weights[i] / weightLeft)
+		weightLeft -= weights[i]
+
+		header := resultOverhead +
+			opts.Tokenizer.Count(result.Title) +
+			opts.Tokenizer.Count(result.Link) +
+			opts.Tokenizer.Count(result.Snippet)
+		if header > remaining {
+			break
+		}
+
+		used := header
+		selected := selectChunks(perResult[i], share-used, opts.Tokenizer)
+		var passages []string
+		for _, c := range selected {
+			passages = append(passages, c.text)
+			used += c.tokens
+		}
+
+		packed.Results = append(packed.Results, PackedResult{
+			SearchResult: result,
+			Rank:         i + 1,
+			Passages:     passages,
+			Tokens:       used,
+		})
+		packed.Tokens += used
+		remaining -= used
+	}
+
+	return packed
+}
+
+// selectChunks picks the highest scoring chunks that fit into budget and
+// returns them in document order
+func selectChunks(chunks []chunk, budget int, tokenizer Tokenizer) []chunk {
+	if budget <= 0 || len(chunks) == 0 {
+		return nil
+	}
+
+	ranked := make([]chunk, len(chunks))
+	copy(ranked, chunks)
+	sort.SliceStable(ranked, func(a, b int) bool {
+		return ranked[a].score > ranked[b].score
+	})
+
+	// Unmatched chunks are only used when nothing on the page matches the
+	// query, in which case the page head is the best guess
+	matched := ranked[0].score > 0
+
+	var selected []chunk
+	for _, c := range ranked {
+		if matched && c.score == 0 {
+			break
+		}
+		c.tokens = tokenizer.Count(c.text)
+		if c.tokens > budget {
+			// Keep at least the head of the best passage
+			if len(selected) == 0 {
+				c.text = tokenizer.Truncate(c.text, budget)
+				c.tokens = tokenizer.Count(c.text)
+				selected = append(selected, c)
+				budget -= c.tokens
+			}
+			continue
+		}
+		selected = append(selected, c)
+		budget -= c.tokens
+	}
+
+	sort.Slice(selected, func(a, b int) bool {
+		return selected[a].index < selected[b].index
+	})
+	return selected
+}
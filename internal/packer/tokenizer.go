@@ -0,0 +1,88 @@
+package packer
+
+import (
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Tokenizer counts and truncates text in model tokens
+type Tokenizer interface {
+	Count(text string) int
+	Truncate(text string, maxTokens int) string
+}
+
+func init() {
+	// Use the embedded BPE ranks instead of downloading them at runtime
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+var (
+	tokenizers   = map[string]Tokenizer{}
+	tokenizersMu sync.Mutex
+)
+
+// ForModel returns a tokenizer for the given model. Models without a public
+// tokenizer (e.g. Claude) are counted with cl100k_base, which is close enough
+// for budgeting purposes.
+func ForModel(model string) Tokenizer {
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+
+	if t, ok := tokenizers[model]; ok {
+		return t
+	}
+
+	var t Tokenizer
+	enc, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		enc, err = tiktoken.GetEncoding("cl100k_base")
+	}
+	if err != nil {
+		log.Printf("Falling back to estimated token counts for %s: %v", model, err)
+		t = estimateTokenizer{}
+	} else {
+		t = &bpeTokenizer{enc: enc}
+	}
+
+	tokenizers[model] = t
+	return t
+}
+
+type bpeTokenizer struct {
+	enc *tiktoken.Tiktoken
+}
+
+func (b *bpeTokenizer) Count(text string) int {
+	return len(b.enc.EncodeOrdinary(text))
+}
+
+func (b *bpeTokenizer) Truncate(text string, maxTokens int) string {
+	if maxTokens <= 0 {
+		return ""
+	}
+	tokens := b.enc.EncodeOrdinary(text)
+	if len(tokens) <= maxTokens {
+		return text
+	}
+	return b.enc.Decode(tokens[:maxTokens])
+}
+
+// estimateTokenizer assumes roughly four bytes per token
+type estimateTokenizer struct{}
+
+func (estimateTokenizer) Count(text string) int {
+	return (len(text) + 3) / 4
+}
+
+func (estimateTokenizer) Truncate(text string, maxTokens int) string {
+	if maxTokens <= 0 {
+		return ""
+	}
+	if len(text) <= maxTokens*4 {
+		return text
+	}
+	return strings.ToValidUTF8(text[:maxTokens*4], "")
+}
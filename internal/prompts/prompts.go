@@ -0,0 +1,272 @@
+package prompts
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"web-scraper/internal/config"
+	"web-scraper/internal/models"
+	"web-scraper/internal/packer"
+)
+
+// Internal prompts that are not selectable as a style
+const (
+	// MapTemplate summarizes a single page in map-reduce mode
+	MapTemplate = "_map"
+	// JSONTemplate asks for an answer matching a JSON schema
+	JSONTemplate = "_json"
+	// RewriteTemplate turns a user question into search engine queries
+	RewriteTemplate = "_rewrite"
+	// FollowUpTemplate decides whether a follow-up question needs new searches
+	FollowUpTemplate = "_followup"
+	// AskTemplate answers a follow-up question in a search session
+	AskTemplate = "_ask"
+	// ResearchTemplate is the system prompt of the research agent
+	ResearchTemplate = "_research"
+	// ScrapeTemplate summarizes a scraped page or answers a question about it
+	ScrapeTemplate = "_scrape"
+	// MonitorTemplate summarizes what changed between two monitor runs
+	MonitorTemplate = "_monitor"
+	// CollectionTemplate synthesizes the saved results of a collection
+	CollectionTemplate = "_collection"
+)
+
+// Templates whose name starts with this prefix are partials or internal
+// prompts and cannot be selected as a style
+const internalPrefix = "_"
+
+// How often the template directory is checked for changes
+const reloadInterval = time.Second
+
+//go:embed templates/*.tmpl
+var embedded embed.FS
+
+// Data is what every prompt template is executed with
+type Data struct {
+	Query    string
+	Results  []packer.PackedResult
+	Metadata map[string]string
+	Date     time.Time
+	// History is the conversation of a search session, oldest first
+	History []models.SessionTurn
+}
+
+// Registry holds the parsed prompt templates. Templates in the configured
+// directory override the embedded defaults of the same name and are reloaded
+// when they change on disk.
+type Registry struct {
+	dir string
+
+	mu        sync.RWMutex
+	templates *template.Template
+	styles    []string
+	signature string
+	checkedAt time.Time
+}
+
+var funcs = template.FuncMap{
+	"join": strings.Join,
+	"inc": func(i int) int {
+		return i + 1
+	},
+	"truncate": func(n int, s string) string {
+		runes := []rune(s)
+		if len(runes) <= n {
+			return s
+		}
+		return string(runes[:n]) + "..."
+	},
+}
+
+func NewRegistry(dir string) (*Registry, error) {
+	r := &Registry{dir: dir}
+	signature, err := r.dirSignature()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(signature); err != nil {
+		log.Printf("Error loading prompt templates from %s, using defaults: %v", dir, err)
+		if err := r.load(""); err != nil {
+			return nil, err
+		}
+		// Retry the directory once its files change
+		r.signature = signature
+	}
+	return r, nil
+}
+
+// Render executes the template for the given style
+func (r *Registry) Render(style string, data Data) (string, error) {
+	r.reloadIfChanged()
+
+	r.mu.RLock()
+	templates := r.templates
+	r.mu.RUnlock()
+
+	if templates.Lookup(style) == nil {
+		return "", fmt.Errorf("unknown prompt style: %s", style)
+	}
+
+	var out strings.Builder
+	if err := templates.ExecuteTemplate(&out, style, data); err != nil {
+		return "", fmt.Errorf("error rendering prompt %s: %v", style, err)
+	}
+	return out.String(), nil
+}
+
+// Styles lists the selectable style names
+func (r *Registry) Styles() []string {
+	r.reloadIfChanged()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.styles
+}
+
+func (r *Registry) HasStyle(style string) bool {
+	for _, s := range r.Styles() {
+		if s == style {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Registry) reloadIfChanged() {
+	r.mu.RLock()
+	fresh := time.Since(r.checkedAt) < reloadInterval
+	r.mu.RUnlock()
+	if fresh {
+		return
+	}
+
+	signature, err := r.dirSignature()
+	if err != nil {
+		log.Printf("Error checking prompt templates in %s: %v", r.dir, err)
+		return
+	}
+
+	r.mu.Lock()
+	r.checkedAt = time.Now()
+	changed := signature != r.signature
+	if changed {
+		r.signature = signature
+	}
+	r.mu.Unlock()
+
+	if changed {
+		if err := r.load(signature); err != nil {
+			// Keep serving the previous templates until the file is fixed
+			log.Printf("Error reloading prompt templates: %v", err)
+			return
+		}
+		log.Printf("Reloaded prompt templates from %s", r.dir)
+	}
+}
+
+// dirSignature fingerprints the template files on disk so edits, additions
+// and removals are all detected
+func (r *Registry) dirSignature() (string, error) {
+	if r.dir == "" {
+		return "", nil
+	}
+
+	entries, err := os.ReadDir(r.dir)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var signature strings.Builder
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".tmpl" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return "", err
+		}
+		signature.WriteString(fmt.Sprintf("%s:%d:%d;", entry.Name(), info.Size(), info.ModTime().UnixNano()))
+	}
+	return signature.String(), nil
+}
+
+func (r *Registry) load(signature string) error {
+	sources := map[string]string{}
+
+	files, err := fs.Glob(embedded, "templates/*.tmpl")
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		content, err := embedded.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		sources[templateName(file)] = string(content)
+	}
+
+	if signature != "" {
+		files, err := filepath.Glob(filepath.Join(r.dir, "*.tmpl"))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			sources[templateName(file)] = string(content)
+		}
+	}
+
+	templates := template.New("").Funcs(funcs)
+	var styles []string
+	for name, source := range sources {
+		if _, err := templates.New(name).Parse(source); err != nil {
+			return fmt.Errorf("error parsing prompt template %s: %v", name, err)
+		}
+		if !strings.HasPrefix(name, internalPrefix) {
+			styles = append(styles, name)
+		}
+	}
+	sort.Strings(styles)
+
+	r.mu.Lock()
+	r.templates = templates
+	r.styles = styles
+	r.signature = signature
+	r.checkedAt = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+func templateName(file string) string {
+	return strings.TrimSuffix(filepath.Base(file), ".tmpl")
+}
+
+var (
+	instance    *Registry
+	instanceErr error
+	once        sync.Once
+)
+
+// GetRegistry returns the singleton registry for the configured directory.
+// It is loaded on the first call; an error loading it is returned by every
+// call.
+func GetRegistry() (*Registry, error) {
+	once.Do(func() {
+		instance, instanceErr = NewRegistry(config.Config.PromptTemplatesDir)
+	})
+	return instance, instanceErr
+}
@@ -0,0 +1,120 @@
+package rerank
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"web-scraper/internal/ai"
+	"web-scraper/internal/models"
+	"web-scraper/internal/packer"
+)
+
+const (
+	// Page passages embedded per result besides its title and snippet
+	passagesPerResult = 2
+	passageWords      = 120
+	// Longest text sent to the embedding model, in bytes
+	maxInputBytes = 2000
+)
+
+type Options struct {
+	// Weight of the semantic similarity against the engine rank, 0..1
+	Weight float64
+	// Results less similar to the query than this are dropped
+	Threshold float64
+}
+
+// Rerank orders results by their embedding similarity to the query, blended
+// with their original engine rank, and drops results below the relevance
+// threshold. A result is as relevant as its most similar text: the title
+// with the snippet, or one of its best matching page passages.
+func Rerank(ctx context.Context, embedder ai.Embedder, query string, results []models.SearchResult, opts Options) ([]models.SearchResult, ai.Usage, error) {
+	if len(results) == 0 {
+		return results, ai.Usage{}, nil
+	}
+
+	texts := []string{query}
+	owner := []int{-1}
+	for i, result := range results {
+		texts = append(texts, result.Title+"\n"+result.Snippet)
+		owner = append(owner, i)
+		for _, passage := range topPassages(query, result.InnerContent) {
+			texts = append(texts, passage)
+			owner = append(owner, i)
+		}
+	}
+	for i, text := range texts {
+		if len(text) > maxInputBytes {
+			// Drops the rune cut in half, if any
+			texts[i] = strings.ToValidUTF8(text[:maxInputBytes], "")
+		}
+	}
+
+	vectors, usage, err := embedder.Embed(ctx, texts)
+	if err != nil {
+		return results, ai.Usage{}, err
+	}
+
+	similarity := make([]float64, len(results))
+	for i := range similarity {
+		similarity[i] = -1
+	}
+	for i := 1; i < len(vectors); i++ {
+		if s := ai.Cosine(vectors[0], vectors[i]); s > similarity[owner[i]] {
+			similarity[owner[i]] = s
+		}
+	}
+
+	type scored struct {
+		result models.SearchResult
+		score  float64
+	}
+	var kept []scored
+	for i, result := range results {
+		if similarity[i] < opts.Threshold {
+			continue
+		}
+		// Engine rank mapped to 1 for the first result down towards 0
+		rankScore := 1 - float64(i)/float64(len(results))
+		result.Relevance = similarity[i]
+		kept = append(kept, scored{
+			result: result,
+			score:  opts.Weight*similarity[i] + (1-opts.Weight)*rankScore,
+		})
+	}
+	sort.SliceStable(kept, func(a, b int) bool {
+		return kept[a].score > kept[b].score
+	})
+
+	reranked := make([]models.SearchResult, len(kept))
+	for i, k := range kept {
+		reranked[i] = k.result
+	}
+	log.Printf("Reranked %d results, dropped %d below relevance %.2f", len(results), len(results)-len(kept), opts.Threshold)
+	return reranked, usage, nil
+}
+
+// topPassages returns the page chunks that best match the query by BM25
+func topPassages(query, content string) []string {
+	chunks := packer.Chunk(content, passageWords)
+	if len(chunks) <= passagesPerResult {
+		return chunks
+	}
+
+	index := packer.NewBM25(chunks)
+	terms := packer.Terms(query)
+	order := make([]int, len(chunks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return index.Score(order[a], terms) > index.Score(order[b], terms)
+	})
+
+	passages := make([]string, passagesPerResult)
+	for i := range passages {
+		passages[i] = chunks[order[i]]
+	}
+	return passages
+}
@@ -0,0 +1,289 @@
+package research
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"web-scraper/internal/ai"
+	"web-scraper/internal/config"
+	"web-scraper/internal/models"
+	"web-scraper/internal/packer"
+	"web-scraper/internal/prompts"
+	"web-scraper/internal/search"
+)
+
+// Why the agent stopped researching
+const (
+	StopComplete    = "complete"
+	StopMaxSteps    = "max_steps"
+	StopTokenBudget = "token_budget"
+	StopTimeout     = "timeout"
+)
+
+// Longest observation kept in the trace
+const maxObservation = 300
+
+var tools = []ai.Tool{
+	{
+		Name:        "web_search",
+		Description: "Search the web. Returns the matching pages with their source numbers, titles, URLs and snippets.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"query": {"type": "string", "description": "Search engine query"}
+			},
+			"required": ["query"]
+		}`),
+	},
+	{
+		Name:        "read_page",
+		Description: "Read the content of a source found by web_search. Returns the passages most relevant to the focus.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"source": {"type": "integer", "description": "Source number from web_search"},
+				"focus": {"type": "string", "description": "What to look for on the page"}
+			},
+			"required": ["source"]
+		}`),
+	},
+}
+
+// Options limits a research run
+type Options struct {
+	MaxSteps    int
+	TokenBudget int
+	// Search runs a query through the search engines
+	Search func(query string) []models.SearchResult
+}
+
+// agent holds the state of one research run
+type agent struct {
+	provider ai.Provider
+	question string
+	opts     Options
+
+	sources []models.ResearchSource
+	// source number by normalized URL
+	seen map[string]int
+}
+
+// Run lets the model research the question with the search tools and returns
+// its report. The loop ends when the model answers without calling a tool;
+// when the step or token budget runs out the model is asked to write the
+// report from what it has found so far.
+func Run(ctx context.Context, provider ai.Provider, question string, opts Options) (models.ResearchReport, error) {
+	startTime := time.Now()
+	a := &agent{
+		provider: provider,
+		question: question,
+		opts:     opts,
+		seen:     make(map[string]int),
+	}
+	report := models.ResearchReport{Question: question}
+
+	registry, err := prompts.GetRegistry()
+	if err != nil {
+		return report, err
+	}
+	system, err := registry.Render(prompts.ResearchTemplate, prompts.Data{
+		Query:    question,
+		Metadata: map[string]string{"max_steps": strconv.Itoa(opts.MaxSteps)},
+		Date:     time.Now(),
+	})
+	if err != nil {
+		return report, err
+	}
+
+	messages := []ai.Message{
+		{Role: "user", Content: "Research this question: " + question},
+	}
+	usage := &models.TokenUsage{}
+
+	for step := 1; report.StopReason == ""; step++ {
+		if step > opts.MaxSteps {
+			report.StopReason = StopMaxSteps
+			break
+		}
+		if usage.TotalTokens >= opts.TokenBudget {
+			report.StopReason = StopTokenBudget
+			break
+		}
+
+		resp, err := a.complete(ctx, system, messages, false)
+		if err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				report.StopReason = StopTimeout
+				break
+			}
+			return report, err
+		}
+		addUsage(usage, resp.Usage)
+
+		if len(resp.ToolCalls) == 0 {
+			report.Report = resp.Content
+			report.StopReason = StopComplete
+			break
+		}
+
+		messages = append(messages, ai.Message{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls})
+		for _, call := range resp.ToolCalls {
+			result := a.execute(call)
+			messages = append(messages, ai.Message{Role: "tool", Content: result, ToolCallID: call.ID})
+			report.Trace = append(report.Trace, models.ResearchStep{
+				Step:        step,
+				Thought:     strings.TrimSpace(resp.Content),
+				Tool:        call.Name,
+				Arguments:   call.Arguments,
+				Observation: truncate(result, maxObservation),
+				Tokens:      resp.Usage.TotalTokens,
+			})
+		}
+	}
+
+	if report.StopReason != StopComplete {
+		log.Printf("Research stopped (%s) after %d tool calls, writing report", report.StopReason, len(report.Trace))
+		finalCtx := ctx
+		if report.StopReason == StopTimeout {
+			// Give the report its own short deadline
+			var cancel context.CancelFunc
+			finalCtx, cancel = context.WithTimeout(context.Background(), 60*time.Second)
+			defer cancel()
+		}
+		messages = append(messages, ai.Message{
+			Role:    "user",
+			Content: "The research budget is used up. Do not call any more tools; write the final report now from the information gathered so far.",
+		})
+		resp, err := a.complete(finalCtx, system, messages, true)
+		if err != nil {
+			return report, err
+		}
+		addUsage(usage, resp.Usage)
+		report.Report = resp.Content
+	}
+
+	if strings.TrimSpace(report.Report) == "" {
+		return report, fmt.Errorf("research agent returned an empty report")
+	}
+	report.Sources = a.sources
+	report.TokenUsage = usage
+	report.Duration = time.Since(startTime).String()
+	return report, nil
+}
+
+// complete asks the model for its next step, or for the report when final
+func (a *agent) complete(ctx context.Context, system string, messages []ai.Message, final bool) (ai.CompletionResponse, error) {
+	return a.provider.Complete(ctx, ai.CompletionRequest{
+		Model:            config.Config.ResearchModels[a.provider.Name()],
+		System:           system,
+		Messages:         messages,
+		MaxTokens:        config.Config.MaxCompletionTokens,
+		Tools:            tools,
+		DisableToolCalls: final,
+	})
+}
+
+// execute runs a tool call. Failures are reported back to the model as the
+// tool result so it can try something else.
+func (a *agent) execute(call ai.ToolCall) string {
+	var args struct {
+		Query  string `json:"query"`
+		Source int    `json:"source"`
+		Focus  string `json:"focus"`
+	}
+	if err := json.Unmarshal(call.Arguments, &args); err != nil {
+		return fmt.Sprintf("Error: invalid arguments: %v", err)
+	}
+
+	switch call.Name {
+	case "web_search":
+		if strings.TrimSpace(args.Query) == "" {
+			return "Error: query is required"
+		}
+		return a.webSearch(args.Query)
+	case "read_page":
+		return a.readPage(args.Source, args.Focus)
+	default:
+		return fmt.Sprintf("Error: unknown tool %q", call.Name)
+	}
+}
+
+func (a *agent) webSearch(query string) string {
+	log.Printf("Research search: %s", query)
+	results := a.opts.Search(query)
+	if len(results) == 0 {
+		return "No results found."
+	}
+
+	var b strings.Builder
+	for _, result := range results {
+		id := a.addSource(result)
+		fmt.Fprintf(&b, "[%d] %s\nURL: %s\n%s\n\n", id, result.Title, result.Link, result.Snippet)
+	}
+	return b.String()
+}
+
+func (a *agent) readPage(id int, focus string) string {
+	if id < 1 || id > len(a.sources) {
+		return fmt.Sprintf("Error: unknown source %d", id)
+	}
+	source := &a.sources[id-1]
+	log.Printf("Research read: %s", source.Link)
+
+	content, err := search.FetchPage(source.Link)
+	if err != nil {
+		return fmt.Sprintf("Error: could not read source %d: %v", id, err)
+	}
+	if content == "" {
+		return fmt.Sprintf("Source %d has no readable content.", id)
+	}
+	source.Read = true
+
+	// Keep only the passages relevant to the focus so pages do not crowd
+	// out the rest of the research
+	if focus == "" {
+		focus = a.question
+	}
+	packed := packer.Pack(focus, []models.SearchResult{{InnerContent: content}}, packer.Options{
+		Budget:    config.Config.ResearchPageTokens,
+		Tokenizer: packer.ForModel(config.Config.ResearchModels[a.provider.Name()]),
+	})
+	if len(packed.Results) == 0 {
+		return fmt.Sprintf("Source %d has no readable content.", id)
+	}
+	return fmt.Sprintf("[%d] %s\n%s", id, source.Title, strings.Join(packed.Results[0].Passages, "\n...\n"))
+}
+
+// addSource numbers a result, reusing the number of a page seen before
+func (a *agent) addSource(result models.SearchResult) int {
+	key := search.NormalizeURL(result.Link)
+	if id, ok := a.seen[key]; ok {
+		return id
+	}
+	a.sources = append(a.sources, models.ResearchSource{
+		ID:      len(a.sources) + 1,
+		Title:   result.Title,
+		Link:    result.Link,
+		Snippet: result.Snippet,
+	})
+	a.seen[key] = len(a.sources)
+	return len(a.sources)
+}
+
+func addUsage(total *models.TokenUsage, usage ai.Usage) {
+	total.PromptTokens += usage.PromptTokens
+	total.CompletionTokens += usage.CompletionTokens
+	total.TotalTokens += usage.TotalTokens
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "") + "..."
+}
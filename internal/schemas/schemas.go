@@ -0,0 +1,129 @@
+package schemas
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed defs/*.json
+var defs embed.FS
+
+// Schema is a compiled JSON Schema the AI output is validated against
+type Schema struct {
+	Name        string
+	Description string
+	Raw         json.RawMessage
+	compiled    *jsonschema.Schema
+}
+
+// Parse compiles a caller-provided schema. The root must describe an object,
+// which is what both JSON mode and tool calling require.
+func Parse(name string, raw []byte) (*Schema, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("schema is not valid JSON: %v", err)
+	}
+	if doc["type"] != "object" {
+		return nil, fmt.Errorf("schema root must be of type object")
+	}
+
+	url := "schema:///" + name + ".json"
+	compiler := jsonschema.NewCompiler()
+	compiler.LoadURL = refuseURL
+	if err := compiler.AddResource(url, strings.NewReader(string(raw))); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	compiled, err := compiler.Compile(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+
+	description, _ := doc["description"].(string)
+	return &Schema{
+		Name:        name,
+		Description: description,
+		Raw:         json.RawMessage(raw),
+		compiled:    compiled,
+	}, nil
+}
+
+// refuseURL keeps schemas self-contained: the default loaders would read
+// local files or fetch URLs named in a caller's $ref
+func refuseURL(url string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("external reference %s is not allowed", url)
+}
+
+// ParseCustom compiles a caller-provided schema, naming it after its content
+// so identical schemas share cache entries
+func ParseCustom(raw []byte) (*Schema, error) {
+	sum := sha256.Sum256(raw)
+	return Parse("custom_"+hex.EncodeToString(sum[:8]), raw)
+}
+
+// Validate checks a JSON document against the schema
+func (s *Schema) Validate(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("output is not valid JSON: %v", err)
+	}
+	if err := s.compiled.Validate(v); err != nil {
+		if ve, ok := err.(*jsonschema.ValidationError); ok {
+			return fmt.Errorf("%#v", ve)
+		}
+		return err
+	}
+	return nil
+}
+
+var (
+	registered map[string]*Schema
+	once       sync.Once
+)
+
+func load() {
+	registered = map[string]*Schema{}
+	files, err := fs.Glob(defs, "defs/*.json")
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		raw, err := defs.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+		name := strings.TrimSuffix(path.Base(file), ".json")
+		schema, err := Parse(name, raw)
+		if err != nil {
+			panic(fmt.Sprintf("built-in schema %s: %v", name, err))
+		}
+		registered[name] = schema
+	}
+}
+
+// Get returns a registered schema by name
+func Get(name string) (*Schema, bool) {
+	once.Do(load)
+	schema, ok := registered[name]
+	return schema, ok
+}
+
+// Names lists the registered schemas
+func Names() []string {
+	once.Do(load)
+	var names []string
+	for name := range registered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/gocolly/colly/v2"
 	"log"
 	"strings"
+	"web-scraper/internal/fetcher"
 	"web-scraper/internal/models"
 )
 
@@ -15,9 +16,7 @@ func (g *BingSearch) GetName() string {
 
 func (b *BingSearch) Search(query string) ([]models.SearchResult, error) {
 	var results []models.SearchResult
-	c := colly.NewCollector(
-		colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4473.124 Safari/537.36"),
-	)
+	c := fetcher.NewEngineCollector()
 
 	c.OnHTML("li.b_algo", func(e *colly.HTMLElement) {
 		result := models.SearchResult{
@@ -37,3 +36,14 @@ func (b *BingSearch) Search(query string) ([]models.SearchResult, error) {
 
 	return results, err
 }
+
+func (b *BingSearch) DeepSearch(query string) ([]models.SearchResult, error) {
+	results, err := b.Search(query)
+	if err != nil {
+		return nil, err
+	}
+	addPageContent(results, deepSearchPages)
+
+	log.Printf("Deep search completed for %s. Found %d results", b.GetName(), len(results))
+	return results, nil
+}
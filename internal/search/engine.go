@@ -1,9 +1,48 @@
 package search
 
-import "web-scraper/internal/models"
+import (
+	"strings"
+	"web-scraper/internal/models"
+)
 
 type SearchEngine interface {
 	Search(query string) ([]models.SearchResult, error)
 	DeepSearch(query string) ([]models.SearchResult, error)
 	GetName() string
 }
+
+// EngineByName returns the engine with the given case-insensitive name
+func EngineByName(name string) (SearchEngine, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "duckduckgo":
+		return &DuckDuckGoSearch{}, true
+	case "bing":
+		return &BingSearch{}, true
+	case "google":
+		return &GoogleSearch{}, true
+	}
+	return nil, false
+}
+
+// Number of results whose pages a deep search fetches
+const deepSearchPages = 10
+
+// addPageContent fetches the pages of the first limit results into their
+// InnerContent and Metadata
+func addPageContent(results []models.SearchResult, limit int) {
+	var links []string
+	for i, result := range results {
+		if i >= limit {
+			break
+		}
+		links = append(links, result.Link)
+	}
+	pages := FetchPages(links)
+
+	for i := range results {
+		if page, ok := pages[results[i].Link]; ok {
+			results[i].InnerContent = page.Content
+			results[i].Metadata = page.Metadata
+		}
+	}
+}
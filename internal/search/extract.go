@@ -0,0 +1,251 @@
+package search
+
+import (
+	"fmt"
+	htmltomarkdown "github.com/JohannesKaufmann/html-to-markdown/v2"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"web-scraper/internal/fetcher"
+)
+
+// Longest page content kept per result
+const maxPageContent = 5000
+
+// Content formats a page can be extracted as
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+)
+
+// Main content areas, tried in order
+var contentSelectors = []string{
+	"article",
+	"main",
+	".content",
+	"#content",
+	".post-content",
+	".article-content",
+	"[role='main']",
+}
+
+// Page metadata read from meta tags: metadata key -> selector
+var metaSelectors = map[string]string{
+	"description":    "meta[name='description']",
+	"keywords":       "meta[name='keywords']",
+	"author":         "meta[name='author']",
+	"og_title":       "meta[property='og:title']",
+	"og_description": "meta[property='og:description']",
+	"og_type":        "meta[property='og:type']",
+	"site_name":      "meta[property='og:site_name']",
+	"published_time": "meta[property='article:published_time']",
+	"modified_time":  "meta[property='article:modified_time']",
+}
+
+// Page is the content extracted from a scraped page
+type Page struct {
+	URL      string
+	Title    string
+	Content  string
+	Metadata map[string]string
+}
+
+func newPageCollector() *colly.Collector {
+	// Create a new collector for scraping individual pages
+	c := fetcher.NewCollector(
+		colly.MaxDepth(1),
+	)
+
+	// Set timeout for requests
+	c.SetRequestTimeout(10 * time.Second)
+	return c
+}
+
+// extractContent pulls the readable text out of a page
+func extractContent(e *colly.HTMLElement) string {
+	var contentBuilder strings.Builder
+
+	// Extract meta description
+	metaDesc := e.ChildAttr("meta[name='description']", "content")
+	if metaDesc != "" {
+		contentBuilder.WriteString("Description: " + metaDesc + "\n\n")
+	}
+
+	for _, selector := range contentSelectors {
+		e.ForEach(selector, func(_ int, el *colly.HTMLElement) {
+			// Clean and append the text
+			text := cleanText(el.Text)
+			if text != "" {
+				contentBuilder.WriteString(text + "\n")
+			}
+		})
+	}
+
+	// If no main content areas found, fall back to paragraph text
+	if contentBuilder.Len() == 0 {
+		e.ForEach("p", func(_ int, el *colly.HTMLElement) {
+			text := cleanText(el.Text)
+			if text != "" {
+				contentBuilder.WriteString(text + "\n")
+			}
+		})
+	}
+
+	// Get the final content
+	content := strings.TrimSpace(contentBuilder.String())
+
+	// Limit content length
+	if len(content) > maxPageContent {
+		content = content[:maxPageContent]
+	}
+	return content
+}
+
+// extractHTML returns the HTML of the main content areas, or of the
+// paragraphs when the page has none
+func extractHTML(e *colly.HTMLElement) string {
+	var parts []string
+	for _, selector := range contentSelectors {
+		e.DOM.Find(selector).Each(func(_ int, s *goquery.Selection) {
+			if html, err := goquery.OuterHtml(s); err == nil {
+				parts = append(parts, html)
+			}
+		})
+		if len(parts) > 0 {
+			// Nested areas (main > article) would repeat the content
+			break
+		}
+	}
+	if len(parts) == 0 {
+		e.DOM.Find("p").Each(func(_ int, s *goquery.Selection) {
+			if html, err := goquery.OuterHtml(s); err == nil {
+				parts = append(parts, html)
+			}
+		})
+	}
+	return strings.Join(parts, "\n")
+}
+
+// extractMetadata reads the page's meta tags and response details
+func extractMetadata(e *colly.HTMLElement) map[string]string {
+	metadata := map[string]string{
+		"status_code":  strconv.Itoa(e.Response.StatusCode),
+		"content_type": e.Response.Headers.Get("Content-Type"),
+		"final_url":    e.Request.URL.String(),
+		"fetched_at":   time.Now().UTC().Format(time.RFC3339),
+	}
+	for key, selector := range metaSelectors {
+		if value := strings.TrimSpace(e.ChildAttr(selector, "content")); value != "" {
+			metadata[key] = value
+		}
+	}
+	if canonical := e.ChildAttr("link[rel='canonical']", "href"); canonical != "" {
+		metadata["canonical"] = e.Request.AbsoluteURL(canonical)
+	}
+	if lang := e.Attr("lang"); lang != "" {
+		metadata["lang"] = lang
+	}
+	return metadata
+}
+
+// ExtractPage extracts the title, metadata and content of a page in the
+// given format. Text content is limited like deep search results.
+func ExtractPage(e *colly.HTMLElement, format string) Page {
+	page := Page{
+		URL:      e.Request.URL.String(),
+		Title:    cleanText(e.ChildText("title")),
+		Metadata: extractMetadata(e),
+	}
+
+	switch format {
+	case FormatHTML:
+		page.Content = extractHTML(e)
+	case FormatMarkdown:
+		markdown, err := htmltomarkdown.ConvertString(extractHTML(e))
+		if err != nil {
+			log.Printf("Error converting %s to markdown: %v", page.URL, err)
+			page.Content = extractContent(e)
+		} else {
+			page.Content = strings.TrimSpace(markdown)
+		}
+	default:
+		page.Content = extractContent(e)
+	}
+	return page
+}
+
+// FetchPages scrapes the readable content and metadata of each link. The
+// result maps links to their pages; pages that failed to load are missing.
+func FetchPages(links []string) map[string]Page {
+	pages := make(map[string]Page)
+	c := newPageCollector()
+
+	c.OnHTML("html", func(e *colly.HTMLElement) {
+		pages[e.Request.Ctx.Get("link")] = ExtractPage(e, FormatText)
+	})
+
+	// Error handling for requests
+	c.OnError(func(r *colly.Response, err error) {
+		log.Printf("Error scraping %s: %v", r.Request.URL, err)
+	})
+
+	for _, link := range links {
+		if !isHTTP(link) {
+			continue
+		}
+		ctx := colly.NewContext()
+		ctx.Put("link", link)
+		if err := c.Request("GET", link, nil, ctx, nil); err != nil {
+			log.Printf("Error visiting %s: %v", link, err)
+		}
+	}
+	return pages
+}
+
+// ScrapePage fetches a single page and extracts it in the given format
+func ScrapePage(link, format string) (Page, error) {
+	if !isHTTP(link) {
+		return Page{}, fmt.Errorf("unsupported URL %q", link)
+	}
+
+	var (
+		page     *Page
+		fetchErr error
+	)
+	c := newPageCollector()
+	c.OnHTML("html", func(e *colly.HTMLElement) {
+		extracted := ExtractPage(e, format)
+		page = &extracted
+	})
+	c.OnError(func(r *colly.Response, err error) {
+		fetchErr = err
+	})
+
+	if err := c.Visit(link); err != nil {
+		return Page{}, err
+	}
+	if fetchErr != nil {
+		return Page{}, fetchErr
+	}
+	if page == nil {
+		return Page{}, fmt.Errorf("%s is not an HTML page", link)
+	}
+	return *page, nil
+}
+
+// FetchPage scrapes the readable content of a single page
+func FetchPage(link string) (string, error) {
+	page, err := ScrapePage(link, FormatText)
+	if err != nil {
+		return "", err
+	}
+	return page.Content, nil
+}
+
+func isHTTP(link string) bool {
+	return strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://")
+}
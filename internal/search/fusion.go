@@ -0,0 +1,84 @@
+package search
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"web-scraper/internal/models"
+)
+
+// Reciprocal rank fusion constant; dampens the advantage of the very top ranks
+const rrfK = 60
+
+// Query parameters that only track the visitor and never change the page
+var trackingParams = []string{"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content", "gclid", "fbclid", "ref"}
+
+// NormalizeURL reduces a link to a canonical form so the same page found by
+// different queries or engines is recognized as a duplicate
+func NormalizeURL(link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || u.Host == "" {
+		return strings.TrimSpace(link)
+	}
+
+	// Unwrap DuckDuckGo redirect links (//duckduckgo.com/l/?uddg=<target>)
+	if strings.HasSuffix(u.Host, "duckduckgo.com") && strings.HasPrefix(u.Path, "/l") {
+		if target := u.Query().Get("uddg"); target != "" {
+			return NormalizeURL(target)
+		}
+	}
+
+	u.Scheme = "https"
+	u.Host = strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	u.Fragment = ""
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	params := u.Query()
+	for _, p := range trackingParams {
+		params.Del(p)
+	}
+	u.RawQuery = params.Encode()
+
+	return u.String()
+}
+
+// Fuse merges ranked result lists with reciprocal rank fusion and drops
+// duplicate pages
+func Fuse(lists [][]models.SearchResult) []models.SearchResult {
+	type fused struct {
+		result models.SearchResult
+		score  float64
+		order  int
+	}
+
+	byURL := map[string]*fused{}
+	var all []*fused
+	for _, list := range lists {
+		for rank, result := range list {
+			key := NormalizeURL(result.Link)
+			entry, ok := byURL[key]
+			if !ok {
+				entry = &fused{result: result, order: len(all)}
+				byURL[key] = entry
+				all = append(all, entry)
+			} else if entry.result.InnerContent == "" && result.InnerContent != "" {
+				// Prefer the copy whose page content was fetched
+				entry.result = result
+			}
+			entry.score += 1 / float64(rrfK+rank+1)
+		}
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].score != all[j].score {
+			return all[i].score > all[j].score
+		}
+		return all[i].order < all[j].order
+	})
+
+	results := make([]models.SearchResult, len(all))
+	for i, entry := range all {
+		results[i] = entry.result
+	}
+	return results
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/gocolly/colly/v2"
 	"log"
 	"strings"
+	"web-scraper/internal/fetcher"
 	"web-scraper/internal/models"
 )
 
@@ -16,9 +17,7 @@ func (g *GoogleSearch) GetName() string {
 func (g *GoogleSearch) Search(query string) ([]models.SearchResult, error) {
 
 	var results []models.SearchResult
-	c := colly.NewCollector(
-		colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"),
-	)
+	c := fetcher.NewEngineCollector()
 
 	c.OnHTML("div.g", func(e *colly.HTMLElement) {
 		result := models.SearchResult{
@@ -39,3 +38,14 @@ func (g *GoogleSearch) Search(query string) ([]models.SearchResult, error) {
 
 	return results, err
 }
+
+func (g *GoogleSearch) DeepSearch(query string) ([]models.SearchResult, error) {
+	results, err := g.Search(query)
+	if err != nil {
+		return nil, err
+	}
+	addPageContent(results, deepSearchPages)
+
+	log.Printf("Deep search completed for %s. Found %d results", g.GetName(), len(results))
+	return results, nil
+}
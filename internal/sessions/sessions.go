@@ -0,0 +1,139 @@
+package sessions
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+	"web-scraper/internal/models"
+	"web-scraper/internal/storage"
+)
+
+const bucket = "sessions"
+
+var locks sync.Map
+
+// Lock serializes updates to one session and returns the unlock function
+func Lock(id string) func() {
+	mu, _ := locks.LoadOrStore(id, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// Create stores a new session seeded with the results of a search
+func Create(userID string, response models.SearchResponse) (*models.Session, error) {
+	now := time.Now()
+	session := &models.Session{
+		ID:        storage.NewID(),
+		UserID:    userID,
+		Query:     response.Query,
+		Results:   response.Results,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if response.FormattedResult != "" {
+		// The initial summary is the first answer of the conversation
+		session.Turns = append(session.Turns,
+			models.SessionTurn{Role: "user", Content: response.Query, At: now},
+			models.SessionTurn{Role: "assistant", Content: response.FormattedResult, At: now},
+		)
+	}
+
+	if err := storage.GetStore().Put(bucket, session.ID, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Get returns the session if it exists and belongs to the user
+func Get(id, userID string) (*models.Session, bool, error) {
+	var session models.Session
+	found, err := storage.GetStore().Get(bucket, id, &session)
+	if err != nil || !found || session.UserID != userID {
+		return nil, false, err
+	}
+	return &session, true, nil
+}
+
+func Save(session *models.Session) error {
+	session.UpdatedAt = time.Now()
+	return storage.GetStore().Put(bucket, session.ID, session)
+}
+
+// Delete removes the user's session with the given id
+func Delete(id, userID string) (bool, error) {
+	_, found, err := Get(id, userID)
+	if err != nil || !found {
+		return false, err
+	}
+	if err := storage.GetStore().Delete(bucket, id); err != nil {
+		return false, err
+	}
+	locks.Delete(id)
+	return true, nil
+}
+
+// DeleteAll removes all of the user's sessions and returns the number
+// removed
+func DeleteAll(userID string) (int, error) {
+	return deleteWhere(func(session *sessionHeader) bool {
+		return session.UserID == userID
+	})
+}
+
+// Prune deletes sessions that have not been used for longer than ttl
+func Prune(ttl time.Duration) (int, error) {
+	cutoff := time.Now().Add(-ttl)
+	return deleteWhere(func(session *sessionHeader) bool {
+		return session.UpdatedAt.Before(cutoff)
+	})
+}
+
+// sessionHeader is the part of a session deleteWhere decodes
+type sessionHeader struct {
+	UserID    string    `json:"user_id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func deleteWhere(match func(session *sessionHeader) bool) (int, error) {
+	store := storage.GetStore()
+
+	var matched []string
+	err := store.ForEach(bucket, "", func(key string, data []byte) error {
+		var session sessionHeader
+		if err := json.Unmarshal(data, &session); err != nil {
+			log.Printf("Error decoding session %s: %v", key, err)
+			return nil
+		}
+		if match(&session) {
+			matched = append(matched, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range matched {
+		if err := store.Delete(bucket, id); err != nil {
+			return 0, err
+		}
+		locks.Delete(id)
+	}
+	return len(matched), nil
+}
+
+// StartPruning prunes expired sessions now and then every interval
+func StartPruning(ttl, interval time.Duration) {
+	go func() {
+		for {
+			removed, err := Prune(ttl)
+			if err != nil {
+				log.Printf("Error pruning sessions: %v", err)
+			} else if removed > 0 {
+				log.Printf("Pruned %d expired sessions", removed)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
@@ -0,0 +1,447 @@
+package telegram
+
+import (
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"web-scraper/internal/auth"
+	"web-scraper/internal/config"
+	"web-scraper/internal/database"
+	"web-scraper/internal/handlersArgs"
+	"web-scraper/internal/history"
+	"web-scraper/internal/models"
+	"web-scraper/internal/monitors"
+	"web-scraper/internal/storage"
+)
+
+// from is the models.User From of accounts created by the bot
+const from = "telegram"
+
+// Results listed under a summary or an alert
+const maxLinks = 5
+
+const helpText = `Commands:
+/search <query> - search and summarize the results
+/deep <query> - read the result pages before summarizing
+/history - your latest searches
+/monitor - watch a search and get a message when its results change
+/monitor list - your monitors
+/monitor delete <id> - stop watching
+/cancel - cancel the current command
+
+Any other message is searched for.`
+
+// Searcher runs a search on behalf of a user
+type Searcher func(userID, query string, deep bool) (*models.SearchResponse, error)
+
+type Bot struct {
+	client  *Client
+	search  Searcher
+	allowed map[string]bool
+	open    bool
+	// slots bounds the number of messages handled at once
+	slots chan struct{}
+	// chats serializes the messages of each chat, which share its
+	// ActiveCommand
+	chats sync.Map
+}
+
+// Start runs the bot in the background: it polls for messages and sends
+// monitor alerts to the chats of their owners
+func Start(search Searcher) {
+	bot := newBot(search)
+	if len(bot.allowed) == 0 && !bot.open {
+		log.Printf("Telegram bot answers no chats; set TELEGRAM_ALLOWED_CHATS or TELEGRAM_OPEN")
+	}
+
+	monitors.AddNotifier(bot.notifyMonitor)
+	go bot.poll()
+	log.Printf("Telegram bot started")
+}
+
+func newBot(search Searcher) *Bot {
+	bot := &Bot{
+		client:  NewClient(config.Config.TelegramAPIURL, config.Config.TelegramBotToken, config.Config.TelegramPollTimeout),
+		search:  search,
+		allowed: map[string]bool{},
+		open:    config.Config.TelegramOpen,
+		slots:   make(chan struct{}, config.Config.TelegramConcurrency),
+	}
+	for _, chatID := range strings.Split(config.Config.TelegramAllowedChats, ",") {
+		if chatID = strings.TrimSpace(chatID); chatID != "" {
+			bot.allowed[chatID] = true
+		}
+	}
+	return bot
+}
+
+func (b *Bot) poll() {
+	var offset int64
+	backoff := time.Second
+	for {
+		updates, err := b.client.GetUpdates(offset, config.Config.TelegramPollTimeout)
+		if err != nil {
+			log.Printf("Error getting Telegram updates: %v", err)
+			time.Sleep(backoff)
+			backoff = min(2*backoff, time.Minute)
+			continue
+		}
+		backoff = time.Second
+
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			if update.Message == nil || update.Message.Text == "" {
+				continue
+			}
+			b.slots <- struct{}{}
+			go func(msg *Message) {
+				defer func() { <-b.slots }()
+				b.handle(msg)
+			}(update.Message)
+		}
+	}
+}
+
+// handle answers a message
+func (b *Bot) handle(msg *Message) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("panic handling Telegram message: %v", err)
+		}
+	}()
+
+	chatID := strconv.FormatInt(msg.Chat.ID, 10)
+	if !b.open && !b.allowed[chatID] {
+		b.reply(msg.Chat.ID, "Sorry, this bot is private.")
+		return
+	}
+
+	lock, _ := b.chats.LoadOrStore(chatID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	user, err := b.user(msg)
+	if err != nil {
+		log.Printf("Error loading Telegram user: %v", err)
+		b.reply(msg.Chat.ID, "Something went wrong, please try again later.")
+		return
+	}
+	b.reply(msg.Chat.ID, b.dispatch(user, msg))
+}
+
+// dispatch runs a command, or continues the active command with the text
+func (b *Bot) dispatch(user *models.User, msg *Message) string {
+	command, args := parseCommand(msg.Text)
+	switch command {
+	case "/start", "/help":
+		b.setActive(user, "")
+		return helpText
+	case "/cancel":
+		b.setActive(user, "")
+		return "Cancelled."
+	case "/search", "/deep":
+		if args == "" {
+			b.setActive(user, command[1:])
+			return "What should I search for?"
+		}
+		b.setActive(user, "")
+		return b.runSearch(user, msg.Chat.ID, args, command == "/deep")
+	case "/history":
+		b.setActive(user, "")
+		return b.history(user)
+	case "/monitor":
+		return b.monitor(user, args)
+	case "":
+	default:
+		return "Unknown command.\n\n" + helpText
+	}
+
+	active := ""
+	if user.ActiveCommand != nil {
+		active = *user.ActiveCommand
+	}
+	switch {
+	case active == "monitor":
+		return b.askSchedule(user, args)
+	case strings.HasPrefix(active, "monitor:"):
+		return b.createMonitor(user, strings.TrimPrefix(active, "monitor:"), args)
+	default:
+		b.setActive(user, "")
+		return b.runSearch(user, msg.Chat.ID, args, active == "deep")
+	}
+}
+
+// parseCommand splits "/command@bot args" into the lowercased command and
+// its arguments. Text that is not a command has an empty command.
+func parseCommand(text string) (string, string) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") {
+		return "", text
+	}
+	command, args, _ := strings.Cut(text, " ")
+	command, _, _ = strings.Cut(command, "@")
+	return strings.ToLower(command), strings.TrimSpace(args)
+}
+
+func (b *Bot) runSearch(user *models.User, chatID int64, query string, deep bool) string {
+	if auth.RoleOf(*user) == auth.RoleReadonly {
+		return "Your account is read-only."
+	}
+	if deep && !b.verified(user) {
+		return "Deep searches are only open to approved chats; use /search."
+	}
+	if !handlersArgs.GetLimiter().Allow() {
+		return "Too many requests right now, please try again in a moment."
+	}
+	if err := b.client.SendChatAction(chatID, "typing"); err != nil {
+		log.Printf("Error sending Telegram chat action: %v", err)
+	}
+
+	response, err := b.search(user.UserID, query, deep)
+	if err != nil {
+		return err.Error()
+	}
+	if len(response.Results) == 0 {
+		return "No results found."
+	}
+
+	var reply strings.Builder
+	reply.WriteString(response.FormattedResult)
+	reply.WriteString("\n\nSources:")
+	for i, result := range response.Results {
+		if i == maxLinks {
+			break
+		}
+		fmt.Fprintf(&reply, "\n%d. %s\n%s", i+1, result.Title, result.Link)
+	}
+	return reply.String()
+}
+
+func (b *Bot) history(user *models.User) string {
+	entries, _, err := history.List(user.UserID, history.Filter{Limit: 10})
+	if err != nil {
+		log.Printf("Error listing history: %v", err)
+		return "Something went wrong, please try again later."
+	}
+	if len(entries) == 0 {
+		return "You have not searched for anything yet."
+	}
+
+	var reply strings.Builder
+	reply.WriteString("Your latest searches:")
+	for i, entry := range entries {
+		fmt.Fprintf(&reply, "\n%d. %s (%s, %s)", i+1, entry.Query, entry.Type, entry.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	return reply.String()
+}
+
+// monitor lists or deletes monitors, or starts creating one: the query is
+// asked for unless given, then the schedule
+func (b *Bot) monitor(user *models.User, args string) string {
+	action, rest, _ := strings.Cut(args, " ")
+	switch strings.ToLower(action) {
+	case "list":
+		b.setActive(user, "")
+		return b.listMonitors(user)
+	case "delete":
+		b.setActive(user, "")
+		found, err := monitors.Delete(strings.TrimSpace(rest), user.UserID)
+		if err != nil {
+			log.Printf("Error deleting monitor: %v", err)
+			return "Something went wrong, please try again later."
+		}
+		if !found {
+			return "No such monitor; see /monitor list."
+		}
+		return "Monitor deleted."
+	}
+
+	if auth.RoleOf(*user) == auth.RoleReadonly {
+		return "Your account is read-only."
+	}
+	if !b.verified(user) {
+		b.setActive(user, "")
+		return "Monitors are only open to approved chats."
+	}
+	if args == "" {
+		b.setActive(user, "monitor")
+		return "What should I watch? Send a search query."
+	}
+	return b.askSchedule(user, args)
+}
+
+func (b *Bot) askSchedule(user *models.User, query string) string {
+	if query == "" {
+		return "Send a search query, or /cancel."
+	}
+	b.setActive(user, "monitor:"+query)
+	return "How often should I check? Send a schedule such as @daily, @every 6h or a cron expression like 0 9 * * 1-5."
+}
+
+func (b *Bot) createMonitor(user *models.User, query, schedule string) string {
+	if _, err := monitors.ParseSchedule(schedule, config.Config.MonitorMinInterval); err != nil {
+		return err.Error() + ". Send another schedule, or /cancel."
+	}
+
+	count, err := monitors.Count(user.UserID)
+	if err != nil {
+		log.Printf("Error counting monitors: %v", err)
+		return "Something went wrong, please try again later."
+	}
+	b.setActive(user, "")
+	if count >= config.Config.MonitorMaxPerUser {
+		return fmt.Sprintf("You already have the maximum of %d monitors.", config.Config.MonitorMaxPerUser)
+	}
+
+	monitor := &models.Monitor{
+		UserID:   user.UserID,
+		Name:     query,
+		Query:    query,
+		Engines:  []string{"duckduckgo"},
+		Schedule: schedule,
+	}
+	if err := monitors.Create(monitor); err != nil {
+		log.Printf("Error creating monitor: %v", err)
+		return "Something went wrong, please try again later."
+	}
+
+	reply := fmt.Sprintf("Watching %q (%s). The first run records the current results; after that I will message you here when they change.", query, schedule)
+	if monitor.NextRunAt != nil {
+		reply += "\nNext run: " + monitor.NextRunAt.Format("2006-01-02 15:04 MST")
+	}
+	return reply
+}
+
+func (b *Bot) listMonitors(user *models.User) string {
+	list, err := monitors.List(user.UserID)
+	if err != nil {
+		log.Printf("Error listing monitors: %v", err)
+		return "Something went wrong, please try again later."
+	}
+	if len(list) == 0 {
+		return "You have no monitors. Start one with /monitor."
+	}
+
+	var reply strings.Builder
+	reply.WriteString("Your monitors:")
+	for _, monitor := range list {
+		status := "paused"
+		if monitor.NextRunAt != nil {
+			status = "next run " + monitor.NextRunAt.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(&reply, "\n- %s (%s, %s)\n  id: %s", monitor.Name, monitor.Schedule, status, monitor.ID)
+	}
+	return reply.String()
+}
+
+// notifyMonitor sends the changes found by a run to the owner's chat, if
+// the owner is a Telegram user
+func (b *Bot) notifyMonitor(monitor *models.Monitor, run *models.MonitorRun) {
+	users, err := database.GetUsers()
+	if err != nil {
+		return
+	}
+	user, err := users.FindByID(monitor.UserID)
+	if err != nil || user.From != from {
+		return
+	}
+	chatID, err := strconv.ParseInt(user.ChatID, 10, 64)
+	if err != nil {
+		return
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "Changes for %q: %d new, %d changed, %d dropped\n\n%s",
+		monitor.Name, len(run.Changes.New), len(run.Changes.Changed), len(run.Changes.Dropped), run.Summary)
+	changed := append(run.Changes.New, run.Changes.Changed...)
+	if len(changed) > 0 {
+		text.WriteString("\n")
+	}
+	for i, result := range changed {
+		if i == maxLinks {
+			break
+		}
+		fmt.Fprintf(&text, "\n%d. %s\n%s", i+1, result.Title, result.Link)
+	}
+	b.reply(chatID, text.String())
+}
+
+// verified applies RequireEmailVerification to the user. Bot accounts have
+// no email, so listed chats stand in for verified ones.
+func (b *Bot) verified(user *models.User) bool {
+	return !config.Config.RequireEmailVerification || user.EmailVerified || b.allowed[user.ChatID]
+}
+
+// user returns the account of the chat, creating it on first contact
+func (b *Bot) user(msg *Message) (*models.User, error) {
+	chatID := strconv.FormatInt(msg.Chat.ID, 10)
+	users, err := database.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+	user, err := users.FindByChat(from, chatID)
+	if err != database.ErrUserNotFound {
+		return user, err
+	}
+
+	// Bot accounts have no usable password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(auth.RandomToken()), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	username := "tg_" + chatID
+	if msg.From != nil && msg.From.Username != "" {
+		username = "tg_" + strings.ToLower(msg.From.Username)
+	}
+	user = &models.User{
+		Username: username,
+		UserID:   storage.NewID(),
+		HashPass: string(hashedPassword),
+		From:     from,
+		ChatID:   chatID,
+		Role:     auth.RoleUser,
+	}
+	err = users.Create(user)
+	if err == database.ErrUserExists {
+		user.Username = "tg_" + chatID
+		err = users.Create(user)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Created Telegram user %s for chat %s", user.Username, chatID)
+	return user, nil
+}
+
+// setActive saves the command awaiting the next message of the user
+func (b *Bot) setActive(user *models.User, command string) {
+	current := ""
+	if user.ActiveCommand != nil {
+		current = *user.ActiveCommand
+	}
+	if current == command {
+		return
+	}
+
+	user.ActiveCommand = nil
+	if command != "" {
+		user.ActiveCommand = &command
+	}
+	users, err := database.GetUsers()
+	if err == nil {
+		err = users.Update(user)
+	}
+	if err != nil {
+		log.Printf("Error saving active command: %v", err)
+	}
+}
+
+func (b *Bot) reply(chatID int64, text string) {
+	if err := b.client.SendMessage(chatID, text); err != nil {
+		log.Printf("Error sending Telegram message: %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+package telegram
+
+import (
+	"encoding/json"
+	"golang.org/x/time/rate"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"web-scraper/internal/config"
+	"web-scraper/internal/database"
+	"web-scraper/internal/handlersArgs"
+	"web-scraper/internal/models"
+	"web-scraper/internal/monitors"
+)
+
+// Chat listed in TELEGRAM_ALLOWED_CHATS and one that is not
+const (
+	allowedChat  = 1001
+	unlistedChat = 2002
+)
+
+type sentMessage struct {
+	ChatID int64  `json:"chat_id"`
+	Text   string `json:"text"`
+}
+
+// fakeAPI is a Bot API serving queued updates to getUpdates and recording
+// sendMessage calls
+type fakeAPI struct {
+	server *httptest.Server
+
+	mu      sync.Mutex
+	updates []Update
+	nextID  int64
+	sent    chan sentMessage
+}
+
+func newFakeAPI() *fakeAPI {
+	api := &fakeAPI{sent: make(chan sentMessage, 100)}
+	api.server = httptest.NewServer(http.HandlerFunc(api.serve))
+	return api
+}
+
+func (api *fakeAPI) serve(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	if !strings.HasPrefix(r.URL.Path, "/bottest-token/") {
+		json.NewEncoder(w).Encode(apiResponse{OK: false, Description: "Unauthorized"})
+		return
+	}
+
+	var result interface{} = true
+	switch method {
+	case "getUpdates":
+		var params struct {
+			Offset int64 `json:"offset"`
+		}
+		json.NewDecoder(r.Body).Decode(&params)
+		pending := api.pending(params.Offset)
+		if len(pending) == 0 {
+			// A short long poll
+			time.Sleep(20 * time.Millisecond)
+		}
+		result = pending
+	case "sendMessage":
+		var msg sentMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+		api.sent <- msg
+	}
+	data, _ := json.Marshal(result)
+	json.NewEncoder(w).Encode(apiResponse{OK: true, Result: data})
+}
+
+func (api *fakeAPI) pending(offset int64) []Update {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	pending := []Update{}
+	for _, update := range api.updates {
+		if update.UpdateID >= offset {
+			pending = append(pending, update)
+		}
+	}
+	return pending
+}
+
+// say sends text from the chat and returns the bot's reply
+func (api *fakeAPI) say(t *testing.T, chatID int64, text string) string {
+	t.Helper()
+	api.mu.Lock()
+	api.nextID++
+	api.updates = append(api.updates, Update{
+		UpdateID: api.nextID,
+		Message: &Message{
+			MessageID: api.nextID,
+			From:      &User{ID: chatID, FirstName: "Test"},
+			Chat:      Chat{ID: chatID, Type: "private"},
+			Text:      text,
+		},
+	})
+	api.mu.Unlock()
+
+	select {
+	case msg := <-api.sent:
+		if msg.ChatID != chatID {
+			t.Fatalf("reply went to chat %d, want %d", msg.ChatID, chatID)
+		}
+		return msg.Text
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no reply to %q", text)
+		return ""
+	}
+}
+
+var (
+	api *fakeAPI
+
+	searchesMu sync.Mutex
+	searches   []string
+)
+
+func search(userID, query string, deep bool) (*models.SearchResponse, error) {
+	searchesMu.Lock()
+	defer searchesMu.Unlock()
+	if deep {
+		query = "deep:" + query
+	}
+	searches = append(searches, query)
+	return &models.SearchResponse{
+		FormattedResult: "Summary of " + query,
+		Results:         []models.SearchResult{{Title: "Example", Link: "https://example.com/"}},
+	}, nil
+}
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "telegram-test")
+	if err != nil {
+		panic(err)
+	}
+	config.Config.DataDir = dir
+	config.Config.UserStore = "sqlite"
+	config.Config.SQLitePath = ""
+	config.Config.RequireEmailVerification = true
+
+	api = newFakeAPI()
+	config.Config.TelegramAPIURL = api.server.URL
+	config.Config.TelegramBotToken = "test-token"
+	config.Config.TelegramAllowedChats = "1001"
+	config.Config.TelegramOpen = false
+	config.Config.TelegramPollTimeout = time.Second
+	handlersArgs.GetLimiter().SetLimit(rate.Inf)
+	go newBot(search).poll()
+
+	code := m.Run()
+	api.server.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestSearchReply(t *testing.T) {
+	reply := api.say(t, allowedChat, "golang generics")
+	if !strings.Contains(reply, "Summary of golang generics") || !strings.Contains(reply, "https://example.com/") {
+		t.Errorf("unexpected reply %q", reply)
+	}
+
+	reply = api.say(t, allowedChat, "/deep rust async")
+	if !strings.Contains(reply, "Summary of deep:rust async") {
+		t.Errorf("unexpected deep search reply %q", reply)
+	}
+}
+
+func TestUnlistedChatIsDenied(t *testing.T) {
+	searchesMu.Lock()
+	before := len(searches)
+	searchesMu.Unlock()
+
+	if reply := api.say(t, unlistedChat, "anything"); reply != "Sorry, this bot is private." {
+		t.Errorf("unlisted chat got %q", reply)
+	}
+	searchesMu.Lock()
+	defer searchesMu.Unlock()
+	if len(searches) != before {
+		t.Errorf("unlisted chat ran a search")
+	}
+}
+
+func TestMonitorConversation(t *testing.T) {
+	if reply := api.say(t, allowedChat, "/monitor"); !strings.Contains(reply, "What should I watch?") {
+		t.Fatalf("unexpected reply to /monitor: %q", reply)
+	}
+	if reply := api.say(t, allowedChat, "go releases"); !strings.Contains(reply, "How often should I check?") {
+		t.Fatalf("unexpected reply to the query: %q", reply)
+	}
+	if reply := api.say(t, allowedChat, "every now and then"); !strings.Contains(reply, "Send another schedule") {
+		t.Fatalf("unexpected reply to a bad schedule: %q", reply)
+	}
+	if reply := api.say(t, allowedChat, "@daily"); !strings.Contains(reply, `Watching "go releases" (@daily)`) {
+		t.Fatalf("unexpected reply to the schedule: %q", reply)
+	}
+
+	users, err := database.GetUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := users.FindByChat(from, "1001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ActiveCommand != nil {
+		t.Errorf("active command %q left after the monitor was created", *user.ActiveCommand)
+	}
+	list, err := monitors.List(user.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Query != "go releases" || list[0].Schedule != "@daily" {
+		t.Fatalf("unexpected monitors %+v", list)
+	}
+
+	if reply := api.say(t, allowedChat, "/monitor delete "+list[0].ID); reply != "Monitor deleted." {
+		t.Errorf("unexpected reply to /monitor delete: %q", reply)
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	if parts := splitMessage("short", 10); len(parts) != 1 || parts[0] != "short" {
+		t.Errorf("short text split into %q", parts)
+	}
+
+	// Cut at the last line break in the second half of the limit
+	parts := splitMessage("aaaaaa\nbbbbbbbb\ncc", 10)
+	want := []string{"aaaaaa", "bbbbbbbb", "cc"}
+	if strings.Join(parts, "|") != strings.Join(want, "|") {
+		t.Errorf("split into %q, want %q", parts, want)
+	}
+
+	// Without line breaks, and counting characters rather than bytes
+	text := strings.Repeat("é", 25)
+	parts = splitMessage(text, 10)
+	if len(parts) != 3 || strings.Join(parts, "") != text {
+		t.Fatalf("split into %q", parts)
+	}
+	for _, part := range parts {
+		if n := len([]rune(part)); n > 10 {
+			t.Errorf("part of %d characters exceeds the limit", n)
+		}
+	}
+}
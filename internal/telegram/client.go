@@ -0,0 +1,147 @@
+package telegram
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Telegram rejects messages longer than 4096 characters; leave room for
+// characters counted as two UTF-16 units
+const maxMessageLength = 4000
+
+// Client calls the Telegram Bot API
+type Client struct {
+	// baseURL includes the bot token, so it must never be logged
+	baseURL string
+	http    *http.Client
+}
+
+// NewClient returns a client of the Bot API at apiURL, normally
+// https://api.telegram.org. Requests may take up to pollTimeout when long
+// polling for updates.
+func NewClient(apiURL, token string, pollTimeout time.Duration) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(apiURL, "/") + "/bot" + token,
+		http:    &http.Client{Timeout: pollTimeout + 10*time.Second},
+	}
+}
+
+type Update struct {
+	UpdateID int64    `json:"update_id"`
+	Message  *Message `json:"message,omitempty"`
+}
+
+type Message struct {
+	MessageID int64  `json:"message_id"`
+	From      *User  `json:"from,omitempty"`
+	Chat      Chat   `json:"chat"`
+	Date      int64  `json:"date"`
+	Text      string `json:"text,omitempty"`
+}
+
+type User struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username,omitempty"`
+	FirstName string `json:"first_name"`
+}
+
+type Chat struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+}
+
+type apiResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	Description string          `json:"description"`
+}
+
+// call invokes a Bot API method and decodes its result into result, if set
+func (c *Client) call(method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Post(c.baseURL+"/"+method, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The error quotes the URL, which holds the token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	var response apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("%s: status %d: %v", method, resp.StatusCode, err)
+	}
+	if !response.OK {
+		return fmt.Errorf("%s: %s", method, response.Description)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+// GetUpdates long polls for updates from offset on
+func (c *Client) GetUpdates(offset int64, timeout time.Duration) ([]Update, error) {
+	var updates []Update
+	err := c.call("getUpdates", map[string]interface{}{
+		"offset":          offset,
+		"timeout":         int(timeout.Seconds()),
+		"allowed_updates": []string{"message"},
+	}, &updates)
+	return updates, err
+}
+
+// SendMessage sends plain text to the chat, split into several messages if
+// it is too long for one
+func (c *Client) SendMessage(chatID int64, text string) error {
+	for _, part := range splitMessage(text, maxMessageLength) {
+		err := c.call("sendMessage", map[string]interface{}{
+			"chat_id":                  chatID,
+			"text":                     part,
+			"disable_web_page_preview": true,
+		}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendChatAction shows a status such as "typing" in the chat
+func (c *Client) SendChatAction(chatID int64, action string) error {
+	return c.call("sendChatAction", map[string]interface{}{
+		"chat_id": chatID,
+		"action":  action,
+	}, nil)
+}
+
+// splitMessage cuts text into parts of at most limit characters, at line
+// breaks where possible
+func splitMessage(text string, limit int) []string {
+	var parts []string
+	runes := []rune(text)
+	for len(runes) > limit {
+		cut := limit
+		for i := limit; i > limit/2; i-- {
+			if runes[i] == '\n' {
+				cut = i
+				break
+			}
+		}
+		parts = append(parts, string(runes[:cut]))
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), "\n"))
+	}
+	return append(parts, string(runes))
+}
@@ -0,0 +1,188 @@
+package vectors
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+	"web-scraper/internal/ai"
+	"web-scraper/internal/models"
+	"web-scraper/internal/packer"
+	"web-scraper/internal/search"
+	"web-scraper/internal/storage"
+)
+
+const (
+	bucket = "vectors"
+	// Words per embedded chunk of page content
+	chunkWords = 200
+)
+
+// Chunk is an embedded passage of a scraped page
+type Chunk struct {
+	Link      string    `json:"link"`
+	Title     string    `json:"title"`
+	Text      string    `json:"text"`
+	Model     string    `json:"model"`
+	Vector    []float32 `json:"vector"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// Match is a chunk found by a similarity search
+type Match struct {
+	Chunk
+	Similarity float64
+}
+
+// Store is a brute-force vector index over page chunks. Chunks are persisted
+// in the embedded database and kept in memory for searching.
+type Store struct {
+	mu     sync.RWMutex
+	chunks map[string]Chunk
+}
+
+// Load reads every stored chunk into memory
+func Load() (*Store, error) {
+	s := &Store{chunks: make(map[string]Chunk)}
+	err := storage.GetStore().ForEach(bucket, "", func(key string, data []byte) error {
+		var chunk Chunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			log.Printf("Error decoding chunk %s: %v", key, err)
+			return nil
+		}
+		s.chunks[key] = chunk
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// pagePrefix groups the chunk keys of one page
+func pagePrefix(link string) string {
+	sum := sha256.Sum256([]byte(search.NormalizeURL(link)))
+	return hex.EncodeToString(sum[:8]) + "/"
+}
+
+// AddResults chunks and embeds the content of deep search results,
+// replacing the chunks stored for the same pages earlier
+func (s *Store) AddResults(ctx context.Context, embedder ai.Embedder, results []models.SearchResult) (ai.Usage, error) {
+	var (
+		chunks []Chunk
+		texts  []string
+	)
+	now := time.Now()
+	for _, result := range results {
+		for _, text := range packer.Chunk(result.InnerContent, chunkWords) {
+			chunks = append(chunks, Chunk{
+				Link:      result.Link,
+				Title:     result.Title,
+				Text:      text,
+				Model:     embedder.Model(),
+				FetchedAt: now,
+			})
+			texts = append(texts, result.Title+"\n"+text)
+		}
+	}
+	if len(chunks) == 0 {
+		return ai.Usage{}, nil
+	}
+
+	vectors, usage, err := embedder.Embed(ctx, texts)
+	if err != nil {
+		return ai.Usage{}, err
+	}
+	for i := range chunks {
+		chunks[i].Vector = vectors[i]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db := storage.GetStore()
+	for _, result := range results {
+		if err := s.deletePage(db, result.Link); err != nil {
+			return usage, err
+		}
+	}
+	counts := make(map[string]int)
+	for _, chunk := range chunks {
+		prefix := pagePrefix(chunk.Link)
+		key := fmt.Sprintf("%s%04d", prefix, counts[prefix])
+		counts[prefix]++
+		if err := db.Put(bucket, key, chunk); err != nil {
+			return usage, err
+		}
+		s.chunks[key] = chunk
+	}
+	return usage, nil
+}
+
+func (s *Store) deletePage(db *storage.Store, link string) error {
+	var keys []string
+	err := db.ForEach(bucket, pagePrefix(link), func(key string, _ []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := db.Delete(bucket, key); err != nil {
+			return err
+		}
+		delete(s.chunks, key)
+	}
+	return nil
+}
+
+// Search returns the k chunks most similar to the query vector. Only chunks
+// embedded with the same model are comparable.
+func (s *Store) Search(vector []float32, model string, k int) []Match {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matches []Match
+	for _, chunk := range s.chunks {
+		if chunk.Model != model {
+			continue
+		}
+		matches = append(matches, Match{Chunk: chunk, Similarity: ai.Cosine(vector, chunk.Vector)})
+	}
+	sort.Slice(matches, func(a, b int) bool {
+		return matches[a].Similarity > matches[b].Similarity
+	})
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches
+}
+
+func (s *Store) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.chunks)
+}
+
+var (
+	instance *Store
+	once     sync.Once
+)
+
+// GetStore returns the singleton vector store loaded from the database
+func GetStore() *Store {
+	once.Do(func() {
+		var err error
+		instance, err = Load()
+		if err != nil {
+			panic(err)
+		}
+	})
+	return instance
+}
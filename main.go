@@ -4,14 +4,33 @@ import (
 	"log"
 	"net/http"
 	"time"
+	"web-scraper/internal/audit"
+	"web-scraper/internal/auth"
 	"web-scraper/internal/config"
+	"web-scraper/internal/crawl"
+	"web-scraper/internal/database"
 	"web-scraper/internal/handlers"
+	"web-scraper/internal/history"
+	"web-scraper/internal/index"
+	"web-scraper/internal/jobs"
+	"web-scraper/internal/mail"
 	"web-scraper/internal/middleware"
+	"web-scraper/internal/monitors"
+	"web-scraper/internal/prompts"
+	"web-scraper/internal/sessions"
+	"web-scraper/internal/storage"
+	"web-scraper/internal/telegram"
+	"web-scraper/internal/vectors"
 )
 
 func main() {
 	mux := http.NewServeMux()
 
+	// Readonly users may only read their stored data. Users who have not
+	// verified their email are kept to basic search by RequireVerifiedEmail.
+	writers := middleware.RequireRole(auth.RoleAdmin, auth.RoleUser, auth.RoleService)
+	admins := middleware.RequireRole(auth.RoleAdmin)
+
 	// Public routes
 	mux.HandleFunc("/api/login", middleware.ChainMiddleware(
 		handlers.Login,
@@ -23,34 +42,398 @@ func main() {
 		middleware.RecoveryMiddleware,
 		middleware.LoggingMiddleware,
 	))
+	mux.HandleFunc("POST /api/token/refresh", middleware.ChainMiddleware(
+		handlers.RefreshTokenHandler,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("/api/email/verify", middleware.ChainMiddleware(
+		handlers.VerifyEmailHandler,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("POST /api/password/forgot", middleware.ChainMiddleware(
+		handlers.ForgotPasswordHandler,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("POST /api/password/reset", middleware.ChainMiddleware(
+		handlers.ResetPasswordHandler,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("GET /api/auth/oidc/login", middleware.ChainMiddleware(
+		handlers.OIDCLoginHandler,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("GET /api/auth/oidc/callback", middleware.ChainMiddleware(
+		handlers.OIDCCallbackHandler,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
 	mux.HandleFunc("/health", handlers.HealthCheckHandler)
 
 	// Protected routes
+	mux.HandleFunc("POST /api/email/verify/resend", middleware.ChainMiddleware(
+		handlers.ResendVerificationHandler,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("POST /api/logout", middleware.ChainMiddleware(
+		handlers.LogoutHandler,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("POST /api/keys", middleware.ChainMiddleware(
+		handlers.CreateAPIKeyHandler,
+		writers,
+		middleware.RequireVerifiedEmail,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("GET /api/keys", middleware.ChainMiddleware(
+		handlers.APIKeysHandler,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("DELETE /api/keys/{id}", middleware.ChainMiddleware(
+		handlers.RevokeAPIKeyHandler,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
 	mux.HandleFunc("/api/scraper", middleware.ChainMiddleware(
 		handlers.SearchHandler,
+		writers,
 		middleware.AuthMiddleware,
 		middleware.RecoveryMiddleware,
 		middleware.LoggingMiddleware,
 	))
 	mux.HandleFunc("/api/scraper-deep", middleware.ChainMiddleware(
 		handlers.SearchDeepHandler,
+		writers,
+		middleware.RequireVerifiedEmail,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("GET /api/sessions/{id}", middleware.ChainMiddleware(
+		handlers.SessionHandler,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("POST /api/sessions/{id}/ask", middleware.ChainMiddleware(
+		handlers.SessionAskHandler,
+		writers,
+		middleware.RequireVerifiedEmail,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("GET /api/history", middleware.ChainMiddleware(
+		handlers.HistoryHandler,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("DELETE /api/history", middleware.ChainMiddleware(
+		handlers.ClearHistoryHandler,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("GET /api/history/{id}", middleware.ChainMiddleware(
+		handlers.HistoryEntryHandler,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("DELETE /api/history/{id}", middleware.ChainMiddleware(
+		handlers.DeleteHistoryEntryHandler,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("POST /api/history/{id}/replay", middleware.ChainMiddleware(
+		handlers.ReplayHistoryHandler,
+		writers,
+		middleware.RequireVerifiedEmail,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("POST /api/collections", middleware.ChainMiddleware(
+		handlers.CreateCollectionHandler,
+		writers,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("GET /api/collections", middleware.ChainMiddleware(
+		handlers.CollectionsHandler,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("GET /api/collections/{id}", middleware.ChainMiddleware(
+		handlers.CollectionHandler,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("PUT /api/collections/{id}", middleware.ChainMiddleware(
+		handlers.UpdateCollectionHandler,
+		writers,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("DELETE /api/collections/{id}", middleware.ChainMiddleware(
+		handlers.DeleteCollectionHandler,
+		writers,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("POST /api/collections/{id}/items", middleware.ChainMiddleware(
+		handlers.AddCollectionItemHandler,
+		writers,
+		middleware.RequireVerifiedEmail,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("PUT /api/collections/{id}/items/{item}", middleware.ChainMiddleware(
+		handlers.UpdateCollectionItemHandler,
+		writers,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("DELETE /api/collections/{id}/items/{item}", middleware.ChainMiddleware(
+		handlers.DeleteCollectionItemHandler,
+		writers,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("POST /api/collections/{id}/synthesize", middleware.ChainMiddleware(
+		handlers.SynthesizeCollectionHandler,
+		writers,
+		middleware.RequireVerifiedEmail,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("/api/scrape", middleware.ChainMiddleware(
+		handlers.ScrapeHandler,
+		writers,
+		middleware.RequireVerifiedEmail,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("POST /api/jobs", middleware.ChainMiddleware(
+		handlers.CreateJobHandler,
+		writers,
+		middleware.RequireVerifiedEmail,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("GET /api/jobs/{id}", middleware.ChainMiddleware(
+		handlers.JobHandler,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("POST /api/crawls", middleware.ChainMiddleware(
+		handlers.CreateCrawlHandler,
+		writers,
+		middleware.RequireVerifiedEmail,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("GET /api/crawls/{id}", middleware.ChainMiddleware(
+		handlers.CrawlHandler,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("GET /api/crawls/{id}/pages", middleware.ChainMiddleware(
+		handlers.CrawlPagesHandler,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("GET /api/crawls/{id}/export", middleware.ChainMiddleware(
+		handlers.CrawlExportHandler,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("POST /api/monitors", middleware.ChainMiddleware(
+		handlers.CreateMonitorHandler,
+		writers,
+		middleware.RequireVerifiedEmail,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("GET /api/monitors", middleware.ChainMiddleware(
+		handlers.MonitorsHandler,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("GET /api/monitors/{id}", middleware.ChainMiddleware(
+		handlers.MonitorHandler,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("PUT /api/monitors/{id}", middleware.ChainMiddleware(
+		handlers.UpdateMonitorHandler,
+		writers,
+		middleware.RequireVerifiedEmail,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("DELETE /api/monitors/{id}", middleware.ChainMiddleware(
+		handlers.DeleteMonitorHandler,
+		writers,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("GET /api/monitors/{id}/runs", middleware.ChainMiddleware(
+		handlers.MonitorRunsHandler,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("POST /api/monitors/{id}/run", middleware.ChainMiddleware(
+		handlers.RunMonitorHandler,
+		writers,
+		middleware.RequireVerifiedEmail,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("/api/research", middleware.ChainMiddleware(
+		handlers.ResearchHandler,
+		writers,
+		middleware.RequireVerifiedEmail,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("GET /api/index/search", middleware.ChainMiddleware(
+		handlers.IndexSearchHandler,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("/api/ask", middleware.ChainMiddleware(
+		handlers.AskHandler,
+		writers,
+		middleware.RequireVerifiedEmail,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("GET /api/admin/users/{id}", middleware.ChainMiddleware(
+		handlers.AdminUserHandler,
+		admins,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("PUT /api/admin/users/{id}/role", middleware.ChainMiddleware(
+		handlers.UpdateUserRoleHandler,
+		admins,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("GET /api/admin/audit", middleware.ChainMiddleware(
+		handlers.AuditLogHandler,
+		admins,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("GET /api/admin/lockouts", middleware.ChainMiddleware(
+		handlers.FailedLoginsHandler,
+		admins,
+		middleware.AuthMiddleware,
+		middleware.RecoveryMiddleware,
+		middleware.LoggingMiddleware,
+	))
+	mux.HandleFunc("DELETE /api/admin/lockouts", middleware.ChainMiddleware(
+		handlers.ResetLockoutHandler,
+		admins,
 		middleware.AuthMiddleware,
 		middleware.RecoveryMiddleware,
 		middleware.LoggingMiddleware,
 	))
 	mux.HandleFunc("/cache/stats", middleware.ChainMiddleware(
 		handlers.CacheStatsHandler,
+		admins,
 		middleware.AuthMiddleware,
 		middleware.RecoveryMiddleware,
 		middleware.LoggingMiddleware,
 	))
 	mux.HandleFunc("/cache/metrics", middleware.ChainMiddleware(
 		handlers.CacheMetricsHandler,
+		admins,
 		middleware.AuthMiddleware,
 		middleware.RecoveryMiddleware,
 		middleware.LoggingMiddleware,
 	))
 
+	// Open the local database up front so a bad data directory fails fast
+	storage.GetStore()
+	if _, err := database.GetUsers(); err != nil {
+		log.Fatalf("Error opening user store: %v", err)
+	}
+	if _, err := mail.GetMailer(); err != nil {
+		log.Fatalf("Error setting up mailer: %v", err)
+	}
+	if _, err := prompts.GetRegistry(); err != nil {
+		log.Fatalf("Error loading prompt templates: %v", err)
+	}
+	if config.Config.Mailer == "log" {
+		log.Printf("Email, including password reset tokens, is written to the log; set MAILER=smtp in production")
+	}
+	index.GetIndex()
+	vectors.GetStore()
+	if err := crawl.FailInterrupted(); err != nil {
+		log.Printf("Error recovering crawls: %v", err)
+	}
+	if err := jobs.Start(config.Config.JobWorkers, config.Config.JobQueueSize, handlers.RunJob); err != nil {
+		log.Fatalf("Error starting job workers: %v", err)
+	}
+	jobs.StartPruning(config.Config.JobTTL, time.Hour)
+	if err := monitors.Start(handlers.SearchMonitor, handlers.SummarizeMonitorChanges, config.Config.MonitorConcurrency); err != nil {
+		log.Fatalf("Error starting monitor scheduler: %v", err)
+	}
+	sessions.StartPruning(config.Config.SessionTTL, time.Hour)
+	history.StartPruning(config.Config.HistoryTTL, time.Hour)
+	auth.StartPruning(time.Hour)
+	audit.StartPruning(config.Config.AuditLogTTL, time.Hour)
+	if config.Config.TelegramBotToken != "" {
+		telegram.Start(handlers.SearchForUser)
+	}
+
 	server := &http.Server{
 		Addr:         ":" + config.Config.Port,
 		Handler:      mux,
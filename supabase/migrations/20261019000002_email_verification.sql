@@ -0,0 +1,4 @@
+-- Accounts created before verification existed keep full access; new rows
+-- default to unverified
+ALTER TABLE users ADD COLUMN email_verified boolean NOT NULL DEFAULT true;
+ALTER TABLE users ALTER COLUMN email_verified SET DEFAULT false;
@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN oidc_subject text NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX users_oidc_subject ON users (oidc_subject) WHERE oidc_subject <> '';